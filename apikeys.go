@@ -0,0 +1,176 @@
+// apikeys.go
+//
+// Things for selecting one of multiple API keys, and rotating them when their quotas are exhausted.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+const (
+	// selections of api keys
+	apiKeySelectionFailover   = "failover"    // always start from the first available key
+	apiKeySelectionRoundRobin = "round-robin" // start from the available key next to the last used one
+
+	// name of the state file for api keys (in the cache directory)
+	apiKeysStateFilename = "api_keys.json"
+)
+
+// state of api keys, shared between runs
+//
+// (keys are identified with their hashes, so they are not saved in plain text)
+type apiKeysState struct {
+	LastUsed  string               `json:"last_used,omitempty"`
+	Cooldowns map[string]time.Time `json:"cooldowns,omitempty"` // (id => until)
+}
+
+// a ring of api keys
+type apiKeyRing struct {
+	keys      []string // (ordered for this run: available keys first, then cooled down ones)
+	cooldown  time.Duration
+	statePath string
+}
+
+// generate a ring of given api keys, ordered with given selection ('failover' or 'round-robin')
+//
+// (the state file is read for moving cooled down keys to the end, and updated for round-robin selection)
+func newAPIKeyRing(
+	keys []string,
+	selection string,
+	cooldown time.Duration,
+	statePath string,
+) (*apiKeyRing, error) {
+	if selection != apiKeySelectionFailover && selection != apiKeySelectionRoundRobin {
+		return nil, fmt.Errorf("unknown api key selection: '%s'", selection)
+	}
+
+	ring := &apiKeyRing{
+		cooldown:  cooldown,
+		statePath: statePath,
+	}
+	for _, key := range keys {
+		if !slices.Contains(ring.keys, key) {
+			ring.keys = append(ring.keys, key)
+		}
+	}
+	if len(ring.keys) == 0 {
+		return nil, fmt.Errorf("no api key was given")
+	}
+	state := ring.readState()
+
+	// (rotate keys to start from the one next to the last used one)
+	if selection == apiKeySelectionRoundRobin {
+		if index := slices.IndexFunc(ring.keys, func(key string) bool {
+			return apiKeyID(key) == state.LastUsed
+		}); index >= 0 {
+			ring.keys = slices.Concat(ring.keys[index+1:], ring.keys[:index+1])
+		}
+	}
+
+	// (move cooled down keys to the end, in the order of their expirations)
+	now := time.Now()
+	available, cooled := []string{}, []string{}
+	for _, key := range ring.keys {
+		if until, exists := state.Cooldowns[apiKeyID(key)]; exists && until.After(now) {
+			cooled = append(cooled, key)
+		} else {
+			available = append(available, key)
+		}
+	}
+	slices.SortStableFunc(cooled, func(a, b string) int {
+		return state.Cooldowns[apiKeyID(a)].Compare(state.Cooldowns[apiKeyID(b)])
+	})
+	ring.keys = append(available, cooled...)
+
+	// NOTE: failures of writing the state are ignored, as they only affect the selection of next runs
+	if selection == apiKeySelectionRoundRobin {
+		state.LastUsed = apiKeyID(ring.keys[0])
+		_ = ring.writeState(state)
+	}
+
+	return ring, nil
+}
+
+// mark given key as cooled down for given duration (or the default one if it is not positive)
+func (r *apiKeyRing) coolDown(key string, duration time.Duration) error {
+	if duration <= 0 {
+		duration = r.cooldown
+	}
+
+	state := r.readState()
+	if state.Cooldowns == nil {
+		state.Cooldowns = map[string]time.Time{}
+	}
+	state.Cooldowns[apiKeyID(key)] = time.Now().Add(duration)
+
+	return r.writeState(state)
+}
+
+// read the state file (returns an empty state if it does not exist or is broken)
+func (r *apiKeyRing) readState() (state apiKeysState) {
+	if bytes, err := os.ReadFile(r.statePath); err == nil {
+		_ = json.Unmarshal(bytes, &state)
+	}
+	return state
+}
+
+// write the state file (expired cooldowns are removed)
+func (r *apiKeyRing) writeState(state apiKeysState) error {
+	now := time.Now()
+	for id, until := range state.Cooldowns {
+		if !until.After(now) {
+			delete(state.Cooldowns, id)
+		}
+	}
+
+	bytes, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to marshal state of api keys: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(r.statePath), 0o700); err != nil {
+		return fmt.Errorf("failed to create directory for state of api keys: %w", err)
+	}
+
+	// NOTE: write to a temporary file and rename it, for not breaking the file with concurrent runs
+	tmp, err := os.CreateTemp(filepath.Dir(r.statePath), apiKeysStateFilename+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file for state of api keys: %w", err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }() // (no-op after a successful rename)
+	if _, err := tmp.Write(bytes); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to write state of api keys: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write state of api keys: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), r.statePath); err != nil {
+		return fmt.Errorf("failed to write state of api keys: %w", err)
+	}
+
+	return nil
+}
+
+// path of the state file for api keys
+func apiKeysStateFilepath() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, appName, apiKeysStateFilename), nil
+}
+
+// return the identifier of given api key
+func apiKeyID(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(hash[:8])
+}
@@ -0,0 +1,127 @@
+// apikeys_test.go
+//
+// Things for testing `apikeys.go`.
+
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// test `newAPIKeyRing` with selections and cooldowns
+func TestAPIKeyRing(t *testing.T) {
+	keys := []string{"key-a", "key-b", "key-c", "key-a"}
+
+	t.Run("failover", func(t *testing.T) {
+		statePath := filepath.Join(t.TempDir(), apiKeysStateFilename)
+
+		for range 2 {
+			ring, err := newAPIKeyRing(keys, apiKeySelectionFailover, time.Minute, statePath)
+			if err != nil {
+				t.Fatalf("failed to create api key ring: %s", err)
+			}
+			if expected := []string{"key-a", "key-b", "key-c"}; !slices.Equal(ring.keys, expected) {
+				t.Errorf("expected keys %v, got %v", expected, ring.keys)
+			}
+		}
+
+		// cool down the first key
+		ring, _ := newAPIKeyRing(keys, apiKeySelectionFailover, time.Minute, statePath)
+		if err := ring.coolDown("key-a", 0); err != nil {
+			t.Fatalf("failed to cool down api key: %s", err)
+		}
+		ring, _ = newAPIKeyRing(keys, apiKeySelectionFailover, time.Minute, statePath)
+		if expected := []string{"key-b", "key-c", "key-a"}; !slices.Equal(ring.keys, expected) {
+			t.Errorf("expected keys %v, got %v", expected, ring.keys)
+		}
+
+		// cool down another key for a shorter duration
+		if err := ring.coolDown("key-b", time.Second); err != nil {
+			t.Fatalf("failed to cool down api key: %s", err)
+		}
+		ring, _ = newAPIKeyRing(keys, apiKeySelectionFailover, time.Minute, statePath)
+		if expected := []string{"key-c", "key-b", "key-a"}; !slices.Equal(ring.keys, expected) {
+			t.Errorf("expected keys %v, got %v", expected, ring.keys)
+		}
+
+		// keys are not saved in plain text
+		if bytes, err := os.ReadFile(statePath); err != nil {
+			t.Errorf("failed to read state file: %s", err)
+		} else if strings.Contains(string(bytes), "key-") {
+			t.Errorf("expected no api keys in the state file, got '%s'", bytes)
+		}
+	})
+
+	t.Run("round-robin", func(t *testing.T) {
+		statePath := filepath.Join(t.TempDir(), apiKeysStateFilename)
+
+		firsts := []string{}
+		for range 4 {
+			ring, err := newAPIKeyRing(keys, apiKeySelectionRoundRobin, time.Minute, statePath)
+			if err != nil {
+				t.Fatalf("failed to create api key ring: %s", err)
+			}
+			firsts = append(firsts, ring.keys[0])
+		}
+		if expected := []string{"key-a", "key-b", "key-c", "key-a"}; !slices.Equal(firsts, expected) {
+			t.Errorf("expected first keys %v, got %v", expected, firsts)
+		}
+
+		// cooled down keys are skipped
+		ring, _ := newAPIKeyRing(keys, apiKeySelectionRoundRobin, time.Minute, statePath)
+		if ring.keys[0] != "key-b" {
+			t.Fatalf("expected first key 'key-b', got '%s'", ring.keys[0])
+		}
+		_ = ring.coolDown("key-c", 0)
+		ring, _ = newAPIKeyRing(keys, apiKeySelectionRoundRobin, time.Minute, statePath)
+		if expected := []string{"key-a", "key-b", "key-c"}; !slices.Equal(ring.keys, expected) {
+			t.Errorf("expected keys %v, got %v", expected, ring.keys)
+		}
+	})
+
+	t.Run("concurrent writes", func(t *testing.T) {
+		dir := t.TempDir()
+		statePath := filepath.Join(dir, apiKeysStateFilename)
+
+		ring, _ := newAPIKeyRing(keys, apiKeySelectionFailover, time.Minute, statePath)
+		var wg sync.WaitGroup
+		for _, key := range ring.keys {
+			for range 10 {
+				wg.Go(func() {
+					if err := ring.coolDown(key, 0); err != nil {
+						t.Errorf("failed to cool down api key: %s", err)
+					}
+				})
+			}
+		}
+		wg.Wait()
+
+		// the state file is not broken, and no temporary file is left
+		if bytes, err := os.ReadFile(statePath); err != nil {
+			t.Errorf("failed to read state file: %s", err)
+		} else if err := json.Unmarshal(bytes, &apiKeysState{}); err != nil {
+			t.Errorf("expected a valid state file, got '%s': %s", bytes, err)
+		}
+		if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+			t.Errorf("expected only the state file, got %v", entries)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		statePath := filepath.Join(t.TempDir(), apiKeysStateFilename)
+
+		if _, err := newAPIKeyRing(keys, "random", time.Minute, statePath); err == nil {
+			t.Errorf("expected an error for unknown selection")
+		}
+		if _, err := newAPIKeyRing(nil, apiKeySelectionFailover, time.Minute, statePath); err == nil {
+			t.Errorf("expected an error for no api key")
+		}
+	})
+}
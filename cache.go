@@ -7,10 +7,14 @@ package main
 import (
 	"context"
 	"fmt"
+	"maps"
 	"path/filepath"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/fatih/color"
+	"google.golang.org/genai"
 
 	gt "github.com/meinside/gemini-things-go"
 )
@@ -25,9 +29,6 @@ func cacheContext(
 	p params,
 ) (exit int, e error) {
 	systemInstruction := *p.Generation.DetailedOptions.SystemInstruction
-	filepaths := p.Generation.Filepaths
-	overrideMimeTypeForExt := p.OverrideFileMIMEType
-	cachedContextDisplayName := p.Caching.CachedContextName
 	vbs := p.Verbose
 
 	writer.verbose(
@@ -36,15 +37,65 @@ func cacheContext(
 		"caching context...",
 	)
 
+	// cache context and print the cached context's name
+	if name, err := cachePromptsAndFiles(
+		ctx,
+		writer,
+		timeoutSeconds,
+		gtc,
+		&systemInstruction,
+		prompts,
+		promptFiles,
+		p.Generation.Filepaths,
+		p.OverrideFileMIMEType,
+		p.Caching.CachedContextName,
+	); err == nil {
+		if p.outputAsJSON() {
+			return 0, printJSONResult(writer, struct {
+				CachedContext string `json:"cachedContext"`
+			}{
+				CachedContext: name,
+			})
+		}
+
+		writer.printColored(
+			color.FgHiWhite,
+			"%s",
+			name,
+		)
+	} else {
+		return 1, err
+	}
+
+	// success
+	return 0, nil
+}
+
+// cache given prompts and files as a context, and return the name of the cached context
+//
+// (shared by the command line and the self MCP server)
+func cachePromptsAndFiles(
+	ctx context.Context,
+	writer outputWriter,
+	timeoutSeconds int,
+	gtc *gt.Client,
+	systemInstruction *string,
+	prompts []gt.Prompt, promptFiles map[string][]byte,
+	filepaths []*string,
+	overrideMimeTypeForExt map[string]string,
+	displayName *string,
+) (name string, err error) {
 	// configure gemini things client
-	gtc.SetSystemInstructionFunc(func() string {
-		return systemInstruction
-	})
+	if systemInstruction != nil {
+		gtc.SetSystemInstructionFunc(func() string {
+			return *systemInstruction
+		})
+	}
 
 	// read & close files
 	files, err := openFilesForPrompt(promptFiles, filepaths)
 	if err != nil {
-		return 1, err
+		return "", err
 	}
 	defer func() {
 		for _, toClose := range files {
@@ -57,7 +108,6 @@ func cacheContext(
 		}
 	}()
 
-	// cache context and print the cached context's name
 	for _, file := range files {
 		var prompt gt.Prompt
 		if override, exists := overrideMimeTypeForExt[filepath.Ext(file.filepath)]; exists {
@@ -74,25 +124,14 @@ func cacheContext(
 	)
 	defer cancel()
 
-	if name, err := gtc.CacheContext(
+	return gtc.CacheContext(
 		ctx,
-		&systemInstruction,
+		systemInstruction,
 		prompts,
 		nil,
 		nil,
-		cachedContextDisplayName,
-	); err == nil {
-		writer.printColored(
-			color.FgHiWhite,
-			"%s",
-			name,
-		)
-	} else {
-		return 1, err
-	}
-
-	// success
-	return 0, nil
+		displayName,
+	)
 }
 
 // list cached contexts
@@ -111,14 +150,16 @@ func listCachedContexts(
 		"listing cached contexts...",
 	)
 
-	ctx, cancel := context.WithTimeout(
-		ctx,
-		time.Duration(timeoutSeconds)*time.Second,
-	)
-	defer cancel()
-
-	if listed, err := gtc.ListAllCachedContexts(ctx); err == nil {
-		if len(listed) > 0 {
+	if listed, err := fetchCachedContexts(ctx, timeoutSeconds, gtc); err == nil {
+		if p.outputAsJSON() {
+			if err := printJSONResult(writer, struct {
+				CachedContexts []*genai.CachedContent `json:"cachedContexts"`
+			}{
+				CachedContexts: listed,
+			}); err != nil {
+				return 1, err
+			}
+		} else if len(listed) > 0 {
 			for _, content := range listed {
 				writer.printColored(
 					color.FgHiGreen,
@@ -153,6 +194,28 @@ func listCachedContexts(
 	return 0, nil
 }
 
+// fetch all cached contexts, sorted by their names
+func fetchCachedContexts(
+	ctx context.Context,
+	timeoutSeconds int,
+	gtc *gt.Client,
+) ([]*genai.CachedContent, error) {
+	ctx, cancel := context.WithTimeout(
+		ctx,
+		time.Duration(timeoutSeconds)*time.Second,
+	)
+	defer cancel()
+
+	listed, err := gtc.ListAllCachedContexts(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return slices.SortedFunc(maps.Values(listed), func(a, b *genai.CachedContent) int {
+		return strings.Compare(a.Name, b.Name)
+	}), nil
+}
+
 // delete cached context
 func deleteCachedContext(
 	ctx context.Context,
@@ -178,6 +241,12 @@ func deleteCachedContext(
 
 	if err := gtc.DeleteCachedContext(ctx, cachedContextName); err != nil {
 		return 1, err
+	} else if p.outputAsJSON() {
+		return 0, printJSONResult(writer, struct {
+			Deleted string `json:"deleted"`
+		}{
+			Deleted: cachedContextName,
+		})
 	}
 
 	// success
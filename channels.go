@@ -0,0 +1,140 @@
+// channels.go
+//
+// Things for separating output channels of thoughts (`--thoughts-to`)
+// and metadata (`--metadata-to`) from the answer on stdout.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/jwalton/go-supportscolor"
+	"google.golang.org/genai"
+)
+
+const (
+	// target for writing thoughts to stderr
+	thoughtsToStderr = "stderr"
+)
+
+// prepare (create or truncate) files for separate output channels
+//
+// (NOTE: files are appended by each generation, including recursive ones)
+func prepareOutputChannels(p params) error {
+	fpaths := []string{}
+	if thoughtsTo := p.Generation.DetailedOptions.ThoughtsTo; thoughtsTo != nil && *thoughtsTo != thoughtsToStderr {
+		fpaths = append(fpaths, *thoughtsTo)
+	}
+	if p.Generation.MetadataTo != nil {
+		fpaths = append(fpaths, *p.Generation.MetadataTo)
+	}
+
+	for _, fpath := range fpaths {
+		fpath = expandPath(fpath)
+
+		if f, err := os.Create(fpath); err != nil {
+			return fmt.Errorf("failed to prepare output file '%s': %w", fpath, err)
+		} else {
+			_ = f.Close()
+		}
+	}
+
+	return nil
+}
+
+// writer for thoughts (`--thoughts-to`)
+type thoughtsWriter struct {
+	out     io.Writer
+	file    *os.File
+	colored bool
+
+	didEndWithNewline bool
+}
+
+// open a writer for thoughts with given target ('stderr' or a filepath)
+func openThoughtsWriter(target string) (*thoughtsWriter, error) {
+	if target == thoughtsToStderr {
+		return &thoughtsWriter{
+			out:               os.Stderr,
+			colored:           supportscolor.Stderr().SupportsColor,
+			didEndWithNewline: true,
+		}, nil
+	}
+
+	fpath := expandPath(target)
+	f, err := os.OpenFile(fpath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o640)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file for thoughts '%s': %w", fpath, err)
+	}
+
+	return &thoughtsWriter{
+		out:               f,
+		file:              f,
+		didEndWithNewline: true,
+	}, nil
+}
+
+// write given (partial) text of thoughts
+func (w *thoughtsWriter) write(text string) {
+	if w.colored {
+		_, _ = color.New(color.FgHiYellow).Fprint(w.out, text)
+	} else {
+		_, _ = fmt.Fprint(w.out, text)
+	}
+
+	w.didEndWithNewline = strings.HasSuffix(text, "\n")
+}
+
+// mark the end of thoughts (for separating them from the next ones)
+func (w *thoughtsWriter) end() {
+	if !w.didEndWithNewline {
+		w.write("\n")
+	}
+}
+
+// close the file of this writer (if any)
+func (w *thoughtsWriter) close() {
+	if w.file != nil {
+		_ = w.file.Close()
+	}
+}
+
+// metadata of a generation (`--metadata-to`)
+type generationMetadata struct {
+	Grounding    []*genai.GroundingMetadata                  `json:"grounding,omitempty"`
+	Citations    []*genai.CitationMetadata                   `json:"citations,omitempty"`
+	Usage        *genai.GenerateContentResponseUsageMetadata `json:"usage,omitempty"`
+	FinishReason genai.FinishReason                          `json:"finishReason,omitempty"`
+
+	SafetyRatings  []*genai.SafetyRating                        `json:"safetyRatings,omitempty"`
+	PromptFeedback *genai.GenerateContentResponsePromptFeedback `json:"promptFeedback,omitempty"`
+
+	Error string `json:"error,omitempty"` // NOTE: set when the generation failed before a finish reason
+}
+
+// append given metadata to the file at given path as a line of JSON
+func appendMetadata(fpath string, metadata generationMetadata) error {
+	fpath = expandPath(fpath)
+
+	marshalled, err := json.Marshal(metadata)
+	if err != nil {
+		return fmt.Errorf("failed to marshal metadata: %w", err)
+	}
+
+	f, err := os.OpenFile(fpath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o640)
+	if err != nil {
+		return fmt.Errorf("failed to open file for metadata '%s': %w", fpath, err)
+	}
+	defer func() { _ = f.Close() }()
+
+	if _, err := fmt.Fprintf(f, "%s\n", marshalled); err != nil {
+		return fmt.Errorf("failed to write metadata to '%s': %w", fpath, err)
+	}
+
+	return nil
+}
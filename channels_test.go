@@ -0,0 +1,108 @@
+// channels_test.go
+//
+// Things for testing `channels.go`.
+
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"google.golang.org/genai"
+)
+
+// test `thoughtsWriter` with a file
+func TestThoughtsWriter(t *testing.T) {
+	fpath := filepath.Join(t.TempDir(), "thoughts.txt")
+
+	// prepare (truncate) the file
+	if err := os.WriteFile(fpath, []byte("stale"), 0o640); err != nil {
+		t.Fatalf("failed to write file: %s", err)
+	}
+	p := params{}
+	p.Generation.DetailedOptions.ThoughtsTo = &fpath
+	if err := prepareOutputChannels(p); err != nil {
+		t.Fatalf("failed to prepare output channels: %s", err)
+	}
+
+	// thoughts from two generations
+	for _, chunks := range [][]string{
+		{"thinking ", "about it"},
+		{"more thoughts\n"},
+	} {
+		thoughts, err := openThoughtsWriter(fpath)
+		if err != nil {
+			t.Fatalf("failed to open thoughts writer: %s", err)
+		}
+		for _, chunk := range chunks {
+			thoughts.write(chunk)
+		}
+		thoughts.end()
+		thoughts.close()
+	}
+
+	if bytes, err := os.ReadFile(fpath); err != nil {
+		t.Errorf("failed to read file: %s", err)
+	} else if expected := "thinking about it\nmore thoughts\n"; string(bytes) != expected {
+		t.Errorf("expected '%s', got '%s'", expected, string(bytes))
+	}
+}
+
+// test `appendMetadata`
+func TestAppendMetadata(t *testing.T) {
+	fpath := filepath.Join(t.TempDir(), "metadata.jsonl")
+
+	p := params{}
+	p.Generation.MetadataTo = &fpath
+	if err := prepareOutputChannels(p); err != nil {
+		t.Fatalf("failed to prepare output channels: %s", err)
+	}
+
+	metadata := []generationMetadata{
+		{
+			FinishReason: genai.FinishReasonStop,
+			Usage: &genai.GenerateContentResponseUsageMetadata{
+				TotalTokenCount: 42,
+			},
+		},
+		{
+			Citations: []*genai.CitationMetadata{
+				{Citations: []*genai.Citation{{URI: "https://example.com"}}},
+			},
+			FinishReason: genai.FinishReasonMaxTokens,
+		},
+		{
+			Usage: &genai.GenerateContentResponseUsageMetadata{
+				TotalTokenCount: 7,
+			},
+			Error: "stream closed",
+		},
+	}
+	for _, m := range metadata {
+		if err := appendMetadata(fpath, m); err != nil {
+			t.Fatalf("failed to append metadata: %s", err)
+		}
+	}
+
+	bytes, err := os.ReadFile(fpath)
+	if err != nil {
+		t.Fatalf("failed to read file: %s", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(bytes)), "\n")
+	if len(lines) != len(metadata) {
+		t.Fatalf("expected %d lines, got %d", len(metadata), len(lines))
+	}
+	for i, line := range lines {
+		var read generationMetadata
+		if err := json.Unmarshal([]byte(line), &read); err != nil {
+			t.Errorf("failed to unmarshal line '%s': %s", line, err)
+		} else if read.FinishReason != metadata[i].FinishReason {
+			t.Errorf("expected finish reason '%s', got '%s'", metadata[i].FinishReason, read.FinishReason)
+		} else if read.Error != metadata[i].Error {
+			t.Errorf("expected error '%s', got '%s'", metadata[i].Error, read.Error)
+		}
+	}
+}
@@ -0,0 +1,244 @@
+// citations.go
+//
+// Things for rendering grounding sources as inline citations and references (`--citations`).
+
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"google.golang.org/genai"
+)
+
+const (
+	// format of google maps links for places without uris
+	googleMapsPlaceURLFormat = `https://www.google.com/maps/place/?q=place_id:%s`
+)
+
+// a source of citations
+type citationSource struct {
+	kind  string // 'web', 'maps', 'file search', 'image', or 'citation'
+	title string
+	uri   string
+}
+
+// a citation marker to be inserted into the text
+type citationMarker struct {
+	start, end int    // (byte offsets in the text)
+	text       string // text of the segment (for locating the segment when offsets do not match)
+	numbers    []int  // (1-based numbers of sources)
+}
+
+// citations collected from grounding and citation metadata
+type citations struct {
+	sources  []citationSource
+	numberOf map[string]int // (key of source => number)
+	markers  []citationMarker
+}
+
+// generate new citations
+func newCitations() *citations {
+	return &citations{
+		numberOf: map[string]int{},
+	}
+}
+
+// check if there is no source
+func (c *citations) empty() bool {
+	return len(c.sources) == 0
+}
+
+// register given source and return its number
+//
+// (sources with the same uri, or title when there is no uri, share a number)
+func (c *citations) register(source citationSource) int {
+	key := source.uri
+	if key == "" {
+		key = source.kind + ":" + source.title
+	}
+	if number, exists := c.numberOf[key]; exists {
+		return number
+	}
+
+	c.sources = append(c.sources, source)
+	c.numberOf[key] = len(c.sources)
+
+	return len(c.sources)
+}
+
+// add sources and supports of given grounding metadata
+func (c *citations) addGrounding(metadata *genai.GroundingMetadata) {
+	if metadata == nil {
+		return
+	}
+
+	// sources (index of chunk => number)
+	numbers := make([]int, len(metadata.GroundingChunks))
+	for i, chunk := range metadata.GroundingChunks {
+		if source, ok := sourceFromGroundingChunk(chunk); ok {
+			numbers[i] = c.register(source)
+		}
+	}
+
+	// supports
+	for _, support := range metadata.GroundingSupports {
+		if support == nil || support.Segment == nil {
+			continue
+		}
+
+		marker := citationMarker{
+			start: int(support.Segment.StartIndex),
+			end:   int(support.Segment.EndIndex),
+			text:  support.Segment.Text,
+		}
+		for _, index := range support.GroundingChunkIndices {
+			if int(index) < len(numbers) && numbers[index] > 0 {
+				marker.numbers = append(marker.numbers, numbers[index])
+			}
+		}
+		if len(marker.numbers) > 0 {
+			c.markers = append(c.markers, marker)
+		}
+	}
+}
+
+// add sources of given citation metadata
+func (c *citations) addCitations(metadata *genai.CitationMetadata) {
+	if metadata == nil {
+		return
+	}
+
+	for _, citation := range metadata.Citations {
+		if citation == nil || (citation.URI == "" && citation.Title == "") {
+			continue
+		}
+
+		number := c.register(citationSource{
+			kind:  "citation",
+			title: citation.Title,
+			uri:   citation.URI,
+		})
+		c.markers = append(c.markers, citationMarker{
+			start:   int(citation.StartIndex),
+			end:     int(citation.EndIndex),
+			numbers: []int{number},
+		})
+	}
+}
+
+// return a citation source from given grounding chunk
+func sourceFromGroundingChunk(chunk *genai.GroundingChunk) (citationSource, bool) {
+	switch {
+	case chunk == nil:
+		return citationSource{}, false
+	case chunk.Web != nil:
+		title := chunk.Web.Title
+		if title == "" {
+			title = chunk.Web.Domain
+		}
+		return citationSource{kind: "web", title: title, uri: chunk.Web.URI}, true
+	case chunk.Maps != nil:
+		uri := chunk.Maps.URI
+		if uri == "" && chunk.Maps.PlaceID != "" {
+			uri = fmt.Sprintf(googleMapsPlaceURLFormat, chunk.Maps.PlaceID)
+		}
+		return citationSource{kind: "maps", title: chunk.Maps.Title, uri: uri}, true
+	case chunk.RetrievedContext != nil:
+		title := chunk.RetrievedContext.Title
+		if title == "" {
+			title = chunk.RetrievedContext.DocumentName
+		}
+		return citationSource{kind: "file search", title: title, uri: chunk.RetrievedContext.URI}, true
+	case chunk.Image != nil:
+		return citationSource{kind: "image", title: chunk.Image.Title, uri: chunk.Image.SourceURI}, true
+	}
+	return citationSource{}, false
+}
+
+// insert citation markers (eg. `[1][3]`) into given text
+//
+// (markers are placed at the ends of their segments; segments whose offsets do not match
+// the text are located with their texts, and the others are dropped)
+//
+// (NOTE: inserted markers are consumed, so they are not inserted again into following texts)
+func (c *citations) annotate(text string) string {
+	// offset => numbers
+	numbersAt := map[int][]int{}
+	for _, marker := range c.markers {
+		offset := -1
+		if marker.end > marker.start && marker.end <= len(text) &&
+			(marker.text == "" || text[marker.start:marker.end] == marker.text) {
+			offset = marker.end
+		} else if marker.text != "" {
+			if index := strings.Index(text, marker.text); index >= 0 {
+				offset = index + len(marker.text)
+			}
+		}
+		if offset < 0 {
+			continue
+		}
+
+		// NOTE: do not split a multi-byte character
+		for offset < len(text) && !utf8.RuneStart(text[offset]) {
+			offset++
+		}
+
+		numbersAt[offset] = append(numbersAt[offset], marker.numbers...)
+	}
+
+	offsets := []int{}
+	for offset := range numbersAt {
+		offsets = append(offsets, offset)
+	}
+	slices.Sort(offsets)
+
+	var sb strings.Builder
+	last := 0
+	for _, offset := range offsets {
+		sb.WriteString(text[last:offset])
+
+		numbers := numbersAt[offset]
+		slices.Sort(numbers)
+		for _, number := range slices.Compact(numbers) {
+			fmt.Fprintf(&sb, "[%d]", number)
+		}
+
+		last = offset
+	}
+	sb.WriteString(text[last:])
+
+	c.markers = nil
+
+	return sb.String()
+}
+
+// return the list of references
+func (c *citations) references() string {
+	if c.empty() {
+		return ""
+	}
+
+	var sb strings.Builder
+	sb.WriteString("References:\n")
+	for i, source := range c.sources {
+		fmt.Fprintf(&sb, "[%d] ", i+1)
+
+		switch {
+		case source.title != "" && source.uri != "":
+			fmt.Fprintf(&sb, "%s - %s", source.title, source.uri)
+		case source.uri != "":
+			sb.WriteString(source.uri)
+		default:
+			sb.WriteString(source.title)
+		}
+		if source.kind != "web" {
+			fmt.Fprintf(&sb, " (%s)", source.kind)
+		}
+		sb.WriteString("\n")
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,137 @@
+// citations_test.go
+//
+// Things for testing `citations.go`.
+
+package main
+
+import (
+	"testing"
+
+	"google.golang.org/genai"
+)
+
+// test `citations` with grounding and citation metadata
+func TestCitations(t *testing.T) {
+	type test struct {
+		text               string
+		grounding          *genai.GroundingMetadata
+		citation           *genai.CitationMetadata
+		expectedAnnotated  string
+		expectedReferences string
+	}
+
+	tests := []test{
+		{ // web sources with matching offsets, and a duplicated uri
+			text: "Seoul is the capital. It is large.",
+			grounding: &genai.GroundingMetadata{
+				GroundingChunks: []*genai.GroundingChunk{
+					{Web: &genai.GroundingChunkWeb{Title: "Wiki", URI: "https://a.example"}},
+					{Web: &genai.GroundingChunkWeb{Domain: "b.example", URI: "https://b.example"}},
+					{Web: &genai.GroundingChunkWeb{Title: "Wiki again", URI: "https://a.example"}},
+				},
+				GroundingSupports: []*genai.GroundingSupport{
+					{
+						Segment:               &genai.Segment{StartIndex: 0, EndIndex: 21, Text: "Seoul is the capital."},
+						GroundingChunkIndices: []int32{1, 0},
+					},
+					{
+						Segment:               &genai.Segment{StartIndex: 22, EndIndex: 34, Text: "It is large."},
+						GroundingChunkIndices: []int32{2},
+					},
+				},
+			},
+			expectedAnnotated: "Seoul is the capital.[1][2] It is large.[1]",
+			expectedReferences: `References:
+[1] Wiki - https://a.example
+[2] b.example - https://b.example
+`,
+		},
+		{ // maps and file search sources, with mismatching offsets
+			text: "안녕 café is nice.\nBring a book.",
+			grounding: &genai.GroundingMetadata{
+				GroundingChunks: []*genai.GroundingChunk{
+					{Maps: &genai.GroundingChunkMaps{Title: "Café", PlaceID: "abc"}},
+					{RetrievedContext: &genai.GroundingChunkRetrievedContext{DocumentName: "guide.pdf"}},
+				},
+				GroundingSupports: []*genai.GroundingSupport{
+					{
+						Segment:               &genai.Segment{StartIndex: 100, EndIndex: 120, Text: "café is nice."},
+						GroundingChunkIndices: []int32{0},
+					},
+					{
+						Segment:               &genai.Segment{Text: "not in the text"},
+						GroundingChunkIndices: []int32{1},
+					},
+				},
+			},
+			citation: &genai.CitationMetadata{
+				Citations: []*genai.Citation{
+					{StartIndex: 22, EndIndex: 35, URI: "https://c.example"},
+				},
+			},
+			expectedAnnotated: "안녕 café is nice.[1]\nBring a book.[3]",
+			expectedReferences: `References:
+[1] Café - https://www.google.com/maps/place/?q=place_id:abc (maps)
+[2] guide.pdf (file search)
+[3] https://c.example (citation)
+`,
+		},
+	}
+
+	for _, test := range tests {
+		c := newCitations()
+		c.addGrounding(test.grounding)
+		c.addCitations(test.citation)
+
+		if annotated := c.annotate(test.text); annotated != test.expectedAnnotated {
+			t.Errorf("expected annotated '%s', got '%s'", test.expectedAnnotated, annotated)
+		}
+		if references := c.references(); references != test.expectedReferences {
+			t.Errorf("expected references '%s', got '%s'", test.expectedReferences, references)
+		}
+		if annotated := c.annotate(test.text); annotated != test.text {
+			t.Errorf("expected markers to be consumed, got '%s'", annotated)
+		}
+	}
+}
+
+// test `citations` shared by rounds of continued generations
+func TestCitationsAcrossRounds(t *testing.T) {
+	c := newCitations()
+
+	// first round
+	c.addGrounding(&genai.GroundingMetadata{
+		GroundingChunks: []*genai.GroundingChunk{
+			{Web: &genai.GroundingChunkWeb{Title: "A", URI: "https://a.example"}},
+		},
+		GroundingSupports: []*genai.GroundingSupport{
+			{Segment: &genai.Segment{StartIndex: 0, EndIndex: 6, Text: "First."}, GroundingChunkIndices: []int32{0}},
+		},
+	})
+	if annotated := c.annotate("First."); annotated != "First.[1]" {
+		t.Errorf("expected 'First.[1]', got '%s'", annotated)
+	}
+
+	// second round (offsets are relative to the text of this round)
+	c.addGrounding(&genai.GroundingMetadata{
+		GroundingChunks: []*genai.GroundingChunk{
+			{Web: &genai.GroundingChunkWeb{Title: "B", URI: "https://b.example"}},
+			{Web: &genai.GroundingChunkWeb{Title: "A", URI: "https://a.example"}},
+		},
+		GroundingSupports: []*genai.GroundingSupport{
+			{Segment: &genai.Segment{StartIndex: 0, EndIndex: 7, Text: "Second."}, GroundingChunkIndices: []int32{0, 1}},
+		},
+	})
+	if annotated := c.annotate("Second."); annotated != "Second.[1][2]" {
+		t.Errorf("expected 'Second.[1][2]', got '%s'", annotated)
+	}
+
+	// references of all rounds
+	expected := `References:
+[1] A - https://a.example
+[2] B - https://b.example
+`
+	if references := c.references(); references != expected {
+		t.Errorf("expected references '%s', got '%s'", expected, references)
+	}
+}
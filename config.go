@@ -65,8 +65,14 @@ Respond to user messages according to the following principles:
 	defaultEmbeddingsChunkOverlappedSize uint = 64
 
 	// other default parameters or constants
-	defaultTimeoutSeconds                  = 5 * 60 // 5 minutes
-	defaultFetchURLTimeoutSeconds          = 10     // 10 seconds
+	defaultTimeoutSeconds                  = 5 * 60          // 5 minutes
+	defaultFetchURLTimeoutSeconds          = 10              // 10 seconds
+	defaultMaxToolResultBytes              = 64 * 1024       // 64KB
+	defaultMaxToolResultMediaBytes         = 4 * 1024 * 1024 // 4MB
+	defaultSelfInlineMediaMaxBytes         = 1024 * 1024     // 1MB
+	defaultRetryDelaySeconds               = 1               // 1 second
+	defaultRetryMaxDelaySeconds            = 60              // 1 minute
+	defaultAPIKeyCooldownSeconds           = 60              // 1 minute
 	defaultFetchUserAgent           string = `gmn/fetcher`
 	defaultLocation                 string = `global`           // location for Google Cloud Platform
 	defaultBucketNameForFileUploads string = `gmn-file-uploads` // Google Cloud Storage bucket name
@@ -77,7 +83,12 @@ type config struct {
 	// (1) gemini api key in plain text
 	GoogleAIAPIKey *string `json:"google_ai_api_key,omitempty"`
 
-	// (2) or, gemini api key in infisical
+	// (1-1) or, multiple gemini api keys, rotated when their quotas are exhausted
+	GoogleAIAPIKeys       []string `json:"google_ai_api_keys,omitempty"`
+	APIKeySelection       *string  `json:"api_key_selection,omitempty"` // 'failover' (default) or 'round-robin'
+	APIKeyCooldownSeconds int      `json:"api_key_cooldown_seconds,omitempty"`
+
+	// (2) or, gemini api key(s) in infisical
 	Infisical *infisicalSetting `json:"infisical,omitempty"`
 
 	// (3) or, google credentials file path
@@ -95,6 +106,52 @@ type config struct {
 	TimeoutSeconds int `json:"timeout_seconds,omitempty"`
 
 	ReplaceHTTPURLTimeoutSeconds int `json:"replace_http_url_timeout_seconds,omitempty"`
+
+	// safety thresholds for harm categories (category => threshold, overridden by params)
+	SafetySettings map[string]string `json:"safety_settings,omitempty"`
+
+	// retries on transient errors, and models to fall back to (overridden by params)
+	Retries              int      `json:"retries,omitempty"`
+	RetryDelaySeconds    float64  `json:"retry_delay_seconds,omitempty"`
+	RetryMaxDelaySeconds float64  `json:"retry_max_delay_seconds,omitempty"`
+	FallbackModels       []string `json:"fallback_models,omitempty"`
+
+	// render generated markdown texts on terminals (overridden by params)
+	RenderMarkdown bool `json:"render_markdown,omitempty"`
+
+	// policy for outgoing http requests (fetching urls, `gmn_do_http`, ...)
+	EgressPolicy *egressPolicy `json:"egress_policy,omitempty"`
+
+	// tools to be exposed from the self MCP server (overridden by params)
+	MCPSelfTools        []string `json:"mcp_self_tools,omitempty"`
+	MCPSelfExcludeTools []string `json:"mcp_self_exclude_tools,omitempty"`
+	MCPSelfReadOnly     bool     `json:"mcp_self_read_only,omitempty"`
+
+	// directory of prompt templates (overridden by params)
+	MCPPromptsDirectory *string `json:"mcp_prompts_dir,omitempty"`
+
+	// local stdio MCP servers, selected by their names with `--mcp-stdio-server`
+	MCPStdioServers map[string]mcpStdioServerConfig `json:"mcp_stdio_servers,omitempty"`
+
+	// directory for stderr log files of local stdio MCP servers (overridden by params)
+	MCPStdioStderrDirectory *string `json:"mcp_stdio_stderr_dir,omitempty"`
+
+	// directories of skills (overridden by params)
+	SkillsDirectories []string `json:"skills_dirs,omitempty"`
+
+	// (ring of multiple api keys, selected from `google_ai_api_keys`)
+	apiKeys *apiKeyRing
+}
+
+// return the egress policy of this config (filled with default values)
+func (c config) egressPolicy() *egressPolicy {
+	policy := egressPolicy{}
+	if c.EgressPolicy != nil {
+		policy = *c.EgressPolicy
+	}
+	policy.fillDefaults()
+
+	return &policy
 }
 
 // infisical setting struct
@@ -106,7 +163,8 @@ type infisicalSetting struct {
 	Environment string `json:"environment"`
 	SecretType  string `json:"secret_type"`
 
-	GoogleAIAPIKeyKeyPath string `json:"google_ai_api_key_key_path"`
+	GoogleAIAPIKeyKeyPath  string   `json:"google_ai_api_key_key_path"`
+	GoogleAIAPIKeyKeyPaths []string `json:"google_ai_api_key_key_paths,omitempty"` // (for multiple api keys)
 }
 
 // read config from given filepath
@@ -129,7 +187,7 @@ func readConfig(
 					conf.ReplaceHTTPURLTimeoutSeconds = defaultFetchURLTimeoutSeconds
 				}
 
-				if conf.GoogleAIAPIKey == nil && conf.Infisical != nil {
+				if conf.GoogleAIAPIKey == nil && len(conf.GoogleAIAPIKeys) == 0 && conf.Infisical != nil {
 					ctx, cancel := context.WithTimeout(context.Background(), defaultConfigTimeoutSeconds*time.Second)
 					defer cancel()
 
@@ -191,22 +249,30 @@ func fetchConfFromInfisical(
 		return config{}, err
 	}
 
-	var keyPath string
 	var secret models.Secret
 
-	// google ai api key
-	keyPath = conf.Infisical.GoogleAIAPIKeyKeyPath
-	secret, err = client.Secrets().Retrieve(infisical.RetrieveSecretOptions{
-		ProjectID:   conf.Infisical.ProjectID,
-		Type:        conf.Infisical.SecretType,
-		Environment: conf.Infisical.Environment,
-		SecretPath:  path.Dir(keyPath),
-		SecretKey:   path.Base(keyPath),
-	})
-	if err != nil {
-		return config{}, err
+	// google ai api key(s)
+	for i, keyPath := range append([]string{conf.Infisical.GoogleAIAPIKeyKeyPath}, conf.Infisical.GoogleAIAPIKeyKeyPaths...) {
+		if keyPath == "" {
+			continue
+		}
+
+		secret, err = client.Secrets().Retrieve(infisical.RetrieveSecretOptions{
+			ProjectID:   conf.Infisical.ProjectID,
+			Type:        conf.Infisical.SecretType,
+			Environment: conf.Infisical.Environment,
+			SecretPath:  path.Dir(keyPath),
+			SecretKey:   path.Base(keyPath),
+		})
+		if err != nil {
+			return config{}, err
+		}
+		if i == 0 {
+			conf.GoogleAIAPIKey = new(secret.SecretValue)
+		} else {
+			conf.GoogleAIAPIKeys = append(conf.GoogleAIAPIKeys, secret.SecretValue)
+		}
 	}
-	conf.GoogleAIAPIKey = new(secret.SecretValue)
 
 	return conf, nil
 }
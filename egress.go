@@ -0,0 +1,281 @@
+// egress.go
+//
+// Things for restricting outgoing network requests.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultEgressMaxResponseBodyBytes int64 = 10 * 1024 * 1024 // 10MB
+	defaultEgressMaxRedirects               = 5
+)
+
+// errors for egress policy violations
+var (
+	errEgressDenied           = errors.New("denied by egress policy")
+	errEgressTooManyRedirects = errors.New("too many redirects")
+	errEgressBodyTooLarge     = errors.New("response body too large")
+)
+
+// egress policy for outgoing http requests
+//
+// NOTE: deny rules always take precedence over allow rules
+type egressPolicy struct {
+	// hosts (eg. 'example.com', or '*.example.com' for subdomains) and CIDRs (eg. '10.0.0.0/8')
+	AllowedHosts []string `json:"allowed_hosts,omitempty"`
+	DeniedHosts  []string `json:"denied_hosts,omitempty"`
+	AllowedCIDRs []string `json:"allowed_cidrs,omitempty"`
+	DeniedCIDRs  []string `json:"denied_cidrs,omitempty"`
+
+	// allow requests initiated by the model to reach private, loopback, and link-local addresses
+	AllowPrivateNetworks bool `json:"allow_private_networks,omitempty"`
+
+	MaxResponseBodyBytes int64 `json:"max_response_body_bytes,omitempty"`
+	MaxRedirects         int   `json:"max_redirects,omitempty"`
+}
+
+// fill default values of egress policy
+func (e *egressPolicy) fillDefaults() {
+	if e.MaxResponseBodyBytes <= 0 {
+		e.MaxResponseBodyBytes = defaultEgressMaxResponseBodyBytes
+	}
+	if e.MaxRedirects <= 0 {
+		e.MaxRedirects = defaultEgressMaxRedirects
+	}
+}
+
+// check if given host matches any of the host patterns
+func hostMatches(host string, patterns []string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(strings.TrimSuffix(pattern, "."))
+
+		if suffix, isWildcard := strings.CutPrefix(pattern, "*."); isWildcard {
+			if host == suffix || strings.HasSuffix(host, "."+suffix) {
+				return true
+			}
+		} else if host == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// check if given ip is in any of the CIDRs
+func ipInCIDRs(ip netip.Addr, cidrs []string) bool {
+	ip = ip.Unmap()
+
+	for _, cidr := range cidrs {
+		if prefix, err := netip.ParsePrefix(cidr); err == nil {
+			if prefix.Contains(ip) {
+				return true
+			}
+		} else if addr, err := netip.ParseAddr(cidr); err == nil { // single address
+			if addr.Unmap() == ip {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// for getting proxies from environment variables (replaced in tests)
+var _proxyFromEnvironment = http.ProxyFromEnvironment
+
+// carrier-grade NAT range, which is not covered by `netip.Addr.IsPrivate`
+var _sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// check if given ip is in a private, loopback, link-local, or unspecified range
+func isInternalIP(ip netip.Addr) bool {
+	ip = ip.Unmap()
+
+	return ip.IsPrivate() ||
+		ip.IsLoopback() ||
+		ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() ||
+		ip.IsUnspecified() ||
+		_sharedAddressSpace.Contains(ip)
+}
+
+// check if given host is permitted by the host rules
+func (e *egressPolicy) checkHost(host string) error {
+	if hostMatches(host, e.DeniedHosts) {
+		return fmt.Errorf("host '%s' %w (denied host)", host, errEgressDenied)
+	}
+
+	// host given as an ip address will be checked with CIDRs later
+	if _, err := netip.ParseAddr(host); err == nil {
+		return nil
+	}
+
+	if len(e.AllowedHosts) > 0 &&
+		!hostMatches(host, e.AllowedHosts) &&
+		len(e.AllowedCIDRs) == 0 {
+		return fmt.Errorf("host '%s' %w (not in allowed hosts)", host, errEgressDenied)
+	}
+	return nil
+}
+
+// check if given resolved ip of `host` is permitted
+func (e *egressPolicy) checkIP(host string, ip netip.Addr, modelInitiated bool) error {
+	if ipInCIDRs(ip, e.DeniedCIDRs) {
+		return fmt.Errorf("address %s of '%s' %w (denied CIDR)", ip, host, errEgressDenied)
+	}
+
+	explicitlyAllowed := ipInCIDRs(ip, e.AllowedCIDRs) || hostMatches(host, e.AllowedHosts)
+
+	if (len(e.AllowedHosts) > 0 || len(e.AllowedCIDRs) > 0) && !explicitlyAllowed {
+		return fmt.Errorf("address %s of '%s' %w (not in allowed hosts or CIDRs)", ip, host, errEgressDenied)
+	}
+
+	if modelInitiated &&
+		!e.AllowPrivateNetworks &&
+		!explicitlyAllowed &&
+		isInternalIP(ip) {
+		return fmt.Errorf("address %s of '%s' %w (private or link-local address)", ip, host, errEgressDenied)
+	}
+
+	return nil
+}
+
+// generate a dial function which checks hosts and resolved addresses before connecting
+//
+// (addresses of proxies in `proxies` are connected to without the checks)
+func (e *egressPolicy) dialContext(
+	dialer *net.Dialer,
+	modelInitiated bool,
+	proxies *sync.Map,
+) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if _, isProxy := proxies.Load(addr); isProxy {
+			return dialer.DialContext(ctx, network, addr)
+		}
+
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := e.checkHost(host); err != nil {
+			return nil, err
+		}
+
+		// resolve addresses here, so that the checked address is the one being connected to
+		var ips []netip.Addr
+		if ip, err := netip.ParseAddr(host); err == nil {
+			ips = []netip.Addr{ip}
+		} else {
+			if ips, err = net.DefaultResolver.LookupNetIP(ctx, "ip", host); err != nil {
+				return nil, err
+			}
+		}
+
+		var lastErr error = fmt.Errorf("no address found for '%s'", host)
+		for _, ip := range ips {
+			if err := e.checkIP(host, ip, modelInitiated); err != nil {
+				lastErr = err
+				continue
+			}
+
+			conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ip.Unmap().String(), port))
+			if err == nil {
+				return conn, nil
+			}
+			lastErr = err
+		}
+		return nil, lastErr
+	}
+}
+
+// generate a http client which follows this egress policy
+//
+// NOTE: proxies from environment variables are used only for requests initiated by the user,
+// as they would bypass the address checks (hosts of the requests are still checked before being proxied)
+func (e *egressPolicy) httpClient(
+	timeout time.Duration,
+	modelInitiated bool,
+) *http.Client {
+	maxRedirects := e.MaxRedirects
+
+	proxies := &sync.Map{} // (addresses of proxies being used)
+	var proxy func(*http.Request) (*url.URL, error)
+	if !modelInitiated {
+		proxy = func(req *http.Request) (*url.URL, error) {
+			proxyURL, err := _proxyFromEnvironment(req)
+			if err != nil || proxyURL == nil {
+				return proxyURL, err
+			}
+			if err := e.checkHost(req.URL.Hostname()); err != nil {
+				return nil, err
+			}
+			proxies.Store(proxyAddr(proxyURL), struct{}{})
+			return proxyURL, nil
+		}
+	}
+
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			Proxy: proxy,
+			DialContext: e.dialContext(
+				&net.Dialer{
+					Timeout:   timeout,
+					KeepAlive: 30 * time.Second,
+				},
+				modelInitiated,
+				proxies,
+			),
+			ForceAttemptHTTP2:   true,
+			TLSHandshakeTimeout: timeout,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > maxRedirects {
+				return fmt.Errorf("%w (max: %d)", errEgressTooManyRedirects, maxRedirects)
+			}
+			return nil
+		},
+	}
+}
+
+// return the address (host:port) of given proxy url, which will be dialed
+func proxyAddr(proxyURL *url.URL) string {
+	port := proxyURL.Port()
+	if port == "" {
+		switch proxyURL.Scheme {
+		case "https":
+			port = "443"
+		case "socks5", "socks5h":
+			port = "1080"
+		default:
+			port = "80"
+		}
+	}
+	return net.JoinHostPort(proxyURL.Hostname(), port)
+}
+
+// read all bytes from given reader, but fail if it exceeds the maximum size of this egress policy
+func (e *egressPolicy) readBody(r io.Reader) ([]byte, error) {
+	bytes, err := io.ReadAll(io.LimitReader(r, e.MaxResponseBodyBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(bytes)) > e.MaxResponseBodyBytes {
+		return bytes[:e.MaxResponseBodyBytes], fmt.Errorf("%w (max: %d bytes)", errEgressBodyTooLarge, e.MaxResponseBodyBytes)
+	}
+	return bytes, nil
+}
@@ -0,0 +1,207 @@
+// egress_test.go
+//
+// Things for testing `egress.go`.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// test `hostMatches` with exact and wildcard patterns
+func TestHostMatches(t *testing.T) {
+	type test struct {
+		host     string
+		patterns []string
+		matched  bool
+	}
+
+	tests := []test{
+		{host: "example.com", patterns: []string{"example.com"}, matched: true},
+		{host: "EXAMPLE.com.", patterns: []string{"example.com"}, matched: true},
+		{host: "api.example.com", patterns: []string{"example.com"}, matched: false},
+		{host: "api.example.com", patterns: []string{"*.example.com"}, matched: true},
+		{host: "example.com", patterns: []string{"*.example.com"}, matched: true},
+		{host: "badexample.com", patterns: []string{"*.example.com"}, matched: false},
+		{host: "example.com", patterns: nil, matched: false},
+	}
+
+	for _, test := range tests {
+		if matched := hostMatches(test.host, test.patterns); matched != test.matched {
+			t.Errorf("host '%s' with patterns %v: expected %v, got %v", test.host, test.patterns, test.matched, matched)
+		}
+	}
+}
+
+// test `isInternalIP` with various addresses
+func TestIsInternalIP(t *testing.T) {
+	tests := map[string]bool{
+		"127.0.0.1":       true,
+		"10.1.2.3":        true,
+		"172.16.0.1":      true,
+		"192.168.0.1":     true,
+		"169.254.169.254": true, // cloud metadata endpoint
+		"100.64.0.1":      true,
+		"0.0.0.0":         true,
+		"::1":             true,
+		"fe80::1":         true,
+		"fd00::1":         true,
+		"::ffff:10.0.0.1": true,
+		"8.8.8.8":         false,
+		"2001:4860::8888": false,
+	}
+
+	for addr, internal := range tests {
+		if got := isInternalIP(netip.MustParseAddr(addr)); got != internal {
+			t.Errorf("address %s: expected %v, got %v", addr, internal, got)
+		}
+	}
+}
+
+// test egress policy with a local test server
+func TestEgressPolicyHTTPClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/large":
+			_, _ = fmt.Fprint(w, strings.Repeat("a", 1024))
+		case "/redirect":
+			n := 0
+			_, _ = fmt.Sscanf(r.URL.Query().Get("n"), "%d", &n)
+			if n > 0 {
+				http.Redirect(w, r, fmt.Sprintf("/redirect?n=%d", n-1), http.StatusFound)
+				return
+			}
+			_, _ = fmt.Fprint(w, "done")
+		default:
+			_, _ = fmt.Fprint(w, "ok")
+		}
+	}))
+	defer server.Close()
+
+	get := func(policy *egressPolicy, modelInitiated bool, path string) ([]byte, error) {
+		policy.fillDefaults()
+
+		resp, err := policy.httpClient(5*time.Second, modelInitiated).Get(server.URL + path)
+		if err != nil {
+			return nil, err
+		}
+		defer func() { _ = resp.Body.Close() }()
+
+		return policy.readBody(resp.Body)
+	}
+
+	// requests from the user are not restricted by default
+	if _, err := get(&egressPolicy{}, false, "/"); err != nil {
+		t.Errorf("expected user-initiated request to succeed, got: %s", err)
+	}
+
+	// requests from the model to loopback addresses are blocked by default
+	if _, err := get(&egressPolicy{}, true, "/"); !errors.Is(err, errEgressDenied) {
+		t.Errorf("expected model-initiated request to be denied, got: %v", err)
+	}
+
+	// unless they are explicitly allowed
+	if _, err := get(&egressPolicy{AllowedCIDRs: []string{"127.0.0.0/8"}}, true, "/"); err != nil {
+		t.Errorf("expected explicitly allowed request to succeed, got: %s", err)
+	}
+	if _, err := get(&egressPolicy{AllowPrivateNetworks: true}, true, "/"); err != nil {
+		t.Errorf("expected request with private networks allowed to succeed, got: %s", err)
+	}
+
+	// denied CIDRs always take precedence
+	if _, err := get(&egressPolicy{AllowPrivateNetworks: true, DeniedCIDRs: []string{"127.0.0.1"}}, false, "/"); !errors.Is(err, errEgressDenied) {
+		t.Errorf("expected request to denied CIDR to fail, got: %v", err)
+	}
+
+	// hosts not in the allowed list are denied
+	if _, err := get(&egressPolicy{AllowedHosts: []string{"example.com"}}, false, "/"); !errors.Is(err, errEgressDenied) {
+		t.Errorf("expected request to host not in allowed list to fail, got: %v", err)
+	}
+
+	// response body size is limited
+	if body, err := get(&egressPolicy{MaxResponseBodyBytes: 100}, false, "/large"); !errors.Is(err, errEgressBodyTooLarge) {
+		t.Errorf("expected too large body to fail, got: %v", err)
+	} else if len(body) != 100 {
+		t.Errorf("expected truncated body of 100 bytes, got %d bytes", len(body))
+	}
+
+	// redirects are limited
+	if body, err := get(&egressPolicy{MaxRedirects: 3}, false, "/redirect?n=3"); err != nil || string(body) != "done" {
+		t.Errorf("expected 3 redirects to succeed, got: %q, %v", body, err)
+	}
+	if _, err := get(&egressPolicy{MaxRedirects: 3}, false, "/redirect?n=4"); !errors.Is(err, errEgressTooManyRedirects) {
+		t.Errorf("expected 4 redirects to fail, got: %v", err)
+	}
+}
+
+// test that proxies from environment variables are used only for user-initiated requests
+func TestEgressPolicyProxy(t *testing.T) {
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, "proxied: %s", r.URL.Host)
+	}))
+	defer proxy.Close()
+	proxyURL, _ := url.Parse(proxy.URL)
+
+	original := _proxyFromEnvironment
+	_proxyFromEnvironment = func(*http.Request) (*url.URL, error) {
+		return proxyURL, nil
+	}
+	defer func() { _proxyFromEnvironment = original }()
+
+	get := func(policy *egressPolicy, modelInitiated bool, target string) ([]byte, error) {
+		policy.fillDefaults()
+
+		resp, err := policy.httpClient(5*time.Second, modelInitiated).Get(target)
+		if err != nil {
+			return nil, err
+		}
+		defer func() { _ = resp.Body.Close() }()
+
+		return policy.readBody(resp.Body)
+	}
+
+	// requests from the user are proxied (the proxy itself is not checked)
+	if body, err := get(&egressPolicy{AllowedHosts: []string{"example.com"}}, false, "http://example.com/"); err != nil || string(body) != "proxied: example.com" {
+		t.Errorf("expected user-initiated request to be proxied, got: %q, %v", body, err)
+	}
+
+	// hosts of proxied requests are still checked
+	if _, err := get(&egressPolicy{DeniedHosts: []string{"example.com"}}, false, "http://example.com/"); !errors.Is(err, errEgressDenied) {
+		t.Errorf("expected proxied request to denied host to fail, got: %v", err)
+	}
+
+	// requests from the model are not proxied
+	if _, err := get(&egressPolicy{}, true, proxy.URL); !errors.Is(err, errEgressDenied) {
+		t.Errorf("expected model-initiated request not to be proxied, got: %v", err)
+	}
+}
+
+// test `proxyAddr` with various proxy urls
+func TestProxyAddr(t *testing.T) {
+	type test struct {
+		proxyURL string
+		expected string
+	}
+
+	tests := []test{
+		{proxyURL: "http://proxy.example.com:3128", expected: "proxy.example.com:3128"},
+		{proxyURL: "http://proxy.example.com", expected: "proxy.example.com:80"},
+		{proxyURL: "https://proxy.example.com", expected: "proxy.example.com:443"},
+		{proxyURL: "socks5://[::1]", expected: "[::1]:1080"},
+	}
+
+	for _, test := range tests {
+		u, _ := url.Parse(test.proxyURL)
+		if actual := proxyAddr(u); actual != test.expected {
+			t.Errorf("expected '%s' for '%s', got '%s'", test.expected, test.proxyURL, actual)
+		}
+	}
+}
@@ -61,11 +61,53 @@ func doEmbeddingsGeneration(
 		return 1, fmt.Errorf("prompt or files required for embeddings generation")
 	}
 
-	taskType := p.Embeddings.EmbeddingsTaskType
-	chunkSize := p.Embeddings.EmbeddingsChunkSize
-	overlappedChunkSize := p.Embeddings.EmbeddingsOverlappedChunkSize
-	vbs := p.Verbose
+	writer.verbose(
+		verboseMedium,
+		p.Verbose,
+		"generating embeddings...",
+	)
+
+	embeds, err := generateEmbeddings(
+		ctx,
+		timeoutSeconds,
+		gtc,
+		prompts,
+		p.Embeddings.EmbeddingsTaskType,
+		p.Embeddings.EmbeddingsChunkSize,
+		p.Embeddings.EmbeddingsOverlappedChunkSize,
+	)
+	if err != nil {
+		return 1, err
+	}
+
+	// print result in JSON format
+	if encoded, err := json.Marshal(embeds); err != nil {
+		return 1, fmt.Errorf(
+			"embeddings encoding failed: %w",
+			err,
+		)
+	} else {
+		writer.printColored(
+			color.FgHiWhite,
+			"%s\n",
+			string(encoded),
+		)
+
+		return 0, nil
+	}
+}
 
+// generate embeddings of given text or bytes prompts
+//
+// (text prompts are chunked with `chunkSize` and `overlappedChunkSize`)
+func generateEmbeddings(
+	ctx context.Context,
+	timeoutSeconds int,
+	gtc *gt.Client,
+	prompts []gt.Prompt,
+	taskType *string,
+	chunkSize, overlappedChunkSize *uint,
+) ([]embeddingInfo, error) {
 	// embeddings task type
 	var selectedTaskType gt.EmbeddingTaskType
 	if taskType != nil {
@@ -79,12 +121,6 @@ func doEmbeddingsGeneration(
 		overlappedChunkSize = new(defaultEmbeddingsChunkOverlappedSize)
 	}
 
-	writer.verbose(
-		verboseMedium,
-		vbs,
-		"generating embeddings...",
-	)
-
 	var embedInfo embeddingInfo
 	embeds := []embeddingInfo{}
 
@@ -99,7 +135,7 @@ func doEmbeddingsGeneration(
 				EllipsesText:   "...",
 			})
 			if err != nil {
-				return 1, fmt.Errorf(
+				return nil, fmt.Errorf(
 					"failed to chunk text: %w",
 					err,
 				)
@@ -126,7 +162,7 @@ func doEmbeddingsGeneration(
 					},
 					&selectedTaskType,
 				); err != nil {
-					return 1, fmt.Errorf(
+					return nil, fmt.Errorf(
 						"embeddings failed for chunk[%d]: %w",
 						j,
 						err,
@@ -152,7 +188,7 @@ func doEmbeddingsGeneration(
 				},
 				&selectedTaskType,
 			); err != nil {
-				return 1, fmt.Errorf(
+				return nil, fmt.Errorf(
 					"embeddings failed for file[%d]: %w",
 					i,
 					err,
@@ -163,7 +199,7 @@ func doEmbeddingsGeneration(
 				})
 			}
 		default:
-			return 1, fmt.Errorf(
+			return nil, fmt.Errorf(
 				"unknown prompt type for embeddings: %T",
 				prompt,
 			)
@@ -172,19 +208,5 @@ func doEmbeddingsGeneration(
 		embeds = append(embeds, embedInfo)
 	}
 
-	// print result in JSON format
-	if encoded, err := json.Marshal(embeds); err != nil {
-		return 1, fmt.Errorf(
-			"embeddings encoding failed: %w",
-			err,
-		)
-	} else {
-		writer.printColored(
-			color.FgHiWhite,
-			"%s\n",
-			string(encoded),
-		)
-
-		return 0, nil
-	}
+	return embeds, nil
 }
@@ -0,0 +1,179 @@
+// errors.go
+//
+// Things for exit codes and reporting errors (`--error-format`).
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+
+	gt "github.com/meinside/gemini-things-go"
+	"google.golang.org/genai"
+)
+
+// exit codes
+const (
+	exitCodeSuccess     = 0
+	exitCodeGeneral     = 1  // unclassified errors
+	exitCodeBadInput    = 2  // invalid flags, parameters, or inputs
+	exitCodeBlocked     = 3  // prompts or responses blocked for safety reasons
+	exitCodeConfig      = 4  // errors in the config file, or missing credentials
+	exitCodeAuth        = 5  // invalid credentials, or denied permissions
+	exitCodeQuota       = 6  // API quota exceeded (transient)
+	exitCodeOverloaded  = 7  // model overloaded (transient)
+	exitCodeTimeout     = 8  // timed out (transient)
+	exitCodeToolFailure = 9  // failed tool calls or callbacks, or unreachable MCP servers
+	exitCodeLoopLimit   = 10 // too many repeated function calls
+)
+
+// kinds of errors for each exit code
+var errorKinds = map[int]string{
+	exitCodeGeneral:     "general",
+	exitCodeBadInput:    "bad_input",
+	exitCodeBlocked:     "blocked",
+	exitCodeConfig:      "config",
+	exitCodeAuth:        "auth",
+	exitCodeQuota:       "quota",
+	exitCodeOverloaded:  "overloaded",
+	exitCodeTimeout:     "timeout",
+	exitCodeToolFailure: "tool_failure",
+	exitCodeLoopLimit:   "loop_limit",
+}
+
+// an error for missing credentials (neither gemini api key nor google credentials file is given)
+var errNoCredentials = errors.New("gemini api key or google credentials not found")
+
+// return the exit code for errors from creating clients
+//
+// (missing credentials are errors in the config, and others are treated as invalid credentials)
+func exitCodeForClientError(err error) int {
+	if errors.Is(err, errNoCredentials) || errors.Is(err, fs.ErrNotExist) {
+		return exitCodeConfig
+	}
+	return exitCodeAuth
+}
+
+// error formats
+const (
+	errorFormatText = "text"
+	errorFormatJSON = "json"
+)
+
+// a structured error report (`--error-format=json`)
+type errorReport struct {
+	Code      int    `json:"code"`
+	Kind      string `json:"kind"`
+	Message   string `json:"message"`
+	Transient bool   `json:"transient"` // (whether it may succeed when retried later)
+}
+
+// check if errors with given exit code are transient
+func isTransientExitCode(code int) bool {
+	return code == exitCodeQuota ||
+		code == exitCodeOverloaded ||
+		code == exitCodeTimeout
+}
+
+// return the exit code for given exit code and error
+//
+// (exit codes other than 0 and 1 are returned as they are, as they are already classified)
+func exitCodeForError(exit int, err error) int {
+	if exit > exitCodeGeneral {
+		return exit
+	}
+	if err == nil {
+		return exit
+	}
+
+	var blocked *blockedError
+	switch {
+	case errors.As(err, &blocked):
+		return exitCodeBlocked
+	case gt.IsQuotaExceeded(err):
+		return exitCodeQuota
+	case gt.IsModelOverloaded(err):
+		return exitCodeOverloaded
+	case errors.Is(err, context.DeadlineExceeded):
+		return exitCodeTimeout
+	}
+
+	if ae, isAPIError := gt.APIError(err); isAPIError {
+		switch ae.Code {
+		case 400, 404:
+			if isInvalidAPIKey(ae) {
+				return exitCodeAuth
+			}
+			return exitCodeBadInput
+		case 401, 403:
+			return exitCodeAuth
+		case 429:
+			return exitCodeQuota
+		case 503:
+			return exitCodeOverloaded
+		case 504:
+			return exitCodeTimeout
+		}
+	}
+
+	return exitCodeGeneral
+}
+
+// reason of errors for invalid API keys (which are returned with 400, not 401)
+const apiKeyInvalidReason = "API_KEY_INVALID"
+
+// check if given API error is for an invalid API key
+func isInvalidAPIKey(ae genai.APIError) bool {
+	if ae.Status == apiKeyInvalidReason {
+		return true
+	}
+	for _, detail := range ae.Details {
+		if reason, ok := detail["reason"].(string); ok && reason == apiKeyInvalidReason {
+			return true
+		}
+	}
+	return false
+}
+
+// print given error in the requested format before os.Exit(), and return the exit code for it
+func printErrorBeforeExit(
+	writer outputWriter,
+	p params,
+	exit int,
+	err error,
+) int {
+	code := exitCodeForError(exit, err)
+
+	if p.ErrorFormat != nil && *p.ErrorFormat == errorFormatJSON {
+		report := errorReport{
+			Code:      code,
+			Kind:      errorKinds[code],
+			Message:   err.Error(),
+			Transient: isTransientExitCode(code),
+		}
+		if marshalled, e := json.Marshal(map[string]any{"error": report}); e == nil {
+			_, _ = fmt.Fprintf(os.Stderr, "%s\n", marshalled)
+		}
+		writer.emit(eventError, map[string]any{
+			"message":   report.Message,
+			"exit_code": report.Code,
+			"kind":      report.Kind,
+			"transient": report.Transient,
+		})
+
+		return code
+	}
+
+	switch code {
+	case exitCodeQuota:
+		return writer.printErrorBeforeExit(code, "API quota exceeded, try again later: %s", err)
+	case exitCodeOverloaded:
+		return writer.printErrorBeforeExit(code, "Model overloaded, try again later: %s", err)
+	default:
+		return writer.printErrorBeforeExit(code, "Error: %s", err)
+	}
+}
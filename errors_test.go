@@ -0,0 +1,129 @@
+// errors_test.go
+//
+// Things for testing `errors.go`.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"testing"
+
+	"google.golang.org/genai"
+)
+
+// test `exitCodeForError` with various errors
+func TestExitCodeForError(t *testing.T) {
+	type test struct {
+		exit     int
+		err      error
+		expected int
+	}
+
+	tests := []test{
+		{
+			exit:     exitCodeToolFailure,
+			err:      errors.New("tool call failed"),
+			expected: exitCodeToolFailure,
+		},
+		{
+			exit:     1,
+			err:      fmt.Errorf("generation failed: %w", &blockedError{target: "prompt", reason: "SAFETY"}),
+			expected: exitCodeBlocked,
+		},
+		{
+			exit:     1,
+			err:      fmt.Errorf("generation timed out: %w", context.DeadlineExceeded),
+			expected: exitCodeTimeout,
+		},
+		{
+			exit:     1,
+			err:      genai.APIError{Code: 429, Message: "You exceeded your current quota"},
+			expected: exitCodeQuota,
+		},
+		{
+			exit:     1,
+			err:      fmt.Errorf("wrapped: %w", genai.APIError{Code: 503, Message: "The model is overloaded."}),
+			expected: exitCodeOverloaded,
+		},
+		{
+			exit:     1,
+			err:      genai.APIError{Code: 403, Message: "permission denied"},
+			expected: exitCodeAuth,
+		},
+		{
+			exit:     1,
+			err:      genai.APIError{Code: 400, Message: "invalid argument"},
+			expected: exitCodeBadInput,
+		},
+		{
+			exit: 1,
+			err: genai.APIError{
+				Code:    400,
+				Message: "API key not valid. Please pass a valid API key.",
+				Status:  "INVALID_ARGUMENT",
+				Details: []map[string]any{
+					{
+						"@type":  "type.googleapis.com/google.rpc.ErrorInfo",
+						"reason": "API_KEY_INVALID",
+					},
+				},
+			},
+			expected: exitCodeAuth,
+		},
+		{
+			exit:     1,
+			err:      genai.APIError{Code: 400, Status: "API_KEY_INVALID"},
+			expected: exitCodeAuth,
+		},
+		{
+			exit:     1,
+			err:      errors.New("something went wrong"),
+			expected: exitCodeGeneral,
+		},
+	}
+
+	for _, test := range tests {
+		if code := exitCodeForError(test.exit, test.err); code != test.expected {
+			t.Errorf("expected exit code %d for '%s', got %d", test.expected, test.err, code)
+		}
+	}
+
+	// every exit code for errors should have its kind
+	for code := exitCodeGeneral; code <= exitCodeLoopLimit; code++ {
+		if _, exists := errorKinds[code]; !exists {
+			t.Errorf("no kind for exit code %d", code)
+		}
+	}
+}
+
+// test `exitCodeForClientError` with various errors
+func TestExitCodeForClientError(t *testing.T) {
+	type test struct {
+		err      error
+		expected int
+	}
+
+	tests := []test{
+		{
+			err:      fmt.Errorf("failed to create gemini-things client: %w", errNoCredentials),
+			expected: exitCodeConfig,
+		},
+		{
+			err:      fmt.Errorf("failed to read google credentials from %s: %w", "/no/such/file", fs.ErrNotExist),
+			expected: exitCodeConfig,
+		},
+		{
+			err:      errors.New("invalid credentials"),
+			expected: exitCodeAuth,
+		},
+	}
+
+	for _, test := range tests {
+		if code := exitCodeForClientError(test.err); code != test.expected {
+			t.Errorf("expected exit code %d for '%s', got %d", test.expected, test.err, code)
+		}
+	}
+}
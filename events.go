@@ -0,0 +1,160 @@
+// events.go
+//
+// Things for emitting generation events as NDJSON (`--output-format=ndjson`).
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/fatih/color"
+)
+
+// output formats
+const (
+	outputFormatText   = "text"
+	outputFormatNDJSON = "ndjson"
+)
+
+// type of output events
+type outputEventType string
+
+// output event types
+const (
+	eventText           outputEventType = "text"            // delta of generated text
+	eventThought        outputEventType = "thought"         // delta of thoughts
+	eventFunctionCall   outputEventType = "function_call"   // function call from the model
+	eventFunctionResult outputEventType = "function_result" // result of a function call (or why it was not called)
+	eventMediaSaved     outputEventType = "media_saved"     // generated image, speech, or video saved to a file
+	eventGrounding      outputEventType = "grounding"       // grounding metadata
+	eventCitation       outputEventType = "citation"        // citation metadata
+	eventUsage          outputEventType = "usage"           // token usages
+	eventFinish         outputEventType = "finish"          // finish reason
+	eventRetry          outputEventType = "retry"           // retry or fallback after a transient error
+	eventResult         outputEventType = "result"          // result of a management command (listing models, cached contexts, ...)
+	eventError          outputEventType = "error"           // error before exit
+)
+
+// output writer which emits events to stdout as NDJSON
+//
+// (things printed to stdout by other methods are dropped, as they are represented by events;
+// things printed to stderr are kept as they are)
+type ndjsonWriter struct {
+	*stdoutWriter
+
+	mu sync.Mutex
+}
+
+// generate a new ndjsonWriter
+func newNDJSONWriter() outputWriter {
+	return &ndjsonWriter{
+		stdoutWriter: &stdoutWriter{
+			didEndWithNewline: true,
+		},
+	}
+}
+
+// drop new lines for stdout
+func (w *ndjsonWriter) println() {}
+
+// drop new lines for stdout
+func (w *ndjsonWriter) makeSureToEndWithNewline() {}
+
+// drop strings for stdout
+func (w *ndjsonWriter) printColored(
+	c color.Attribute,
+	format string,
+	a ...any,
+) {
+}
+
+// drop strings for stdout
+func (w *ndjsonWriter) printWithColorForLevel(
+	level verbosity,
+	format string,
+	a ...any,
+) {
+}
+
+// emit an event with given fields to stdout as a line of JSON
+func (w *ndjsonWriter) emit(
+	eventType outputEventType,
+	fields map[string]any,
+) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	line, err := marshalOutputEvent(eventType, fields)
+	if err != nil {
+		w.error("Failed to marshal %s event: %s", eventType, err)
+		return
+	}
+
+	_, _ = fmt.Fprintf(os.Stdout, "%s\n", line)
+}
+
+// emit an error event before os.Exit(), and print it to stderr
+func (w *ndjsonWriter) printErrorBeforeExit(
+	code int,
+	format string,
+	a ...any,
+) (exit int) {
+	if code > 0 {
+		w.emit(eventError, map[string]any{
+			"message":   fmt.Sprintf(format, a...),
+			"exit_code": code,
+		})
+	}
+
+	return w.stdoutWriter.printErrorBeforeExit(code, format, a...)
+}
+
+// print given value as indented JSON to stdout (or as a `result` event with `--output-format=ndjson`)
+func printJSONResult(
+	writer outputWriter,
+	v any,
+) error {
+	marshalled, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal result: %w", err)
+	}
+
+	writer.printColored(
+		color.FgWhite,
+		"%s\n",
+		marshalled,
+	)
+	writer.emit(eventResult, map[string]any{
+		"result": v,
+	})
+
+	return nil
+}
+
+// marshal an event with given type and fields, with the type placed first
+func marshalOutputEvent(
+	eventType outputEventType,
+	fields map[string]any,
+) ([]byte, error) {
+	typ, err := json.Marshal(eventType)
+	if err != nil {
+		return nil, err
+	}
+
+	line := fmt.Appendf(nil, `{"type":%s`, typ)
+	if len(fields) > 0 {
+		marshalled, err := json.Marshal(fields)
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, ',')
+		line = append(line, marshalled[1:]...) // (without the leading '{')
+	} else {
+		line = append(line, '}')
+	}
+
+	return line, nil
+}
@@ -0,0 +1,46 @@
+// events_test.go
+//
+// Things for testing `events.go`.
+
+package main
+
+import (
+	"testing"
+)
+
+// test `marshalOutputEvent` with various events
+func TestMarshalOutputEvent(t *testing.T) {
+	type test struct {
+		eventType outputEventType
+		fields    map[string]any
+		expected  string
+	}
+
+	tests := []test{
+		{
+			eventType: eventFinish,
+			expected:  `{"type":"finish"}`,
+		},
+		{
+			eventType: eventText,
+			fields:    map[string]any{"text": "hello\n\"world\""},
+			expected:  `{"type":"text","text":"hello\n\"world\""}`,
+		},
+		{
+			eventType: eventFunctionCall,
+			fields: map[string]any{
+				"name": "get_weather",
+				"args": map[string]any{"city": "Seoul"},
+			},
+			expected: `{"type":"function_call","args":{"city":"Seoul"},"name":"get_weather"}`,
+		},
+	}
+
+	for _, test := range tests {
+		if marshalled, err := marshalOutputEvent(test.eventType, test.fields); err != nil {
+			t.Errorf("failed to marshal event: %s", err)
+		} else if string(marshalled) != test.expected {
+			t.Errorf("expected '%s', got '%s'", test.expected, string(marshalled))
+		}
+	}
+}
@@ -33,18 +33,20 @@ func listFileSearchStores(
 		"listing file search stores...",
 	)
 
-	ctx, cancel := context.WithTimeout(
-		ctx,
-		time.Duration(timeoutSeconds)*time.Second,
-	)
-	defer cancel()
+	stores, err := fetchFileSearchStores(ctx, timeoutSeconds, gtc)
+	if err != nil {
+		return 1, err
+	}
 
-	numStores := 0
-	for store, err := range gtc.ListFileSearchStores(ctx) {
-		if err != nil {
-			return 1, err
-		}
+	if p.outputAsJSON() {
+		return 0, printJSONResult(writer, struct {
+			FileSearchStores []*genai.FileSearchStore `json:"fileSearchStores"`
+		}{
+			FileSearchStores: stores,
+		})
+	}
 
+	for _, store := range stores {
 		writer.printColored(
 			color.FgHiGreen,
 			"%s",
@@ -73,11 +75,9 @@ func listFileSearchStores(
 			store.FailedDocumentsCount,
 			store.SizeBytes,
 		)
-
-		numStores++
 	}
 
-	if numStores <= 0 {
+	if len(stores) <= 0 {
 		return 1, fmt.Errorf("no file search stores")
 	}
 
@@ -85,6 +85,28 @@ func listFileSearchStores(
 	return 0, nil
 }
 
+// fetch all file search stores
+func fetchFileSearchStores(
+	ctx context.Context,
+	timeoutSeconds int,
+	gtc *gt.Client,
+) (stores []*genai.FileSearchStore, err error) {
+	ctx, cancel := context.WithTimeout(
+		ctx,
+		time.Duration(timeoutSeconds)*time.Second,
+	)
+	defer cancel()
+
+	stores = []*genai.FileSearchStore{}
+	for store, err := range gtc.ListFileSearchStores(ctx) {
+		if err != nil {
+			return nil, err
+		}
+		stores = append(stores, store)
+	}
+	return stores, nil
+}
+
 // create a file search store
 func createFileSearchStore(
 	ctx context.Context,
@@ -111,6 +133,12 @@ func createFileSearchStore(
 
 	if created, err := gtc.CreateFileSearchStore(ctx, displayName); err != nil {
 		return 1, err
+	} else if p.outputAsJSON() {
+		return 0, printJSONResult(writer, struct {
+			FileSearchStore *genai.FileSearchStore `json:"fileSearchStore"`
+		}{
+			FileSearchStore: created,
+		})
 	} else {
 		writer.printColored(
 			color.FgHiWhite,
@@ -149,6 +177,12 @@ func deleteFileSearchStore(
 
 	if err := gtc.DeleteFileSearchStore(ctx, name); err != nil {
 		return 1, err
+	} else if p.outputAsJSON() {
+		return 0, printJSONResult(writer, struct {
+			Deleted string `json:"deleted"`
+		}{
+			Deleted: name,
+		})
 	} else {
 		writer.printColored(
 			color.FgWhite,
@@ -188,7 +222,64 @@ func uploadFilesToFileSearchStore(
 	)
 
 	// chunk config
-	var chunkConfig *genai.ChunkingConfig = nil
+	chunkConfig := fileSearchChunkingConfig(chunkSize, overlappedChunkSize)
+
+	uploaded := []string{}
+	for _, path := range filepaths {
+		if err := uploadSingleFileToFileSearchStore(
+			ctx,
+			timeoutSeconds,
+			gtc,
+			fileSearchStoreName,
+			path,
+			overrideMimeTypeForExt,
+			chunkConfig,
+		); err != nil {
+			return 1, err
+		}
+
+		if p.outputAsJSON() {
+			uploaded = append(uploaded, path)
+			continue
+		}
+
+		writer.printColored(
+			color.FgWhite,
+			"Uploaded '",
+		)
+		writer.printColored(
+			color.FgHiWhite,
+			"%s",
+			path,
+		)
+		writer.printColored(
+			color.FgWhite,
+			"' to file search store: ",
+		)
+		writer.printColored(
+			color.FgHiWhite,
+			"%s\n",
+			fileSearchStoreName,
+		)
+	}
+
+	if p.outputAsJSON() {
+		return 0, printJSONResult(writer, struct {
+			FileSearchStore string   `json:"fileSearchStore"`
+			Uploaded        []string `json:"uploaded"`
+		}{
+			FileSearchStore: fileSearchStoreName,
+			Uploaded:        uploaded,
+		})
+	}
+
+	return 0, nil
+}
+
+// generate a chunking config for uploading files to file search store
+func fileSearchChunkingConfig(
+	chunkSize, overlappedChunkSize *uint,
+) (chunkConfig *genai.ChunkingConfig) {
 	if chunkSize != nil {
 		chunkConfig = &genai.ChunkingConfig{
 			WhiteSpaceConfig: &genai.WhiteSpaceConfig{},
@@ -205,23 +296,7 @@ func uploadFilesToFileSearchStore(
 
 		chunkConfig.WhiteSpaceConfig.MaxOverlapTokens = new(int32(*overlappedChunkSize))
 	}
-
-	for _, path := range filepaths {
-		if exit, err := uploadSingleFileToFileSearchStore(
-			ctx,
-			writer,
-			timeoutSeconds,
-			gtc,
-			fileSearchStoreName,
-			path,
-			overrideMimeTypeForExt,
-			chunkConfig,
-		); err != nil {
-			return exit, err
-		}
-	}
-
-	return 0, nil
+	return chunkConfig
 }
 
 // list files in a file search store
@@ -242,21 +317,22 @@ func listFilesInFileSearchStore(
 		fileSearchStoreName,
 	)
 
-	ctx, cancel := context.WithTimeout(
-		ctx,
-		time.Duration(timeoutSeconds)*time.Second,
-	)
-	defer cancel()
+	files, err := fetchFilesInFileSearchStore(ctx, timeoutSeconds, gtc, fileSearchStoreName)
+	if err != nil {
+		return 1, err
+	}
 
-	numFiles := 0
-	for file, err := range gtc.ListFilesInFileSearchStore(
-		ctx,
-		fileSearchStoreName,
-	) {
-		if err != nil {
-			return 1, err
-		}
+	if p.outputAsJSON() {
+		return 0, printJSONResult(writer, struct {
+			FileSearchStore string            `json:"fileSearchStore"`
+			Files           []*genai.Document `json:"files"`
+		}{
+			FileSearchStore: fileSearchStoreName,
+			Files:           files,
+		})
+	}
 
+	for _, file := range files {
 		writer.printColored(
 			color.FgHiGreen,
 			"%s",
@@ -282,11 +358,9 @@ func listFilesInFileSearchStore(
 			file.MIMEType,
 			prettify(customMetadataToMap(file.CustomMetadata), true),
 		)
-
-		numFiles++
 	}
 
-	if numFiles <= 0 {
+	if len(files) <= 0 {
 		return 1, fmt.Errorf("no file in file search store '%s'", fileSearchStoreName)
 	}
 
@@ -294,6 +368,32 @@ func listFilesInFileSearchStore(
 	return 0, nil
 }
 
+// fetch all files in a file search store
+func fetchFilesInFileSearchStore(
+	ctx context.Context,
+	timeoutSeconds int,
+	gtc *gt.Client,
+	fileSearchStoreName string,
+) (files []*genai.Document, err error) {
+	ctx, cancel := context.WithTimeout(
+		ctx,
+		time.Duration(timeoutSeconds)*time.Second,
+	)
+	defer cancel()
+
+	files = []*genai.Document{}
+	for file, err := range gtc.ListFilesInFileSearchStore(
+		ctx,
+		fileSearchStoreName,
+	) {
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
 // delete a file in a file search store
 func deleteFileInFileSearchStore(
 	ctx context.Context,
@@ -323,6 +423,12 @@ func deleteFileInFileSearchStore(
 		fileName,
 	); err != nil {
 		return 1, err
+	} else if p.outputAsJSON() {
+		return 0, printJSONResult(writer, struct {
+			Deleted string `json:"deleted"`
+		}{
+			Deleted: fileName,
+		})
 	} else {
 		writer.printColored(
 			color.FgWhite,
@@ -347,17 +453,16 @@ func deleteFileInFileSearchStore(
 // (extracted to avoid defer in loop)
 func uploadSingleFileToFileSearchStore(
 	ctx context.Context,
-	writer outputWriter,
 	timeoutSeconds int,
 	gtc *gt.Client,
 	fileSearchStoreName string,
 	path string,
 	overrideMimeTypeForExt map[string]string,
 	chunkConfig *genai.ChunkingConfig,
-) (int, error) {
+) error {
 	file, err := os.Open(path)
 	if err != nil {
-		return 1, err
+		return err
 	}
 	defer func() { _ = file.Close() }()
 
@@ -415,7 +520,7 @@ func uploadSingleFileToFileSearchStore(
 		chunkConfig,
 		mimeType...,
 	); err != nil {
-		return 1, fmt.Errorf(
+		return fmt.Errorf(
 			"failed to upload file '%s' (%s) to file search store '%s': %s",
 			path,
 			mimeTypeForMetadata,
@@ -424,24 +529,5 @@ func uploadSingleFileToFileSearchStore(
 		)
 	}
 
-	writer.printColored(
-		color.FgWhite,
-		"Uploaded '",
-	)
-	writer.printColored(
-		color.FgHiWhite,
-		"%s",
-		path,
-	)
-	writer.printColored(
-		color.FgWhite,
-		"' to file search store: ",
-	)
-	writer.printColored(
-		color.FgHiWhite,
-		"%s\n",
-		fileSearchStoreName,
-	)
-
-	return 0, nil
+	return nil
 }
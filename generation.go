@@ -26,15 +26,27 @@ import (
 	gt "github.com/meinside/gemini-things-go"
 )
 
+const (
+	// prompt for asking the model to continue its response which stopped on max tokens
+	autoContinuePrompt = `Your last response was cut off. Continue it exactly from where it stopped, without repeating or summarizing anything, and without any preamble.`
+)
+
 // generate text with given things
+//
+// (`clients` are for generating streams in order, with retries: `gtc` comes first, followed by
+// ones for other api keys and fallback models)
+//
+// (`markdown` is for rendering outputs across recursive generations; nil for a new one)
 func doGeneration(
 	ctx context.Context,
 	writer outputWriter,
 	timeoutSeconds int,
-	gtc *gt.Client,
+	gtc *gt.Client, clients []modelClient,
 	pastGenerations []genai.Content,
 	prompts []gt.Prompt, promptFiles map[string][]byte,
 	tools []genai.Tool, toolConfig *genai.ToolConfig, mcpConnsAndTools mcpConnectionsAndTools, thoughtSignature []byte,
+	markdown *markdownRenderer,
+	cites *citations,
 	p params,
 ) (exit int, e error) {
 	systemInstruction := *p.Generation.DetailedOptions.SystemInstruction
@@ -43,7 +55,9 @@ func doGeneration(
 	overrideMimeTypeForExt := p.OverrideFileMIMEType
 	withThinking := p.Generation.ThinkingOn
 	thinkingLevel := p.Generation.DetailedOptions.ThinkingLevel
-	showThinking := p.Generation.DetailedOptions.ShowThinking
+	thoughtsTo := p.Generation.DetailedOptions.ThoughtsTo
+	showThinking := p.Generation.DetailedOptions.ShowThinking || thoughtsTo != nil
+	metadataTo := p.Generation.MetadataTo
 	mediaResolution := p.Generation.DetailedOptions.MediaResolution
 	withGrounding := p.Generation.GroundingOn
 	withGoogleMaps := p.Generation.GoogleMaps.WithGoogleMaps
@@ -56,7 +70,14 @@ func doGeneration(
 	forceCallDestructiveTools := p.Tools.ForceCallDestructiveTools
 	toolCallbacks := p.LocalTools.ToolCallbacks
 	toolCallbacksConfirm := p.LocalTools.ToolCallbacksConfirm
+	toolCallbacksMIMEType := p.LocalTools.ToolCallbacksMIMEType
+	maxToolResultMediaBytes := p.Tools.MaxResultMediaBytes
+	maxToolResultBytes := p.Tools.MaxResultBytes
+	fileRangeReader := fileRangeReaderTool(mcpConnsAndTools)
 	outputAsJSON := p.Generation.OutputAsJSON
+	renderMarkdown := shouldRenderMarkdown(p)
+	withCitations := p.Generation.Citations && !p.outputAsJSON()
+	responseSchemaFilepath := p.Generation.ResponseSchema
 	generateImages := p.Generation.Image.GenerateImages
 	saveImagesToFiles := p.Generation.Image.SaveToFiles
 	saveImagesToDir := p.Generation.Image.SaveToDir
@@ -91,15 +112,22 @@ func doGeneration(
 		"generating...",
 	)
 
-	// configure gemini things client
-	gtc.SetSystemInstructionFunc(func() string {
-		return systemInstruction
-	})
+	// configure gemini things clients (ones not created yet will be configured on their creation)
+	for i := range clients {
+		clients[i].configure = func(gtc *gt.Client) {
+			gtc.SetSystemInstructionFunc(func() string {
+				return systemInstruction
+			})
+		}
+		if clients[i].gtc != nil {
+			clients[i].configure(clients[i].gtc)
+		}
+	}
 
 	// read & close files
 	files, err := openFilesForPrompt(promptFiles, filepaths)
 	if err != nil {
-		return 1, err
+		return exitCodeBadInput, err
 	}
 	defer func() {
 		for _, toClose := range files {
@@ -115,7 +143,9 @@ func doGeneration(
 	// generation options
 	opts := genai.GenerateContentConfig{}
 	// (safety settings)
-	opts.SafetySettings = safetySettings(gtc.Type)
+	if opts.SafetySettings, err = safetySettings(gtc.Type, p.Generation.DetailedOptions.SafetySettings); err != nil {
+		return exitCodeBadInput, fmt.Errorf("failed to configure safety settings: %w", err)
+	}
 	// (cached context)
 	if cachedContextName != nil {
 		opts.CachedContent = strings.TrimSpace(*cachedContextName)
@@ -170,7 +200,14 @@ func doGeneration(
 		}
 	}
 	// (JSON output)
-	if outputAsJSON {
+	var schema *responseSchema
+	if responseSchemaFilepath != nil {
+		if schema, err = loadResponseSchema(*responseSchemaFilepath); err != nil {
+			return exitCodeBadInput, err
+		}
+		opts.ResponseMIMEType = "application/json"
+		opts.ResponseJsonSchema = schema.raw
+	} else if outputAsJSON {
 		opts.ResponseMIMEType = "application/json"
 	}
 	// (images generation)
@@ -329,8 +366,9 @@ func doGeneration(
 
 	// generate
 	type result struct {
-		exit int
-		err  error
+		exit       int
+		err        error
+		continuing bool // (stopped on max tokens, and will be continued)
 	}
 	ch := make(chan result, 1)
 	go func() {
@@ -348,6 +386,56 @@ func doGeneration(
 		thoughtBegan, thoughtEnded := false, false
 		isThinking := false
 
+		// for writing thoughts to stderr or a file
+		var thoughts *thoughtsWriter
+		if thoughtsTo != nil {
+			var err error
+			if thoughts, err = openThoughtsWriter(*thoughtsTo); err != nil {
+				ch <- result{
+					exit: 1,
+					err:  err,
+				}
+				return
+			}
+			defer thoughts.close()
+		}
+
+		// for rendering markdown texts
+		if markdown == nil && renderMarkdown {
+			markdown = newMarkdownRenderer(func(rendered string) {
+				writer.printColored(color.Reset, "%s", rendered)
+			})
+		}
+
+		// for printing answers (with citations)
+		printAnswer := func(text string) {
+			if markdown != nil {
+				markdown.write(text)
+			} else {
+				writer.printColored(
+					color.FgHiWhite,
+					"%s",
+					text,
+				)
+			}
+		}
+		answer := new(strings.Builder)
+		if cites == nil && withCitations && schema == nil {
+			cites = newCitations() // NOTE: kept through recursions, for numbering sources consistently
+		}
+		printBufferedAnswer := func() {
+			if cites != nil && answer.Len() > 0 {
+				printAnswer(cites.annotate(answer.String()))
+				answer.Reset()
+			}
+		}
+		flushAnswer := func() {
+			printBufferedAnswer()
+			if markdown != nil {
+				markdown.flush()
+			}
+		}
+
 		ctxContents, cancelContents := context.WithTimeout(
 			ctx,
 			time.Duration(timeoutSeconds)*time.Second,
@@ -517,11 +605,16 @@ func doGeneration(
 							}
 							return
 						} else {
-							writer.printWithColorForLevel(
+							writer.errorWithColorForLevel(
 								verboseMinimum,
 								"Saved video to file: %s",
 								fpath,
 							)
+							writer.emit(eventMediaSaved, map[string]any{
+								"kind":      "video",
+								"mime_type": mimeType,
+								"path":      fpath,
+							})
 						}
 					}
 
@@ -545,14 +638,46 @@ func doGeneration(
 				printedModelVersion := false
 				promptsAppended := false
 				tokenUsages := []string{}
+				var usage *genai.GenerateContentResponseUsageMetadata
+				metadata := generationMetadata{}
 				bufModelResponse := new(strings.Builder)
 				retrievedContextTitles := map[string]struct{}{}
+				generatedFrom := 0 // (index of contents generated in this generation)
+
+				// contents for resuming generation after a transient error
+				resumeContents := func() []*genai.Content {
+					if !promptsAppended || len(pastGenerations) <= generatedFrom {
+						return contentsForGeneration
+					}
+
+					// NOTE: ask the model to continue its response which stopped in the middle
+					if !historyEndsWithUsers(pastGenerations) {
+						pastGenerations = append(pastGenerations, genai.Content{
+							Role: string(gt.RoleUser),
+							Parts: []*genai.Part{
+								{
+									Text: autoContinuePrompt,
+								},
+							},
+						})
+					}
+
+					contents := slices.Clone(contentsForGeneration)
+					for _, content := range pastGenerations[generatedFrom:] {
+						contents = append(contents, &content)
+					}
+					return contents
+				}
 
 				// iterate generated stream
-				for it, err := range gtc.GenerateStreamIterated(
+				for it, err := range generateStreamWithRetries(
 					ctxGenerate,
+					writer,
+					clients,
 					contentsForGeneration,
+					resumeContents,
 					&opts,
+					retryPolicyFrom(p),
 				) {
 					if err == nil {
 						// print model version
@@ -562,8 +687,37 @@ func doGeneration(
 							writer.verbose(verboseMinimum, vbs, "model version: %s", it.ModelVersion)
 						}
 
+						// check if the prompt was blocked
+						if blocked := promptBlocked(it.PromptFeedback); blocked != nil {
+							flushAnswer()
+							writer.makeSureToEndWithNewline()
+
+							writer.emit(eventFinish, map[string]any{
+								"reason":          it.PromptFeedback.BlockReason,
+								"prompt_feedback": it.PromptFeedback,
+							})
+							if metadataTo != nil {
+								metadata.PromptFeedback = it.PromptFeedback
+
+								if err := appendMetadata(*metadataTo, metadata); err != nil {
+									ch <- result{
+										exit: 1,
+										err:  err,
+									}
+									return
+								}
+							}
+
+							ch <- result{
+								exit: exitCodeBlocked,
+								err:  blocked,
+							}
+							return
+						}
+
 						// save token usages
 						if it.UsageMetadata != nil {
+							usage = it.UsageMetadata
 							tokenUsages = tokenUsages[:0]
 							if it.UsageMetadata.PromptTokenCount != 0 {
 								tokenUsages = append(tokenUsages, fmt.Sprintf(
@@ -615,6 +769,7 @@ func doGeneration(
 								pastGenerations = append(pastGenerations, *content)
 							}
 							promptsAppended = true
+							generatedFrom = len(pastGenerations)
 						}
 
 						for _, cand := range it.Candidates {
@@ -638,7 +793,9 @@ func doGeneration(
 									if withThinking {
 										if part.Thought {
 											if !thoughtBegan {
-												if showThinking {
+												flushAnswer()
+
+												if showThinking && thoughts == nil {
 													writer.printColored(
 														color.FgHiYellow,
 														"<thought>\n",
@@ -653,7 +810,9 @@ func doGeneration(
 												thoughtBegan = false
 
 												if !thoughtEnded {
-													if showThinking {
+													if thoughts != nil {
+														thoughts.end()
+													} else if showThinking {
 														writer.printColored(
 															color.FgHiYellow,
 															"</thought>\n",
@@ -669,19 +828,30 @@ func doGeneration(
 
 									if part.Text != "" {
 										if isThinking {
-											if showThinking {
+											if thoughts != nil {
+												thoughts.write(part.Text)
+											} else if showThinking {
 												writer.printColored(
 													color.FgHiYellow,
 													"%s",
 													part.Text,
 												)
 											}
+											writer.emit(eventThought, map[string]any{
+												"text": part.Text,
+											})
 										} else {
-											writer.printColored(
-												color.FgHiWhite,
-												"%s",
-												part.Text,
-											)
+											// NOTE: responses with schema are printed after validation
+											if schema == nil {
+												if cites != nil { // NOTE: printed with citations later
+													answer.WriteString(part.Text)
+												} else {
+													printAnswer(part.Text)
+												}
+												writer.emit(eventText, map[string]any{
+													"text": part.Text,
+												})
+											}
 
 											// NOTE: ignore thoughts from model
 											bufModelResponse.WriteString(part.Text)
@@ -690,6 +860,7 @@ func doGeneration(
 										// flush model response
 										pastGenerations = appendAndFlushModelResponse(pastGenerations, bufModelResponse)
 
+										flushAnswer()
 										writer.makeSureToEndWithNewline()
 
 										if strings.HasPrefix(part.InlineData.MIMEType, "image/") { // (images)
@@ -714,11 +885,16 @@ func doGeneration(
 													}
 													return
 												} else {
-													writer.printWithColorForLevel(
+													writer.errorWithColorForLevel(
 														verboseMinimum,
 														"Saved image to file: %s",
 														fpath,
 													)
+													writer.emit(eventMediaSaved, map[string]any{
+														"kind":      "image",
+														"mime_type": part.InlineData.MIMEType,
+														"path":      fpath,
+													})
 												}
 											} else {
 												writer.verbose(
@@ -782,11 +958,16 @@ func doGeneration(
 														}
 														return
 													} else {
-														writer.printWithColorForLevel(
+														writer.errorWithColorForLevel(
 															verboseMinimum,
 															"Saved speech to file: %s",
 															fpath,
 														)
+														writer.emit(eventMediaSaved, map[string]any{
+															"kind":      "speech",
+															"mime_type": mimeType,
+															"path":      fpath,
+														})
 													}
 												} else {
 													// error
@@ -823,6 +1004,13 @@ func doGeneration(
 											thoughtSignature = part.ThoughtSignature
 										}
 
+										flushAnswer()
+
+										writer.emit(eventFunctionCall, map[string]any{
+											"name": part.FunctionCall.Name,
+											"args": part.FunctionCall.Args,
+										})
+
 										// flush model response
 										pastGenerations = appendAndFlushModelResponse(pastGenerations, bufModelResponse)
 
@@ -859,7 +1047,7 @@ func doGeneration(
 										if duplicated > maxCallbackLoopCount {
 											// error
 											ch <- result{
-												exit: 1,
+												exit: exitCodeLoopLimit,
 												err: fmt.Errorf(
 													"possible infinite loop of function call detected (permitted max count: %d): '%s'",
 													maxCallbackLoopCount,
@@ -872,6 +1060,7 @@ func doGeneration(
 										// NOTE: if tool callbackPath exists for this function call, execute it with the args
 										if callbackPath, exists := toolCallbacks[part.FunctionCall.Name]; exists {
 											fnCallback, okToRun := checkCallbackPath(
+												ctx,
 												writer,
 												callbackPath,
 												toolCallbacksConfirm,
@@ -890,7 +1079,7 @@ func doGeneration(
 												if res, err := fnCallback(); err != nil {
 													// error
 													ch <- result{
-														exit: 1,
+														exit: exitCodeToolFailure,
 														err: fmt.Errorf(
 															"tool callback failed: %s",
 															err,
@@ -906,42 +1095,81 @@ func doGeneration(
 														)
 													}
 
+													// NOTE: when a mime type is declared for this callback, treat its output as media
+													var generated gt.Prompt
+													if mimeType, exists := toolCallbacksMIMEType[part.FunctionCall.Name]; exists {
+														generated = gt.PromptFromBytes([]byte(res), mimeType)
+													} else {
+														generated = gt.PromptFromText(res)
+													}
+
 													// print the result of execution
-													if forcePrintCallbackResults ||
-														verboseLevel(vbs) >= verboseMinimum {
+													// NOTE: results are the answer only when forced, otherwise they are printed to stderr
+													if forcePrintCallbackResults {
 														writer.printColored(
 															color.FgHiCyan,
 															"%s\n",
-															res,
+															generated.String(),
+														)
+													} else if verboseLevel(vbs) >= verboseMinimum {
+														writer.errorColored(
+															color.FgHiCyan,
+															"%s\n",
+															generated.String(),
 														)
 													}
+													writer.emit(eventFunctionResult, map[string]any{
+														"name":   part.FunctionCall.Name,
+														"result": generated.String(),
+													})
 
 													// flush model response
 													pastGenerations = appendAndFlushModelResponse(pastGenerations, bufModelResponse)
 
 													// append function response to past generations
+													fnResponse, savedFilepath, err := functionResponseFromPrompts(
+														part.FunctionCall.Name,
+														[]gt.Prompt{generated},
+														maxToolResultMediaBytes,
+														maxToolResultBytes,
+														fileRangeReader,
+													)
+													if err != nil {
+														writer.warn(
+															"Failed to save oversized result of '%s': %s",
+															fn,
+															err,
+														)
+													} else if savedFilepath != "" {
+														writer.verbose(
+															verboseMinimum,
+															vbs,
+															"oversized result of '%s' was saved to: %s",
+															fn,
+															savedFilepath,
+														)
+													}
 													pastGenerations = append(pastGenerations, genai.Content{
 														Role: string(gt.RoleUser),
 														Parts: []*genai.Part{
 															{
-																FunctionResponse: &genai.FunctionResponse{
-																	Name: part.FunctionCall.Name,
-																	Response: map[string]any{
-																		"output": res,
-																	},
-																},
+																FunctionResponse: fnResponse,
 																ThoughtSignature: thoughtSignature,
 															},
 														},
 													})
 												}
 											} else {
-												writer.printColored(
+												writer.errorColored(
 													color.FgHiYellow,
 													"Skipped execution of callback '%s' for function '%s'.\n",
 													callbackPath,
 													fn,
 												)
+												writer.emit(eventFunctionResult, map[string]any{
+													"name":    part.FunctionCall.Name,
+													"skipped": true,
+												})
 
 												// flush model response
 												pastGenerations = appendAndFlushModelResponse(pastGenerations, bufModelResponse)
@@ -974,7 +1202,7 @@ func doGeneration(
 
 												var serverKey string
 												var serverType mcpServerType
-												var mc *mcp.ClientSession
+												var mc *mcpServerConnection
 												var tool mcp.Tool
 												var toolExists bool
 												if serverKey, serverType, mc, tool, toolExists = mcpToolFrom(
@@ -982,10 +1210,24 @@ func doGeneration(
 													part.FunctionCall.Name,
 												); toolExists {
 													// check if matched tool requires confirmation
-													if tool.Annotations != nil &&
+													needsConfirmation := tool.Annotations != nil &&
 														tool.Annotations.DestructiveHint != nil &&
 														*tool.Annotations.DestructiveHint &&
-														!forceCallDestructiveTools {
+														!forceCallDestructiveTools
+
+													// (preview the call with the tool's hook, which may also waive the confirmation)
+													if hook, exists := mcpConnsAndTools[serverKey].confirmHooks[part.FunctionCall.Name]; exists && needsConfirmation {
+														var preview string
+														if preview, needsConfirmation = hook(part.FunctionCall.Args); needsConfirmation && preview != "" {
+															writer.errorColored(
+																color.FgYellow,
+																"%s\n",
+																preview,
+															)
+														}
+													}
+
+													if needsConfirmation {
 														okToRun = confirm(fmt.Sprintf(
 															`May I call tool '%s' from '%s'?`,
 															// tool name + arguments
@@ -1020,6 +1262,11 @@ func doGeneration(
 														stripServerInfo(serverType, serverKey),
 														prettify(part.FunctionCall),
 													)
+													writer.emit(eventFunctionResult, map[string]any{
+														"name":   part.FunctionCall.Name,
+														"server": stripServerInfo(serverType, serverKey),
+														"error":  "no matching tool",
+													})
 
 													// append function response (no matching tool) to past generations
 													pastGenerations = append(pastGenerations, genai.Content{
@@ -1056,18 +1303,27 @@ func doGeneration(
 													if res, err := fetchMCPToolCallResult(
 														ctx,
 														mc,
-														part.FunctionCall.Name,
+														tool,
 														part.FunctionCall.Args,
 													); err == nil {
 														var generated []gt.Prompt
 														if res.StructuredContent != nil {
-															if raw, err := json.Marshal(res.StructuredContent); err == nil {
-																// generated = []gt.Prompt{gt.PromptFromBytes(raw)} // FIXME: http 500 errors occur
+															// NOTE: indented, so that it can be read in ranges of lines when it is too large
+															if raw, err := json.MarshalIndent(res.StructuredContent, "", "  "); err == nil {
 																generated = []gt.Prompt{gt.PromptFromText(string(raw))}
+
+																// NOTE: keep media in the unstructured content, as structured content holds only JSON
+																if prompts, err := gt.MCPCallToolResultToGeminiPrompts(res); err == nil {
+																	for _, prompt := range prompts {
+																		if _, isText := prompt.(gt.TextPrompt); !isText {
+																			generated = append(generated, prompt)
+																		}
+																	}
+																}
 															} else {
 																// error
 																ch <- result{
-																	exit: 1,
+																	exit: exitCodeToolFailure,
 																	err: fmt.Errorf(
 																		"failed to read tool call result: could not marshal structured content (%T): %w",
 																		res.StructuredContent,
@@ -1082,7 +1338,7 @@ func doGeneration(
 															} else {
 																// error
 																ch <- result{
-																	exit: 1,
+																	exit: exitCodeToolFailure,
 																	err: fmt.Errorf(
 																		"failed to read tool call result: %s",
 																		err,
@@ -1100,15 +1356,32 @@ func doGeneration(
 															)
 														}
 
+														// emit the result of execution,
+														results := []string{}
+														for _, prompt := range generated {
+															results = append(results, prompt.String())
+														}
+														writer.emit(eventFunctionResult, map[string]any{
+															"name":   part.FunctionCall.Name,
+															"server": stripServerInfo(serverType, serverKey),
+															"result": strings.Join(results, "\n"),
+														})
+
 														// print the result of execution,
 														for _, prompt := range generated {
-															if forcePrintCallbackResults ||
-																verboseLevel(vbs) >= verboseMinimum {
+															// NOTE: results are the answer only when forced, otherwise they are printed to stderr
+															if forcePrintCallbackResults {
 																writer.printColored(
 																	color.FgHiCyan,
 																	"%s\n",
 																	prompt.String(),
 																)
+															} else if verboseLevel(vbs) >= verboseMinimum {
+																writer.errorColored(
+																	color.FgHiCyan,
+																	"%s\n",
+																	prompt.String(),
+																)
 															}
 
 															// and save files if needed
@@ -1139,11 +1412,16 @@ func doGeneration(
 																			}
 																			return
 																		} else {
-																			writer.printWithColorForLevel(
+																			writer.errorWithColorForLevel(
 																				verboseMinimum,
 																				"Saved image to file: %s",
 																				fpath,
 																			)
+																			writer.emit(eventMediaSaved, map[string]any{
+																				"kind":      "image",
+																				"mime_type": mimeType,
+																				"path":      fpath,
+																			})
 																		}
 																	} else {
 																		writer.verbose(
@@ -1207,11 +1485,16 @@ func doGeneration(
 																			}
 																			return
 																		} else {
-																			writer.printWithColorForLevel(
+																			writer.errorWithColorForLevel(
 																				verboseMinimum,
 																				"Saved speech to file: %s",
 																				fpath,
 																			)
+																			writer.emit(eventMediaSaved, map[string]any{
+																				"kind":      "speech",
+																				"mime_type": mimeType,
+																				"path":      fpath,
+																			})
 																		}
 																	}
 																}
@@ -1221,19 +1504,32 @@ func doGeneration(
 														// flush model response
 														pastGenerations = appendAndFlushModelResponse(pastGenerations, bufModelResponse)
 
-														// append function response to past generations
-														output := []genai.Part{}
-														for _, gen := range generated {
-															output = append(output, gen.ToPart())
+														// append function response (with media, if any) to past generations
+														fnResponse, savedFilepath, err := functionResponseFromPrompts(
+															part.FunctionCall.Name,
+															generated,
+															maxToolResultMediaBytes,
+															maxToolResultBytes,
+															fileRangeReader,
+														)
+														if err != nil {
+															writer.warn(
+																"Failed to save oversized result of '%s': %s",
+																fn,
+																err,
+															)
+														} else if savedFilepath != "" {
+															writer.verbose(
+																verboseMinimum,
+																vbs,
+																"oversized result of '%s' was saved to: %s",
+																fn,
+																savedFilepath,
+															)
 														}
 														parts := []*genai.Part{
 															{
-																FunctionResponse: &genai.FunctionResponse{
-																	Name: part.FunctionCall.Name,
-																	Response: map[string]any{
-																		"output": output,
-																	},
-																},
+																FunctionResponse: fnResponse,
 																ThoughtSignature: thoughtSignature,
 															},
 														}
@@ -1244,7 +1540,7 @@ func doGeneration(
 													} else {
 														// error
 														ch <- result{
-															exit: 1,
+															exit: exitCodeToolFailure,
 															err: fmt.Errorf(
 																"tool call failed: %s",
 																err,
@@ -1253,13 +1549,18 @@ func doGeneration(
 														return
 													}
 												} else {
-													writer.printColored(
+													writer.errorColored(
 														color.FgHiYellow,
 														"Skipped execution of tool '%s' from '%s' for function '%s'.\n",
 														part.FunctionCall.Name,
 														stripServerInfo(serverType, serverKey),
 														fn,
 													)
+													writer.emit(eventFunctionResult, map[string]any{
+														"name":    part.FunctionCall.Name,
+														"server":  stripServerInfo(serverType, serverKey),
+														"skipped": true,
+													})
 
 													// flush model response
 													pastGenerations = appendAndFlushModelResponse(pastGenerations, bufModelResponse)
@@ -1285,11 +1586,15 @@ func doGeneration(
 												}
 											} else {
 												// no matching tool, just print the function call data
-												writer.printWithColorForLevel(
+												writer.errorWithColorForLevel(
 													verboseMinimum,
 													"No matching tool; given function call was: %s",
 													prettify(part.FunctionCall),
 												)
+												writer.emit(eventFunctionResult, map[string]any{
+													"name":  part.FunctionCall.Name,
+													"error": "no matching tool",
+												})
 
 												// append function response (no matching tool) to past generations
 												pastGenerations = append(pastGenerations, genai.Content{
@@ -1312,7 +1617,7 @@ func doGeneration(
 											}
 										} else {
 											// just print the function call data
-											writer.printWithColorForLevel(
+											writer.errorWithColorForLevel(
 												verboseMinimum,
 												"Generated function call: %s",
 												prettify(part.FunctionCall),
@@ -1343,8 +1648,13 @@ func doGeneration(
 
 							// grounding metadata
 							if !groundingMetadataEmpty(cand.GroundingMetadata) {
+								if cites != nil {
+									cites.addGrounding(cand.GroundingMetadata)
+								}
+
 								// NOTE: make sure to insert a new line before displaying grounding metadata
 								if verboseLevel(vbs) >= verboseMinimum {
+									flushAnswer()
 									writer.makeSureToEndWithNewline()
 								}
 
@@ -1354,6 +1664,10 @@ func doGeneration(
 									"ground metadata:\n%s",
 									prettify(cand.GroundingMetadata),
 								)
+								writer.emit(eventGrounding, map[string]any{
+									"metadata": cand.GroundingMetadata,
+								})
+								metadata.Grounding = append(metadata.Grounding, cand.GroundingMetadata)
 
 								// save retrieved context titles
 								for _, retrieved := range cand.GroundingMetadata.GroundingChunks {
@@ -1369,8 +1683,13 @@ func doGeneration(
 
 							// citation metadata
 							if cand.CitationMetadata != nil {
+								if cites != nil {
+									cites.addCitations(cand.CitationMetadata)
+								}
+
 								// NOTE: make sure to insert a new line before displaying grounding metadata
 								if verboseLevel(vbs) >= verboseMinimum {
+									flushAnswer()
 									writer.makeSureToEndWithNewline()
 								}
 
@@ -1380,8 +1699,10 @@ func doGeneration(
 									">>> citation metadata:\n%s",
 									prettify(cand.CitationMetadata),
 								)
-
-								// TODO: do the same thing as grounding metadata above
+								writer.emit(eventCitation, map[string]any{
+									"metadata": cand.CitationMetadata,
+								})
+								metadata.Citations = append(metadata.Citations, cand.CitationMetadata)
 							}
 
 							// finish reason
@@ -1389,24 +1710,31 @@ func doGeneration(
 								// flush model response
 								pastGenerations = appendAndFlushModelResponse(pastGenerations, bufModelResponse)
 
-								writer.makeSureToEndWithNewline() // NOTE: make sure to insert a new line before displaying finish reason
+								// NOTE: when the generation will be continued, outputs are not flushed for stitching them seamlessly
+								continuing := cand.FinishReason == genai.FinishReasonMaxTokens &&
+									p.Generation.DetailedOptions.AutoContinue > 0 &&
+									schema == nil
+								if continuing {
+									printBufferedAnswer()
+								} else {
+									flushAnswer()
+									writer.makeSureToEndWithNewline() // NOTE: make sure to insert a new line before displaying finish reason
+								}
 
-								// print retrieved context titles
-								if len(retrievedContextTitles) > 0 {
+								// print retrieved context titles (when they are not in the references)
+								if cites == nil && len(retrievedContextTitles) > 0 {
 									titles := []string{}
 									for title := range retrievedContextTitles {
 										titles = append(titles, title)
 									}
 
-									writer.printColored(
+									writer.errorColored(
 										color.FgHiCyan,
 										"> Retrieved contexts from file search store: %s\n",
 										prettify(titles),
 									)
 								}
 
-								// TODO: do the same thing as grounding metadata above
-
 								// print the number of tokens before printing the finish reason
 								if len(tokenUsages) > 0 {
 									writer.verbose(
@@ -1425,12 +1753,50 @@ func doGeneration(
 									cand.FinishReason,
 								)
 
+								if usage != nil {
+									writer.emit(eventUsage, map[string]any{
+										"usage": usage,
+									})
+								}
+								writer.emit(eventFinish, map[string]any{
+									"reason":         cand.FinishReason,
+									"safety_ratings": cand.SafetyRatings,
+								})
+
+								// write metadata to a file
+								if metadataTo != nil {
+									metadata.Usage = usage
+									metadata.FinishReason = cand.FinishReason
+									metadata.SafetyRatings = cand.SafetyRatings
+
+									if err := appendMetadata(*metadataTo, metadata); err != nil {
+										ch <- result{
+											exit: 1,
+											err:  err,
+										}
+										return
+									}
+								}
+
 								if cand.FinishReason == genai.FinishReasonStop {
 									// success
 									ch <- result{
 										exit: 0,
 										err:  nil,
 									}
+								} else if blocked := responseBlocked(cand); blocked != nil {
+									// blocked
+									ch <- result{
+										exit: exitCodeBlocked,
+										err:  blocked,
+									}
+								} else if continuing {
+									// will be continued
+									ch <- result{
+										exit:       0,
+										err:        nil,
+										continuing: true,
+									}
 								} else {
 									// error
 									ch <- result{
@@ -1445,9 +1811,19 @@ func doGeneration(
 						// flush model response
 						pastGenerations = appendAndFlushModelResponse(pastGenerations, bufModelResponse)
 					} else {
+						// write partial metadata to a file
+						if metadataTo != nil {
+							metadata.Usage = usage
+							metadata.Error = gt.ErrToStr(err)
+
+							if err := appendMetadata(*metadataTo, metadata); err != nil {
+								writer.warn("Failed to write partial metadata: %s", err)
+							}
+						}
+
 						// error
 						ch <- result{
-							exit: 1,
+							exit: exitCodeForError(1, err),
 							err: fmt.Errorf(
 								"stream iteration failed: %s",
 								gt.ErrToStr(err),
@@ -1481,6 +1857,44 @@ func doGeneration(
 			ctx.Err(),
 		)
 	case res := <-ch:
+		// continue the generation which stopped on max tokens
+		if res.exit == 0 &&
+			res.err == nil &&
+			res.continuing {
+			p.Generation.DetailedOptions.AutoContinue--
+
+			writer.verbose(
+				verboseMinimum,
+				vbs,
+				"stopped on max tokens, continuing generation (%d left)...",
+				p.Generation.DetailedOptions.AutoContinue,
+			)
+
+			pastGenerations = append(pastGenerations, genai.Content{
+				Role: string(gt.RoleUser),
+				Parts: []*genai.Part{
+					{
+						Text: autoContinuePrompt,
+					},
+				},
+			})
+			p.Generation.Filepaths = nil // NOTE: files are already in `pastGenerations`
+
+			return doGeneration(
+				ctx,
+				writer,
+				timeoutSeconds,
+				gtc, clients,
+				pastGenerations,
+				nil, nil,
+				tools, toolConfig, mcpConnsAndTools,
+				thoughtSignature,
+				markdown,
+				cites,
+				p,
+			)
+		}
+
 		// check if recursion is needed
 		if res.exit == 0 &&
 			res.err == nil &&
@@ -1498,19 +1912,177 @@ func doGeneration(
 				ctx,
 				writer,
 				timeoutSeconds,
-				gtc,
+				gtc, clients,
 				pastGenerations,
 				nil, nil, // NOTE: all prompts and histories for recursion are already appended in `pastGenerations`
 				tools, toolConfig, mcpConnsAndTools,
 				thoughtSignature,
+				markdown,
+				cites,
 				p,
 			)
 		}
 
+		// print references of citations (once, after all rounds of generation)
+		if cites != nil && !cites.empty() {
+			writer.printColored(
+				color.FgHiCyan,
+				"\n%s",
+				cites.references(),
+			)
+		}
+
+		// validate the response with the schema
+		if res.exit == 0 &&
+			res.err == nil &&
+			schema != nil {
+			response := lastModelResponseText(pastGenerations)
+			if err := schema.validate(response); err != nil {
+				// ask the model to repair its response
+				if p.Generation.ResponseSchemaRepairs > 0 {
+					writer.verbose(
+						verboseMinimum,
+						vbs,
+						"invalid response (%s), asking for a repaired one (%d left)...",
+						err,
+						p.Generation.ResponseSchemaRepairs,
+					)
+
+					pastGenerations = append(pastGenerations, genai.Content{
+						Role: string(gt.RoleUser),
+						Parts: []*genai.Part{
+							{
+								Text: fmt.Sprintf(responseSchemaRepairPromptFormat, err),
+							},
+						},
+					})
+					p.Generation.ResponseSchemaRepairs--
+					p.Generation.Filepaths = nil // NOTE: files are already in `pastGenerations`
+
+					return doGeneration(
+						ctx,
+						writer,
+						timeoutSeconds,
+						gtc, clients,
+						pastGenerations,
+						nil, nil,
+						tools, toolConfig, mcpConnsAndTools,
+						thoughtSignature,
+						markdown,
+						cites,
+						p,
+					)
+				}
+
+				writer.error(
+					"Invalid response:\n%s",
+					response,
+				)
+
+				return 1, fmt.Errorf("failed to generate a valid response: %w", err)
+			}
+
+			// print the validated response
+			writer.printColored(
+				color.FgHiWhite,
+				"%s\n",
+				strings.TrimSpace(response),
+			)
+			writer.emit(eventText, map[string]any{
+				"text": strings.TrimSpace(response),
+			})
+		}
+
 		return res.exit, res.err
 	}
 }
 
+// check if given mime type is of media which can be sent back to the model in function responses
+func isFunctionResponseMedia(mimeType string) bool {
+	mimeType, _, _ = strings.Cut(mimeType, ";")
+	mimeType = strings.TrimSpace(mimeType)
+
+	return strings.HasPrefix(mimeType, "image/") ||
+		strings.HasPrefix(mimeType, "audio/") ||
+		mimeType == "application/pdf"
+}
+
+// return the name of the tool for reading shortened tool results in ranges,
+// or an empty string if it is not exposed to the model
+func fileRangeReaderTool(mcpConnsAndTools mcpConnectionsAndTools) string {
+	if self, exists := mcpConnsAndTools[mcpToolNameSelf]; exists {
+		for _, tool := range self.tools {
+			if tool.Name == `gmn_read_file_range` {
+				return tool.Name
+			}
+		}
+	}
+	return ""
+}
+
+// build a function response with given tool results
+//
+// NOTE: media (images, audios, and PDFs) are sent as multimodal parts until their total size reaches `maxMediaBytes`;
+// others (or media exceeding the limit) are replaced with text descriptions.
+// Texts larger than `maxResultBytes` are shortened, and saved to a temporary file at `savedFilepath`
+// (which can be read with the tool named `rangeReader`, if it is not empty).
+func functionResponseFromPrompts(
+	name string,
+	prompts []gt.Prompt,
+	maxMediaBytes int64,
+	maxResultBytes int,
+	rangeReader string,
+) (response *genai.FunctionResponse, savedFilepath string, err error) {
+	if maxMediaBytes <= 0 {
+		maxMediaBytes = defaultMaxToolResultMediaBytes
+	}
+
+	texts := []string{}
+	parts := []*genai.FunctionResponsePart{}
+	var mediaBytes int64
+	for _, prompt := range prompts {
+		switch p := prompt.(type) {
+		case gt.TextPrompt:
+			texts = append(texts, p.Text)
+		case gt.BytesPrompt:
+			mimeType := p.MIMEType
+			if p.ForcedMIMEType != "" {
+				mimeType = p.ForcedMIMEType
+			}
+
+			if !isFunctionResponseMedia(mimeType) {
+				if strings.HasPrefix(mimeType, "text/") {
+					texts = append(texts, string(p.Bytes))
+				} else {
+					texts = append(texts, fmt.Sprintf("(omitted unsupported media: %s, %d bytes)", mimeType, len(p.Bytes)))
+				}
+			} else if mediaBytes+int64(len(p.Bytes)) > maxMediaBytes {
+				texts = append(texts, fmt.Sprintf("(omitted media exceeding the size limit of %d bytes: %s, %d bytes)", maxMediaBytes, mimeType, len(p.Bytes)))
+			} else {
+				mediaBytes += int64(len(p.Bytes))
+
+				parts = append(parts, genai.NewFunctionResponsePartFromBytes(p.Bytes, mimeType))
+				texts = append(texts, fmt.Sprintf("(attached media #%d: %s, %d bytes)", len(parts), mimeType, len(p.Bytes)))
+			}
+		case gt.URIPrompt:
+			texts = append(texts, fmt.Sprintf("(resource: %s, %s)", p.URI, p.MIMEType))
+		default:
+			texts = append(texts, prompt.String())
+		}
+	}
+
+	var output string
+	output, savedFilepath, err = shortenToolResult(name, strings.Join(texts, "\n"), maxResultBytes, rangeReader)
+
+	return &genai.FunctionResponse{
+		Name: name,
+		Response: map[string]any{
+			"output": output,
+		},
+		Parts: parts,
+	}, savedFilepath, err
+}
+
 // append and flush model response
 func appendAndFlushModelResponse(
 	generatedConversations []genai.Content,
@@ -1562,7 +2134,10 @@ const (
 )
 
 // check if given `callbackPath` is executable
+//
+// (executables are killed when `ctx` is done)
 func checkCallbackPath(
+	ctx context.Context,
 	writer outputWriter,
 	callbackPath string,
 	confirmToolCallbacks map[string]bool,
@@ -1650,7 +2225,7 @@ func checkCallbackPath(
 				prettify(fnCall.Args, true),
 			)
 
-			return runExecutable(callbackPath, fnCall.Args)
+			return runExecutable(ctx, callbackPath, fnCall.Args)
 		}
 	}
 
@@ -0,0 +1,142 @@
+// generation_test.go
+//
+// Things for testing `generation.go`.
+
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	gt "github.com/meinside/gemini-things-go"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// test `functionResponseFromPrompts` with texts and media of various sizes and types
+func TestFunctionResponseFromPrompts(t *testing.T) {
+	type test struct {
+		prompts        []gt.Prompt
+		maxMediaBytes  int64
+		maxResultBytes int
+
+		expectedOutput   []string // (substrings of the output)
+		expectedNumParts int
+		expectedSaved    bool
+	}
+
+	png := gt.BytesPrompt{Bytes: []byte(strings.Repeat("p", 100)), MIMEType: "image/png"}
+
+	tests := []test{
+		{ // texts only
+			prompts: []gt.Prompt{
+				gt.TextPrompt{Text: "hello"},
+				gt.TextPrompt{Text: "world"},
+			},
+			expectedOutput: []string{"hello\nworld"},
+		},
+		{ // media within the limit are attached as parts
+			prompts: []gt.Prompt{
+				gt.TextPrompt{Text: "image:"},
+				png,
+			},
+			maxMediaBytes:    150,
+			expectedOutput:   []string{"image:", "(attached media #1: image/png, 100 bytes)"},
+			expectedNumParts: 1,
+		},
+		{ // media exceeding the limit are replaced with texts
+			prompts: []gt.Prompt{
+				png,
+				png,
+			},
+			maxMediaBytes:    150,
+			expectedOutput:   []string{"(attached media #1: image/png, 100 bytes)", "(omitted media exceeding the size limit of 150 bytes: image/png, 100 bytes)"},
+			expectedNumParts: 1,
+		},
+		{ // forced mime types are honored
+			prompts: []gt.Prompt{
+				gt.BytesPrompt{Bytes: []byte("%PDF-"), MIMEType: "application/octet-stream", ForcedMIMEType: "application/pdf"},
+			},
+			expectedOutput:   []string{"(attached media #1: application/pdf, 5 bytes)"},
+			expectedNumParts: 1,
+		},
+		{ // unsupported types fall back to texts
+			prompts: []gt.Prompt{
+				gt.BytesPrompt{Bytes: []byte("a,b\n1,2"), MIMEType: "text/csv"},
+				gt.BytesPrompt{Bytes: []byte{0, 1, 2}, MIMEType: "video/mp4"},
+				gt.URIPrompt{URI: "file:///tmp/x.bin", MIMEType: "application/octet-stream"},
+			},
+			expectedOutput: []string{"a,b\n1,2", "(omitted unsupported media: video/mp4, 3 bytes)", "(resource: file:///tmp/x.bin, application/octet-stream)"},
+		},
+		{ // large texts are shortened and saved to a file
+			prompts: []gt.Prompt{
+				gt.TextPrompt{Text: strings.Repeat("0123456789\n", 100)},
+			},
+			maxResultBytes: 100,
+			expectedOutput: []string{"was too large (1100 bytes, 101 lines)"},
+			expectedSaved:  true,
+		},
+	}
+
+	for _, test := range tests {
+		response, saved, err := functionResponseFromPrompts("fn", test.prompts, test.maxMediaBytes, test.maxResultBytes, "")
+		if saved != "" {
+			defer func() { _ = os.Remove(saved) }()
+		}
+		if err != nil {
+			t.Errorf("failed to build function response: %s", err)
+			continue
+		}
+
+		output, _ := response.Response["output"].(string)
+		for _, expected := range test.expectedOutput {
+			if !strings.Contains(output, expected) {
+				t.Errorf("expected '%s' in the output, got '%s'", expected, output)
+			}
+		}
+		if len(response.Parts) != test.expectedNumParts {
+			t.Errorf("expected %d parts, got %d", test.expectedNumParts, len(response.Parts))
+		}
+		if (saved != "") != test.expectedSaved {
+			t.Errorf("expected saved: %t, got '%s'", test.expectedSaved, saved)
+		} else if saved != "" {
+			if bytes, err := os.ReadFile(saved); err != nil || string(bytes) != test.prompts[0].(gt.TextPrompt).Text {
+				t.Errorf("expected the whole result in the saved file, got %d bytes (%v)", len(bytes), err)
+			}
+		}
+	}
+}
+
+// test `fileRangeReaderTool` with and without the tool exposed
+func TestFileRangeReaderTool(t *testing.T) {
+	type test struct {
+		mcpConnsAndTools mcpConnectionsAndTools
+		expected         string
+	}
+
+	tests := []test{
+		{mcpConnsAndTools: mcpConnectionsAndTools{}},
+		{
+			mcpConnsAndTools: mcpConnectionsAndTools{
+				mcpToolNameSelf: {tools: []*mcp.Tool{{Name: "gmn_read_text_file"}}},
+			},
+		},
+		{
+			mcpConnsAndTools: mcpConnectionsAndTools{
+				"other": {tools: []*mcp.Tool{{Name: "gmn_read_file_range"}}},
+			},
+		},
+		{
+			mcpConnsAndTools: mcpConnectionsAndTools{
+				mcpToolNameSelf: {tools: []*mcp.Tool{{Name: "gmn_read_text_file"}, {Name: "gmn_read_file_range"}}},
+			},
+			expected: "gmn_read_file_range",
+		},
+	}
+
+	for _, test := range tests {
+		if actual := fileRangeReaderTool(test.mcpConnsAndTools); actual != test.expected {
+			t.Errorf("expected '%s', got '%s'", test.expected, actual)
+		}
+	}
+}
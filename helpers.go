@@ -17,6 +17,7 @@ import (
 	_ "image/png"
 	"io"
 	"log"
+	"maps"
 	"net/http"
 	"os"
 	"os/exec"
@@ -26,9 +27,12 @@ import (
 	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
+	"cloud.google.com/go/auth"
+	"cloud.google.com/go/auth/credentials"
 	"github.com/BourgeoisBear/rasterm"
 	"github.com/PuerkitoBio/goquery"
 	"github.com/gabriel-vasile/mimetype"
@@ -103,7 +107,7 @@ func ignoredDirectory(
 	path string,
 ) bool {
 	if _, exists := _dirNamesToIgnore[filepath.Base(path)]; exists {
-		writer.printWithColorForLevel(
+		writer.errorWithColorForLevel(
 			verboseMedium,
 			"Ignoring directory '%s'",
 			path,
@@ -121,7 +125,7 @@ func ignoredFile(
 ) bool {
 	// ignore empty files,
 	if stat.Size() <= 0 {
-		writer.printWithColorForLevel(
+		writer.errorWithColorForLevel(
 			verboseMedium,
 			"Ignoring empty file '%s'",
 			path,
@@ -131,7 +135,7 @@ func ignoredFile(
 
 	// ignore files with ignored names,
 	if _, exists := _fileNamesToIgnore[filepath.Base(path)]; exists {
-		writer.printWithColorForLevel(
+		writer.errorWithColorForLevel(
 			verboseMedium,
 			"Ignoring file '%s'",
 			path,
@@ -234,7 +238,7 @@ func expandFilepaths(
 		if override, exists := p.OverrideFileMIMEType[filepath.Ext(*fp)]; exists {
 			filtered = append(filtered, fp)
 
-			writer.printWithColorForLevel(
+			writer.errorWithColorForLevel(
 				verboseMedium,
 				"Overriding mime type of file '%s': %s",
 				*fp,
@@ -245,7 +249,7 @@ func expandFilepaths(
 				if supported {
 					filtered = append(filtered, fp)
 				} else {
-					writer.printWithColorForLevel(
+					writer.errorWithColorForLevel(
 						verboseMedium,
 						"Ignoring file '%s', unsupported mime type: %s",
 						*fp,
@@ -319,10 +323,13 @@ func (u customURLInPrompt) url() string {
 }
 
 // replace all http urls in given text to body texts
+//
+// (`modelInitiated` should be true when the prompt was generated or requested by the model)
 func replaceURLsInPrompt(
 	writer outputWriter,
 	conf config,
 	p params,
+	modelInitiated bool,
 ) (replaced string, files map[customURLInPrompt][]byte) {
 	userAgent := *p.Generation.FetchContents.UserAgent
 	prompt := *p.Generation.Prompt
@@ -348,6 +355,7 @@ func replaceURLsInPrompt(
 				conf,
 				userAgent,
 				url,
+				modelInitiated,
 				vbs,
 			); err == nil {
 				if mimeType, supported, _ := gt.SupportedMimeType(fetched); supported { // if it is a file of supported types,
@@ -426,16 +434,21 @@ func urlsInPrompt(p params) bool {
 }
 
 // fetch the content from given url and convert it to text for prompting.
+//
+// (requests will be restricted by the egress policy in `conf`)
 func fetchContent(
 	writer outputWriter,
 	conf config,
 	userAgent,
 	url string,
+	modelInitiated bool,
 	vbs []bool,
 ) (converted []byte, contentType string, err error) {
-	client := &http.Client{
-		Timeout: time.Duration(conf.ReplaceHTTPURLTimeoutSeconds) * time.Second,
-	}
+	policy := conf.egressPolicy()
+	client := policy.httpClient(
+		time.Duration(conf.ReplaceHTTPURLTimeoutSeconds)*time.Second,
+		modelInitiated,
+	)
 
 	writer.verbose(
 		verboseMaximum,
@@ -490,8 +503,12 @@ func fetchContent(
 	if resp.StatusCode == 200 {
 		if supportedTextContentType(contentType) {
 			if strings.HasPrefix(contentType, "text/html") {
+				var body []byte
 				var doc *goquery.Document
-				if doc, err = goquery.NewDocumentFromReader(resp.Body); err == nil {
+				if body, err = policy.readBody(resp.Body); err == nil {
+					doc, err = goquery.NewDocumentFromReader(bytes.NewReader(body))
+				}
+				if err == nil {
 					// NOTE: removing unwanted things here
 					_ = doc.Find("script").Remove()                   // javascripts
 					_ = doc.Find("link[rel=\"stylesheet\"]").Remove() // css links
@@ -521,7 +538,7 @@ func fetchContent(
 				}
 			} else if strings.HasPrefix(contentType, "text/") {
 				var bytes []byte
-				if bytes, err = io.ReadAll(resp.Body); err == nil {
+				if bytes, err = policy.readBody(resp.Body); err == nil {
 					converted = fmt.Appendf(
 						nil,
 						urlToTextFormat,
@@ -546,7 +563,7 @@ func fetchContent(
 				}
 			} else if strings.HasPrefix(contentType, "application/json") {
 				var bytes []byte
-				if bytes, err = io.ReadAll(resp.Body); err == nil {
+				if bytes, err = policy.readBody(resp.Body); err == nil {
 					converted = fmt.Appendf(
 						nil,
 						urlToTextFormat,
@@ -584,7 +601,7 @@ func fetchContent(
 				)
 			}
 		} else {
-			if converted, err = io.ReadAll(resp.Body); err == nil {
+			if converted, err = policy.readBody(resp.Body); err == nil {
 				if matched, supported, _ := gt.SupportedMimeType(converted); !supported {
 					converted = fmt.Appendf(
 						nil,
@@ -1049,7 +1066,10 @@ func readMimeAndRecycle(input io.Reader) (mimeType *mimetype.MIME, recycled io.R
 }
 
 // run executable with given args and return its result
+//
+// (it will be killed when `ctx` is done)
 func runExecutable(
+	ctx context.Context,
 	execPath string,
 	args map[string]any,
 ) (result string, err error) {
@@ -1067,7 +1087,8 @@ func runExecutable(
 
 	// and run
 	arg := string(paramArgs)
-	cmd := exec.Command(execPath, arg)
+	cmd := exec.CommandContext(ctx, execPath, arg)
+	cmd.WaitDelay = time.Second // NOTE: do not wait for child processes which still hold the output after being killed
 	var output []byte
 	output, err = cmd.Output()
 	if err != nil {
@@ -1086,7 +1107,7 @@ func runExecutable(
 func confirm(prompt string) bool {
 	reader := bufio.NewReader(os.Stdin)
 	for {
-		fmt.Printf("%s (y/N): ", prompt)
+		_, _ = fmt.Fprintf(os.Stderr, "%s (y/N): ", prompt)
 
 		response, err := reader.ReadString('\n')
 		if err != nil {
@@ -1108,7 +1129,7 @@ func confirm(prompt string) bool {
 
 // read user input from stdin
 func readFromStdin(prompt string) (string, error) {
-	fmt.Printf("%s: ", prompt)
+	_, _ = fmt.Fprintf(os.Stderr, "%s: ", prompt) // NOTE: not to stdout, which may be a pipe for the output
 	reader := bufio.NewReader(os.Stdin)
 	return reader.ReadString('\n')
 }
@@ -1333,34 +1354,388 @@ func runShellCommandWithContext(
 	return stdout, stderr, exitCode, err
 }
 
+// cut given string at `n` bytes without breaking a multi-byte character
+func cutAtValidUTF8(s string, n int, fromTail bool) string {
+	if n >= len(s) {
+		return s
+	}
+	if fromTail {
+		return strings.ToValidUTF8(s[len(s)-n:], "")
+	}
+	return strings.ToValidUTF8(s[:n], "")
+}
+
+// directory for saving oversized tool results of this run
+var (
+	_toolResultsDir   string
+	_toolResultsDirMu sync.Mutex
+)
+
+// return the directory for saving oversized tool results of this run (created on demand)
+func toolResultsDir() (string, error) {
+	_toolResultsDirMu.Lock()
+	defer _toolResultsDirMu.Unlock()
+
+	if _toolResultsDir == "" {
+		dir, err := os.MkdirTemp("", "gmn-tool-results-*")
+		if err != nil {
+			return "", err
+		}
+		_toolResultsDir = dir
+	}
+
+	return _toolResultsDir, nil
+}
+
+// remove the directory for saving oversized tool results of this run (should be called before exit)
+func removeToolResultsDir() {
+	_toolResultsDirMu.Lock()
+	defer _toolResultsDirMu.Unlock()
+
+	if _toolResultsDir != "" {
+		_ = os.RemoveAll(_toolResultsDir)
+		_toolResultsDir = ""
+	}
+}
+
+// return the maximum number of bytes of file ranges read by tools,
+// for keeping them smaller than the maximum size of tool results
+func maxFileRangeBytes(maxResultBytes int) int {
+	if maxResultBytes <= 0 {
+		maxResultBytes = defaultMaxToolResultBytes
+	}
+	return maxResultBytes / 2
+}
+
+// shorten a tool result if it is larger than `maxBytes`,
+// saving the whole result to a file in the temporary directory of this run, so that it can be read in ranges later
+//
+// (`rangeReader` is the name of a tool for reading the saved file in ranges, or an empty string if there is none)
+//
+// (returns the path of the saved file, or an empty string if it was not shortened)
+func shortenToolResult(
+	fnName, result string,
+	maxBytes int,
+	rangeReader string,
+) (shortened, savedFilepath string, err error) {
+	if maxBytes <= 0 || len(result) <= maxBytes {
+		return result, "", nil
+	}
+
+	head := cutAtValidUTF8(result, maxBytes/2, false)
+	tail := cutAtValidUTF8(result, maxBytes/2, true)
+	numLines := strings.Count(result, "\n") + 1
+
+	var dir string
+	var f *os.File
+	if dir, err = toolResultsDir(); err == nil {
+		f, err = os.CreateTemp(dir, "gmn-tool-result-*.txt")
+	}
+	if err == nil {
+		defer func() { _ = f.Close() }()
+
+		if _, err = f.WriteString(result); err == nil {
+			savedFilepath = f.Name()
+
+			howToRead := ""
+			if rangeReader != "" {
+				howToRead = fmt.Sprintf(", which can be read in ranges of lines with '%s'", rangeReader)
+			}
+
+			return fmt.Sprintf(`%s
+
+[... The result of '%s' was too large (%d bytes, %d lines), so only its head and tail are shown here.
+The whole result was saved to '%s'%s. ...]
+
+%s`, head, fnName, len(result), numLines, savedFilepath, howToRead, tail), savedFilepath, nil
+		}
+	}
+
+	return fmt.Sprintf(`%s
+
+[... The result of '%s' was too large (%d bytes, %d lines), so only its head and tail are shown here. ...]
+
+%s`, head, fnName, len(result), numLines, tail), "", fmt.Errorf("failed to save tool result to a file: %w", err)
+}
+
+// read lines of a text file in the given range (`startLine` is 1-based),
+// stopping early when the read lines exceed `maxBytes`
+func readLinesInRange(
+	path string,
+	startLine, numLines, maxBytes int,
+) (lines string, endLine, totalLines int, truncated bool, err error) {
+	var f *os.File
+	if f, err = os.Open(path); err != nil {
+		return "", 0, 0, false, err
+	}
+	defer func() { _ = f.Close() }()
+
+	if startLine < 1 {
+		startLine = 1
+	}
+
+	var sb strings.Builder
+	reader := bufio.NewReader(f)
+	for {
+		line, e := reader.ReadString('\n')
+		if len(line) > 0 {
+			totalLines++
+
+			if totalLines >= startLine &&
+				totalLines < startLine+numLines &&
+				!truncated {
+				if maxBytes > 0 && sb.Len()+len(line) > maxBytes {
+					// NOTE: a line longer than `maxBytes` will be cut, not to return an empty result
+					if sb.Len() == 0 {
+						sb.WriteString(cutAtValidUTF8(line, maxBytes, false))
+						endLine = totalLines
+					}
+					truncated = true
+				} else {
+					sb.WriteString(line)
+					endLine = totalLines
+				}
+			}
+		}
+
+		if e != nil {
+			if e != io.EOF {
+				err = e
+			}
+			break
+		}
+	}
+
+	return sb.String(), endLine, totalLines, truncated, err
+}
+
+// a matched line in files
+type fileSearchMatch struct {
+	Filepath string   `json:"filepath"`
+	Line     int      `json:"line"`
+	Text     string   `json:"text"`
+	Before   []string `json:"before,omitempty"`
+	After    []string `json:"after,omitempty"`
+}
+
+// size of this match in bytes
+func (m fileSearchMatch) size() (size int) {
+	size = len(m.Filepath) + len(m.Text)
+	for _, line := range slices.Concat(m.Before, m.After) {
+		size += len(line)
+	}
+	return size
+}
+
+// truncate given line of search results if it is longer than `maxSearchFilesLineBytes`
+func truncateSearchedLine(line string) string {
+	if len(line) <= maxSearchFilesLineBytes {
+		return line
+	}
+	return cutAtValidUTF8(line, maxSearchFilesLineBytes, false) + " [...]"
+}
+
+// truncate given lines of search results
+func truncateSearchedLines(lines []string) (truncated []string) {
+	for _, line := range lines {
+		truncated = append(truncated, truncateSearchedLine(line))
+	}
+	return truncated
+}
+
+// search files in `dir` (matching `glob`, if given) for lines matching `pattern`,
+// with `contextLines` lines before and after each match
+//
+// (stops with `truncated` when the matches exceed `maxMatches` or `maxBytes` in total)
+//
+// NOTE: binary files, files larger than `maxSearchFilesFileBytes`, and ignored files/directories are skipped;
+// lines longer than `maxSearchFilesLineBytes` are truncated
+func searchFiles(
+	ctx context.Context,
+	dir string,
+	pattern *regexp.Regexp,
+	glob string,
+	contextLines, maxMatches, maxBytes int,
+) (matches []fileSearchMatch, truncated bool, err error) {
+	matches = []fileSearchMatch{}
+	totalBytes := 0
+
+	err = filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return nil // skip unreadable ones
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if d.IsDir() {
+			if _, ignored := _dirNamesToIgnore[d.Name()]; ignored && path != dir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if _, ignored := _fileNamesToIgnore[d.Name()]; ignored || !d.Type().IsRegular() {
+			return nil
+		}
+
+		// match glob against the relative path (if it has a separator) or the filename
+		if glob != "" {
+			target := d.Name()
+			if strings.Contains(glob, "/") {
+				target, _ = filepath.Rel(dir, path)
+			}
+			if matched, err := filepath.Match(glob, target); err != nil {
+				return fmt.Errorf("invalid glob '%s': %w", glob, err)
+			} else if !matched {
+				return nil
+			}
+		}
+
+		if info, err := d.Info(); err != nil || info.Size() > maxSearchFilesFileBytes {
+			return nil
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil
+		}
+		if !strings.HasPrefix(mimetype.Detect(content).String(), "text/") {
+			return nil
+		}
+
+		lines, _ := splitLines(string(content))
+		for i, line := range lines {
+			if !pattern.MatchString(line) {
+				continue
+			}
+
+			if len(matches) >= maxMatches {
+				truncated = true
+				return filepath.SkipAll
+			}
+
+			match := fileSearchMatch{
+				Filepath: path,
+				Line:     i + 1,
+				Text:     truncateSearchedLine(line),
+				Before:   truncateSearchedLines(lines[max(i-contextLines, 0):i]),
+				After:    truncateSearchedLines(lines[i+1 : min(i+1+contextLines, len(lines))]),
+			}
+			if maxBytes > 0 && totalBytes+match.size() > maxBytes {
+				truncated = true
+				return filepath.SkipAll
+			}
+			totalBytes += match.size()
+
+			matches = append(matches, match)
+		}
+		return nil
+	})
+
+	return matches, truncated, err
+}
+
+// credentials for creating clients
+type clientCredentials struct {
+	apiKey string // (for Gemini API)
+
+	// (for Vertex AI)
+	credentialsJSON []byte
+	location        string
+	bucketName      string
+}
+
+// check if given credentials are for Vertex AI
+func (c clientCredentials) isVertex() bool {
+	return c.credentialsJSON != nil
+}
+
+// resolve credentials for creating clients from given configs:
+// gemini api key, or google credentials file (with location and bucket name)
+func resolveClientCredentials(conf config) (creds clientCredentials, err error) {
+	if conf.GoogleAIAPIKey != nil {
+		return clientCredentials{
+			apiKey: *conf.GoogleAIAPIKey,
+		}, nil
+	} else if conf.GoogleCredentialsFilepath != nil {
+		if creds.credentialsJSON, err = os.ReadFile(expandPath(*conf.GoogleCredentialsFilepath)); err != nil {
+			return creds, fmt.Errorf("failed to read google credentials from %s: %w", *conf.GoogleCredentialsFilepath, err)
+		}
+		if conf.Location != nil {
+			creds.location = *conf.Location
+		}
+		if conf.GoogleCloudStorageBucketNameForFileUploads != nil {
+			creds.bucketName = *conf.GoogleCloudStorageBucketNameForFileUploads
+		}
+		return creds, nil
+	}
+
+	return creds, errNoCredentials
+}
+
 // helper function for creating a gemini-things client
 // with gemini api key, or google credentials file
 func gtClient(
 	conf config,
 	options ...gt.ClientOption,
 ) (gtc *gt.Client, err error) {
-	err = fmt.Errorf("gemini api key or google credentials not found")
+	creds, err := resolveClientCredentials(conf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create gemini-things client: %w", err)
+	}
 
-	if conf.GoogleAIAPIKey != nil {
-		return gt.NewClient(
-			*conf.GoogleAIAPIKey,
-			options...,
-		)
-	} else if conf.GoogleCredentialsFilepath != nil {
-		var credentialsBytes []byte
-		if credentialsBytes, err = os.ReadFile(expandPath(*conf.GoogleCredentialsFilepath)); err != nil {
-			return nil, fmt.Errorf("failed to read google credentials from %s: %w", *conf.GoogleCredentialsFilepath, err)
-		}
+	if creds.isVertex() {
 		return gt.NewVertexClient(
 			context.TODO(),
-			credentialsBytes,
-			*conf.Location,
-			*conf.GoogleCloudStorageBucketNameForFileUploads,
+			creds.credentialsJSON,
+			creds.location,
+			creds.bucketName,
 			options...,
 		)
 	}
+	return gt.NewClient(
+		creds.apiKey,
+		options...,
+	)
+}
 
-	return nil, fmt.Errorf("failed to create gemini-things client: %w", err)
+// create a genai client with given configs
+//
+// (for the things which are not exposed by `gt.Client`, eg. polling operations)
+func genaiClient(
+	ctx context.Context,
+	conf config,
+) (client *genai.Client, err error) {
+	creds, err := resolveClientCredentials(conf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create genai client: %w", err)
+	}
+
+	if creds.isVertex() {
+		var vertexCreds *auth.Credentials
+		if vertexCreds, err = credentials.NewCredentialsFromJSON(
+			credentials.ServiceAccount,
+			creds.credentialsJSON,
+			&credentials.DetectOptions{
+				Scopes: []string{"https://www.googleapis.com/auth/cloud-platform"},
+			},
+		); err != nil {
+			return nil, fmt.Errorf("failed to read google credentials: %w", err)
+		}
+		var projectID string
+		if projectID, err = vertexCreds.ProjectID(ctx); err != nil {
+			return nil, fmt.Errorf("failed to get project id from google credentials: %w", err)
+		}
+		return genai.NewClient(ctx, &genai.ClientConfig{
+			Backend:     genai.BackendVertexAI,
+			Project:     projectID,
+			Location:    creds.location,
+			Credentials: vertexCreds,
+		})
+	}
+	return genai.NewClient(ctx, &genai.ClientConfig{
+		APIKey:  creds.apiKey,
+		Backend: genai.BackendGeminiAPI,
+	})
 }
 
 // helper function for returning the first-appearing text,
@@ -1432,45 +1807,6 @@ func firstTextPrompt(prompts []gt.Prompt) *gt.TextPrompt {
 	return nil
 }
 
-// generate safety settings for the client
-//
-// NOTE: all possible categories will be turned off
-func safetySettings(clientType genai.Backend) []*genai.SafetySetting {
-	settings := []*genai.SafetySetting{}
-
-	var categories []genai.HarmCategory
-	switch clientType {
-	case genai.BackendGeminiAPI:
-		categories = []genai.HarmCategory{
-			genai.HarmCategoryHarassment,
-			genai.HarmCategoryHateSpeech,
-			genai.HarmCategorySexuallyExplicit,
-			genai.HarmCategoryDangerousContent,
-		}
-	case genai.BackendVertexAI:
-		categories = []genai.HarmCategory{
-			genai.HarmCategoryHarassment,
-			genai.HarmCategoryHateSpeech,
-			genai.HarmCategorySexuallyExplicit,
-			genai.HarmCategoryDangerousContent,
-			genai.HarmCategoryImageHate,
-			genai.HarmCategoryImageDangerousContent,
-			genai.HarmCategoryImageHarassment,
-			genai.HarmCategoryImageSexuallyExplicit,
-			genai.HarmCategoryJailbreak,
-		}
-	}
-
-	for _, category := range categories {
-		settings = append(settings, &genai.SafetySetting{
-			Category:  category,
-			Threshold: genai.HarmBlockThresholdOff,
-		})
-	}
-
-	return settings
-}
-
 // read and return configs filled with default values
 func readAndFillConfig(p params, writer outputWriter) (conf config, altered params, err error) {
 	configFilepath := resolveConfigFilepath(p.Configuration.ConfigFilepath)
@@ -1541,6 +1877,45 @@ func readAndFillConfig(p params, writer outputWriter) (conf config, altered para
 		}
 	}
 
+	// select one of multiple api keys
+	if len(conf.GoogleAIAPIKeys) > 0 {
+		keys := conf.GoogleAIAPIKeys
+		if conf.GoogleAIAPIKey != nil {
+			keys = append([]string{*conf.GoogleAIAPIKey}, keys...)
+		}
+		selection := apiKeySelectionFailover
+		if conf.APIKeySelection != nil {
+			selection = *conf.APIKeySelection
+		}
+		cooldownSeconds := conf.APIKeyCooldownSeconds
+		if cooldownSeconds <= 0 {
+			cooldownSeconds = defaultAPIKeyCooldownSeconds
+		}
+
+		statePath, e := apiKeysStateFilepath()
+		if e != nil {
+			return config{}, params{}, fmt.Errorf("failed to locate state file for api keys: %w", e)
+		}
+		if conf.apiKeys, e = newAPIKeyRing(
+			keys,
+			selection,
+			time.Duration(cooldownSeconds)*time.Second,
+			statePath,
+		); e != nil {
+			return config{}, params{}, fmt.Errorf("failed to configure api keys: %w", e)
+		}
+		conf.GoogleAIAPIKey = new(conf.apiKeys.keys[0])
+
+		writer.verbose(
+			verboseMinimum,
+			p.Verbose,
+			"selected API key (%s) among %d keys: %s",
+			selection,
+			len(conf.apiKeys.keys),
+			maskAPIKey(*conf.GoogleAIAPIKey),
+		)
+	}
+
 	// check if essential values are conflicting with each other
 	if p.Configuration.GoogleAIAPIKey != nil && p.Configuration.CredentialsFilepath != nil {
 		return config{}, params{}, fmt.Errorf("parameters for google AI API Key and credentials file cannot be specified at the same time")
@@ -1574,6 +1949,7 @@ func readAndFillConfig(p params, writer outputWriter) (conf config, altered para
 
 		conf.GoogleAIAPIKey = p.Configuration.GoogleAIAPIKey
 		conf.GoogleCredentialsFilepath = nil
+		conf.apiKeys = nil
 	}
 	if conf.GoogleCredentialsFilepath != nil && p.Configuration.CredentialsFilepath == nil {
 		writer.verbose(
@@ -1595,6 +1971,7 @@ func readAndFillConfig(p params, writer outputWriter) (conf config, altered para
 
 		conf.GoogleCredentialsFilepath = p.Configuration.CredentialsFilepath
 		conf.GoogleAIAPIKey = nil
+		conf.apiKeys = nil
 	}
 
 	// fallback to default values
@@ -1616,6 +1993,59 @@ func readAndFillConfig(p params, writer outputWriter) (conf config, altered para
 	if p.Generation.Video.FPS == 0 {
 		p.Generation.Video.FPS = defaultGeneratedVideosFPS
 	}
+	if p.Tools.MaxResultBytes <= 0 {
+		p.Tools.MaxResultBytes = defaultMaxToolResultBytes
+	}
+	if p.Tools.MaxResultMediaBytes <= 0 {
+		p.Tools.MaxResultMediaBytes = defaultMaxToolResultMediaBytes
+	}
+	if p.MCPTools.SelfInlineMediaMaxBytes <= 0 {
+		p.MCPTools.SelfInlineMediaMaxBytes = defaultSelfInlineMediaMaxBytes
+	}
+	if len(p.MCPTools.SelfTools) == 0 && len(conf.MCPSelfTools) > 0 {
+		p.MCPTools.SelfTools = conf.MCPSelfTools
+	}
+	if len(p.MCPTools.SelfExcludeTools) == 0 && len(conf.MCPSelfExcludeTools) > 0 {
+		p.MCPTools.SelfExcludeTools = conf.MCPSelfExcludeTools
+	}
+	if p.Generation.DetailedOptions.ThoughtsTo != nil {
+		p.Generation.ThinkingOn = true
+	}
+	if len(conf.SafetySettings) > 0 {
+		settings := maps.Clone(conf.SafetySettings)
+		maps.Copy(settings, p.Generation.DetailedOptions.SafetySettings)
+		p.Generation.DetailedOptions.SafetySettings = settings
+	}
+	if p.Generation.Retry.MaxRetries <= 0 && conf.Retries > 0 {
+		p.Generation.Retry.MaxRetries = conf.Retries
+	}
+	if p.Generation.Retry.DelaySeconds <= 0 {
+		p.Generation.Retry.DelaySeconds = conf.RetryDelaySeconds
+		if p.Generation.Retry.DelaySeconds <= 0 {
+			p.Generation.Retry.DelaySeconds = defaultRetryDelaySeconds
+		}
+	}
+	if p.Generation.Retry.MaxDelaySeconds <= 0 {
+		p.Generation.Retry.MaxDelaySeconds = conf.RetryMaxDelaySeconds
+		if p.Generation.Retry.MaxDelaySeconds <= 0 {
+			p.Generation.Retry.MaxDelaySeconds = defaultRetryMaxDelaySeconds
+		}
+	}
+	if len(p.Generation.Retry.FallbackModels) == 0 && len(conf.FallbackModels) > 0 {
+		p.Generation.Retry.FallbackModels = conf.FallbackModels
+	}
+	if !p.Generation.RenderMarkdown && conf.RenderMarkdown {
+		p.Generation.RenderMarkdown = true
+	}
+	if !p.MCPTools.SelfReadOnly && conf.MCPSelfReadOnly {
+		p.MCPTools.SelfReadOnly = true
+	}
+	if p.MCPTools.PromptsDirectory == nil && conf.MCPPromptsDirectory != nil {
+		p.MCPTools.PromptsDirectory = conf.MCPPromptsDirectory
+	}
+	if p.MCPTools.STDIOStderrDir == nil && conf.MCPStdioStderrDirectory != nil {
+		p.MCPTools.STDIOStderrDir = conf.MCPStdioStderrDirectory
+	}
 	if conf.TimeoutSeconds <= 0 {
 		conf.TimeoutSeconds = defaultTimeoutSeconds
 	}
@@ -6,8 +6,13 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"os"
+	"path/filepath"
+	"regexp"
 	"slices"
+	"strings"
 	"testing"
 	"time"
 )
@@ -175,3 +180,212 @@ func TestRunShellCommandWithContextTimeout(t *testing.T) {
 		t.Errorf("expected context deadline exceeded, got %v", ctx.Err())
 	}
 }
+
+// test `shortenToolResult` and `readLinesInRange` with an oversized result
+func TestShortenToolResultAndReadLinesInRange(t *testing.T) {
+	lines := []string{}
+	for i := 1; i <= 1000; i++ {
+		lines = append(lines, fmt.Sprintf("line %d", i))
+	}
+	result := strings.Join(lines, "\n")
+
+	// small results are not shortened
+	if shortened, saved, err := shortenToolResult("fn", "small", 100, ""); err != nil || shortened != "small" || saved != "" {
+		t.Errorf("expected small result not to be shortened, got: %q, %q, %v", shortened, saved, err)
+	}
+
+	// large results are shortened and saved to a file
+	shortened, saved, err := shortenToolResult("fn", result, 200, "gmn_read_file_range")
+	if err != nil {
+		t.Fatalf("failed to shorten result: %s", err)
+	}
+	defer func() { _ = os.Remove(saved) }()
+
+	if !strings.HasPrefix(shortened, "line 1\n") || !strings.HasSuffix(shortened, "line 1000") {
+		t.Errorf("expected head and tail in the shortened result, got: %q", shortened)
+	}
+	if !strings.Contains(shortened, saved) {
+		t.Errorf("expected saved filepath '%s' in the shortened result", saved)
+	}
+	if !strings.Contains(shortened, "'gmn_read_file_range'") {
+		t.Errorf("expected the tool for reading ranges in the shortened result, got: %q", shortened)
+	}
+
+	// tools which are not exposed are not mentioned
+	if shortened, saved, err := shortenToolResult("fn", result, 200, ""); err != nil {
+		t.Errorf("failed to shorten result: %s", err)
+	} else {
+		defer func() { _ = os.Remove(saved) }()
+
+		if strings.Contains(shortened, "gmn_read_file_range") {
+			t.Errorf("expected no tool for reading ranges in the shortened result, got: %q", shortened)
+		}
+	}
+
+	// read lines in range from the saved file
+	read, endLine, totalLines, truncated, err := readLinesInRange(saved, 10, 3, 0)
+	if err != nil {
+		t.Fatalf("failed to read lines in range: %s", err)
+	}
+	if read != "line 10\nline 11\nline 12\n" || endLine != 12 || totalLines != 1000 || truncated {
+		t.Errorf("unexpected lines in range: %q (end: %d, total: %d, truncated: %v)", read, endLine, totalLines, truncated)
+	}
+
+	// read lines are limited by size
+	read, endLine, _, truncated, err = readLinesInRange(saved, 1, 100, 21)
+	if err != nil {
+		t.Fatalf("failed to read lines in range: %s", err)
+	}
+	if read != "line 1\nline 2\nline 3\n" || endLine != 3 || !truncated {
+		t.Errorf("unexpected size-limited lines: %q (end: %d, truncated: %v)", read, endLine, truncated)
+	}
+
+	// saved files are removed with the directory of this run
+	if dir, err := toolResultsDir(); err != nil || filepath.Dir(saved) != dir {
+		t.Errorf("expected saved file in the directory of this run '%s', got '%s' (%v)", dir, saved, err)
+	}
+	removeToolResultsDir()
+	if _, err := os.Stat(saved); !os.IsNotExist(err) {
+		t.Errorf("expected saved file to be removed, got: %v", err)
+	}
+}
+
+// test `maxFileRangeBytes` with various maximum sizes of tool results
+func TestMaxFileRangeBytes(t *testing.T) {
+	type test struct {
+		maxResultBytes int
+		expected       int
+	}
+
+	tests := []test{
+		{maxResultBytes: 1000, expected: 500},
+		{maxResultBytes: 0, expected: defaultMaxToolResultBytes / 2},
+		{maxResultBytes: -1, expected: defaultMaxToolResultBytes / 2},
+	}
+
+	for _, test := range tests {
+		if maxBytes := maxFileRangeBytes(test.maxResultBytes); maxBytes != test.expected {
+			t.Errorf("expected %d for %d, got %d", test.expected, test.maxResultBytes, maxBytes)
+		}
+	}
+}
+
+// test `searchFiles` with large files, long lines, and limits
+func TestSearchFiles(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"small.txt": "hello\nworld\nhello again\n",
+		"long.txt":  "hello " + strings.Repeat("x", maxSearchFilesLineBytes*2) + "\n",
+		"large.txt": strings.Repeat("hello\n", maxSearchFilesFileBytes/6+1),
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatalf("failed to write file: %s", err)
+		}
+	}
+	re := regexp.MustCompile(`hello`)
+
+	type test struct {
+		glob                 string
+		maxMatches, maxBytes int
+
+		expectedMatches   int
+		expectedTruncated bool
+	}
+
+	tests := []test{
+		// should skip large files
+		{glob: "*.txt", maxMatches: 100, expectedMatches: 3},
+		// should stop at the maximum number of matches
+		{glob: "*.txt", maxMatches: 2, expectedMatches: 2, expectedTruncated: true},
+		// should stop at the maximum bytes
+		{glob: "small.txt", maxMatches: 100, maxBytes: len(filepath.Join(dir, "small.txt")) + 10, expectedMatches: 1, expectedTruncated: true},
+	}
+
+	for _, test := range tests {
+		matches, truncated, err := searchFiles(context.Background(), dir, re, test.glob, 0, test.maxMatches, test.maxBytes)
+		if err != nil {
+			t.Errorf("failed to search files: %s", err)
+			continue
+		}
+		if len(matches) != test.expectedMatches || truncated != test.expectedTruncated {
+			t.Errorf("expected %d matches (truncated: %t), got %d (truncated: %t): %+v", test.expectedMatches, test.expectedTruncated, len(matches), truncated, matches)
+		}
+		for _, match := range matches {
+			if filepath.Base(match.Filepath) == "large.txt" {
+				t.Errorf("expected large files to be skipped")
+			}
+			if len(match.Text) > maxSearchFilesLineBytes+len(" [...]") {
+				t.Errorf("expected long lines to be truncated, got %d bytes", len(match.Text))
+			}
+		}
+	}
+}
+
+// test `resolveClientCredentials` with various configs
+func TestResolveClientCredentials(t *testing.T) {
+	credentialsFilepath := filepath.Join(t.TempDir(), "credentials.json")
+	if err := os.WriteFile(credentialsFilepath, []byte(`{"type": "service_account"}`), 0o600); err != nil {
+		t.Fatalf("failed to write credentials file: %s", err)
+	}
+
+	type test struct {
+		conf config
+
+		expectedVertex bool
+		expectedError  error
+	}
+
+	tests := []test{
+		// api key takes precedence
+		{
+			conf: config{
+				GoogleAIAPIKey:            new("xyz"),
+				GoogleCredentialsFilepath: &credentialsFilepath,
+			},
+		},
+		// credentials file with location and bucket name
+		{
+			conf: config{
+				GoogleCredentialsFilepath: &credentialsFilepath,
+				Location:                  new("us-central1"),
+				GoogleCloudStorageBucketNameForFileUploads: new("bucket"),
+			},
+			expectedVertex: true,
+		},
+		// no such credentials file
+		{
+			conf: config{
+				GoogleCredentialsFilepath: new(filepath.Join(t.TempDir(), "no_such_file.json")),
+			},
+			expectedError: os.ErrNotExist,
+		},
+		// no credentials
+		{
+			conf:          config{},
+			expectedError: errNoCredentials,
+		},
+	}
+
+	for _, test := range tests {
+		creds, err := resolveClientCredentials(test.conf)
+		if test.expectedError != nil {
+			if !errors.Is(err, test.expectedError) {
+				t.Errorf("expected error %v, got %v", test.expectedError, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("failed to resolve credentials: %s", err)
+			continue
+		}
+		if creds.isVertex() != test.expectedVertex {
+			t.Errorf("expected vertex: %t, got %+v", test.expectedVertex, creds)
+		}
+		if test.expectedVertex && (creds.location != "us-central1" || creds.bucketName != "bucket") {
+			t.Errorf("expected location and bucket name, got %+v", creds)
+		} else if !test.expectedVertex && creds.apiKey != "xyz" {
+			t.Errorf("expected api key, got %+v", creds)
+		}
+	}
+}
@@ -0,0 +1,260 @@
+// localtools.go
+//
+// Things for exposing local tools (`--tools` and `--tool-callbacks`) through the self MCP server.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"google.golang.org/genai"
+)
+
+const (
+	localToolResourceURIPrefix = "gmn://callbacks/"
+)
+
+// tools for local function declarations which have their callbacks
+func localToolsForSelfServer(
+	writer outputWriter,
+	p params,
+) ([]toolAndHandler, error) {
+	toolsAndHandlers := make([]toolAndHandler, 0)
+
+	var tools []genai.Tool
+	if err := unmarshalJSONFromBytes(p.LocalTools.Tools, &tools); err != nil {
+		return nil, fmt.Errorf("failed to read tools: %w", err)
+	}
+
+	for _, tool := range tools {
+		for _, decl := range tool.FunctionDeclarations {
+			if decl == nil {
+				continue
+			}
+
+			// only the ones with callbacks can be run
+			callbackPath, exists := p.LocalTools.ToolCallbacks[decl.Name]
+			if !exists {
+				writer.warn(
+					"Not exposing local tool '%s' as it has no callback.",
+					decl.Name,
+				)
+				continue
+			}
+			if callbackPath == fnCallbackStdin { // (stdin is used for MCP transport)
+				writer.warn(
+					"Not exposing local tool '%s' as its callback '%s' cannot be used in MCP server.",
+					decl.Name,
+					fnCallbackStdin,
+				)
+				continue
+			}
+
+			inputSchema, err := inputSchemaFromFunctionDeclaration(decl)
+			if err != nil {
+				return nil, fmt.Errorf("failed to convert schema of local tool '%s': %w", decl.Name, err)
+			}
+
+			// callbacks which need confirmation are marked as destructive,
+			// so that clients could ask for confirmation
+			annotations := &mcp.ToolAnnotations{}
+			if p.LocalTools.ToolCallbacksConfirm[decl.Name] {
+				annotations.DestructiveHint = new(true)
+			}
+
+			toolsAndHandlers = append(toolsAndHandlers, toolAndHandler{
+				tool: mcp.Tool{
+					Name:        decl.Name,
+					Description: decl.Description,
+					InputSchema: inputSchema,
+					Annotations: annotations,
+				},
+				handler: localToolHandler(
+					writer,
+					p,
+					decl.Name,
+					callbackPath,
+				),
+			})
+		}
+	}
+
+	return toolsAndHandlers, nil
+}
+
+// handler for running the callback of a local tool
+func localToolHandler(
+	writer outputWriter,
+	p params,
+	fnName string,
+	callbackPath string,
+) mcp.ToolHandler {
+	return func(
+		ctx context.Context,
+		request *mcp.CallToolRequest,
+	) (result *mcp.CallToolResult, err error) {
+		// convert arguments
+		var args map[string]any
+		if err = json.Unmarshal(request.Params.Arguments, &args); err != nil {
+			return mcpErrorResult(
+				"Failed to convert arguments to `%T`: %s",
+				args,
+				err,
+			)
+		}
+
+		// (confirmation is up to the client)
+		fnCallback, _ := checkCallbackPath(
+			ctx,
+			writer,
+			callbackPath,
+			nil,
+			true,
+			&genai.FunctionCall{
+				Name: fnName,
+				Args: args,
+			},
+			p.Verbose,
+		)
+
+		var res string
+		if res, err = fnCallback(); err != nil {
+			return mcpErrorResult(
+				"Tool callback of '%s' failed: %s",
+				fnName,
+				err,
+			)
+		}
+
+		// when a mime type is declared for this callback, treat its output as media
+		if mimeType, exists := p.LocalTools.ToolCallbacksMIMEType[fnName]; exists {
+			var content mcp.Content
+			switch {
+			case strings.HasPrefix(mimeType, "image/"):
+				content = &mcp.ImageContent{
+					Data:     []byte(res),
+					MIMEType: mimeType,
+				}
+			case strings.HasPrefix(mimeType, "audio/"):
+				content = &mcp.AudioContent{
+					Data:     []byte(res),
+					MIMEType: mimeType,
+				}
+			default:
+				content = &mcp.EmbeddedResource{
+					Resource: &mcp.ResourceContents{
+						URI:      localToolResourceURIPrefix + fnName,
+						MIMEType: mimeType,
+						Blob:     []byte(res),
+					},
+				}
+			}
+
+			return &mcp.CallToolResult{
+				Content: []mcp.Content{content},
+			}, nil
+		}
+
+		return mcpTextResult(res)
+	}
+}
+
+// convert the parameters of given function declaration to a JSON Schema
+func inputSchemaFromFunctionDeclaration(
+	decl *genai.FunctionDeclaration,
+) (*jsonschema.Schema, error) {
+	var schema *jsonschema.Schema
+
+	if decl.ParametersJsonSchema != nil { // already in JSON Schema
+		marshalled, err := json.Marshal(decl.ParametersJsonSchema)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal JSON Schema: %w", err)
+		}
+		if err := json.Unmarshal(marshalled, &schema); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal JSON Schema: %w", err)
+		}
+	} else if decl.Parameters != nil {
+		schema = jsonSchemaFromGenaiSchema(decl.Parameters)
+	}
+
+	// MCP requires an object type for input schemas
+	if schema == nil {
+		schema = &jsonschema.Schema{}
+	}
+	if schema.Type == "" && len(schema.Types) == 0 {
+		schema.Type = "object"
+	}
+
+	return schema, nil
+}
+
+// convert given `genai.Schema` to a JSON Schema
+func jsonSchemaFromGenaiSchema(s *genai.Schema) *jsonschema.Schema {
+	if s == nil {
+		return nil
+	}
+
+	converted := &jsonschema.Schema{
+		Title:         s.Title,
+		Description:   s.Description,
+		Format:        s.Format,
+		Pattern:       s.Pattern,
+		Required:      s.Required,
+		Minimum:       s.Minimum,
+		Maximum:       s.Maximum,
+		MinItems:      intPtr(s.MinItems),
+		MaxItems:      intPtr(s.MaxItems),
+		MinLength:     intPtr(s.MinLength),
+		MaxLength:     intPtr(s.MaxLength),
+		MinProperties: intPtr(s.MinProperties),
+		MaxProperties: intPtr(s.MaxProperties),
+		PropertyOrder: s.PropertyOrdering,
+		Items:         jsonSchemaFromGenaiSchema(s.Items),
+	}
+
+	// type (nullable ones can also be null)
+	if s.Type != "" && s.Type != genai.TypeUnspecified {
+		typ := strings.ToLower(string(s.Type))
+		if s.Nullable != nil && *s.Nullable && typ != "null" {
+			converted.Types = []string{typ, "null"}
+		} else {
+			converted.Type = typ
+		}
+	}
+
+	for _, e := range s.Enum {
+		converted.Enum = append(converted.Enum, e)
+	}
+	if s.Default != nil {
+		if marshalled, err := json.Marshal(s.Default); err == nil {
+			converted.Default = marshalled
+		}
+	}
+	if s.Example != nil {
+		converted.Examples = []any{s.Example}
+	}
+	if len(s.Properties) > 0 {
+		converted.Properties = map[string]*jsonschema.Schema{}
+		for k, v := range s.Properties {
+			converted.Properties[k] = jsonSchemaFromGenaiSchema(v)
+		}
+	}
+	for _, a := range s.AnyOf {
+		converted.AnyOf = append(converted.AnyOf, jsonSchemaFromGenaiSchema(a))
+	}
+
+	return converted
+}
+
+// convert given *int64 to *int
+func intPtr(i *int64) *int {
+	if i == nil {
+		return nil
+	}
+	return new(int(*i))
+}
@@ -0,0 +1,119 @@
+// localtools_test.go
+//
+// Things for testing `localtools.go`.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"google.golang.org/genai"
+)
+
+// test `inputSchemaFromFunctionDeclaration` with various declarations
+func TestInputSchemaFromFunctionDeclaration(t *testing.T) {
+	type test struct {
+		decl     *genai.FunctionDeclaration
+		expected string
+	}
+
+	tests := []test{
+		// should convert genai schema to JSON Schema
+		{
+			decl: &genai.FunctionDeclaration{
+				Name: "count_lines_of_file",
+				Parameters: &genai.Schema{
+					Type: genai.TypeObject,
+					Properties: map[string]*genai.Schema{
+						"filepath": {
+							Type:        genai.TypeString,
+							Description: "path of a file",
+						},
+						"encodings": {
+							Type:     genai.TypeArray,
+							Items:    &genai.Schema{Type: genai.TypeString, Enum: []string{"utf-8", "euc-kr"}},
+							MaxItems: new(int64(2)),
+						},
+						"limit": {
+							Type:     genai.TypeInteger,
+							Nullable: new(true),
+						},
+					},
+					Required: []string{"filepath"},
+				},
+			},
+			expected: `{"type":"object","properties":{"encodings":{"type":"array","items":{"type":"string","enum":["utf-8","euc-kr"]},"maxItems":2},"filepath":{"type":"string","description":"path of a file"},"limit":{"type":["integer","null"]}},"required":["filepath"]}`,
+		},
+		// should use JSON Schema as it is
+		{
+			decl: &genai.FunctionDeclaration{
+				Name: "greet",
+				ParametersJsonSchema: map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"name": map[string]any{"type": "string"},
+					},
+				},
+			},
+			expected: `{"type":"object","properties":{"name":{"type":"string"}}}`,
+		},
+		// should fallback to an empty object
+		{
+			decl: &genai.FunctionDeclaration{
+				Name: "render_sales_chart",
+			},
+			expected: `{"type":"object"}`,
+		},
+	}
+
+	for _, test := range tests {
+		schema, err := inputSchemaFromFunctionDeclaration(test.decl)
+		if err != nil {
+			t.Errorf("failed to convert schema of '%s': %s", test.decl.Name, err)
+			continue
+		}
+
+		marshalled, err := json.Marshal(schema)
+		if err != nil {
+			t.Errorf("failed to marshal schema of '%s': %s", test.decl.Name, err)
+			continue
+		}
+		if string(marshalled) != test.expected {
+			t.Errorf("expected '%s', got '%s'", test.expected, string(marshalled))
+		}
+	}
+}
+
+// test that `localToolHandler` kills the callback when the request is cancelled
+func TestLocalToolHandlerCancellation(t *testing.T) {
+	script := filepath.Join(t.TempDir(), "slow.sh")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\nsleep 5\necho done\n"), 0o755); err != nil {
+		t.Fatalf("failed to write script: %s", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	handler := localToolHandler(newStdoutWriter(), params{}, "slow", script)
+	started := time.Now()
+	result, err := handler(ctx, &mcp.CallToolRequest{
+		Params: &mcp.CallToolParamsRaw{
+			Arguments: json.RawMessage(`{}`),
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !result.IsError {
+		t.Errorf("expected an error result for the cancelled callback, got %+v", result)
+	}
+	if elapsed := time.Since(started); elapsed > 3*time.Second {
+		t.Errorf("expected the callback to be killed on cancellation, took %s", elapsed)
+	}
+}
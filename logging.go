@@ -52,6 +52,7 @@ type outputWriter interface {
 	error(format string, a ...any)                                                      // print given error string to error output (will add a new line if there isn't)
 	printHelpBeforeExit(code int, parser *flags.Parser) int                             // print help message to error output before os.Exit()
 	printErrorBeforeExit(code int, format string, a ...any) int                         // print error string to error output before os.Exit()
+	emit(eventType outputEventType, fields map[string]any)                              // emit an event to output (only for event stream outputs)
 }
 
 // output writer for printing to stdout/stderr
@@ -249,6 +250,13 @@ func (w *stdoutWriter) printErrorBeforeExit(
 	return code
 }
 
+// do nothing, as events are not emitted to stdout in text
+func (w *stdoutWriter) emit(
+	eventType outputEventType,
+	fields map[string]any,
+) {
+}
+
 // sprintf given string with color (if possible)
 func colorizef(
 	c color.Attribute,
@@ -10,8 +10,6 @@ import (
 	"strings"
 
 	"github.com/jessevdk/go-flags"
-
-	gt "github.com/meinside/gemini-things-go"
 )
 
 const (
@@ -30,6 +28,39 @@ func main() {
 		flags.HelpFlag|flags.PassDoubleDash,
 	)
 	if remaining, err := parser.Parse(); err == nil {
+		// output format
+		if p.Generation.OutputFormat != nil {
+			switch *p.Generation.OutputFormat {
+			case outputFormatText:
+			case outputFormatNDJSON:
+				writer = newNDJSONWriter()
+
+				// NOTE: images cannot be displayed on terminal with event streams
+				p.Generation.Image.SaveToFiles = true
+			default:
+				writer.printWithColorForLevel(
+					verboseMaximum,
+					"Input error: unsupported output format: %s",
+					*p.Generation.OutputFormat,
+				)
+
+				os.Exit(writer.printHelpBeforeExit(exitCodeBadInput, parser))
+			}
+		}
+
+		// error format
+		if p.ErrorFormat != nil &&
+			*p.ErrorFormat != errorFormatText &&
+			*p.ErrorFormat != errorFormatJSON {
+			writer.printWithColorForLevel(
+				verboseMaximum,
+				"Input error: unsupported error format: %s",
+				*p.ErrorFormat,
+			)
+
+			os.Exit(writer.printHelpBeforeExit(exitCodeBadInput, parser))
+		}
+
 		// check if multiple tasks were requested at a time
 		if p.multipleTasksRequested() {
 			writer.printWithColorForLevel(
@@ -37,7 +68,7 @@ func main() {
 				"Input error: multiple tasks were requested at a time.",
 			)
 
-			os.Exit(writer.printHelpBeforeExit(1, parser))
+			os.Exit(writer.printHelpBeforeExit(exitCodeBadInput, parser))
 		}
 
 		// check if multiple media types were requested at a time
@@ -47,7 +78,7 @@ func main() {
 				"Input error: multiple media types were requested at a time.",
 			)
 
-			os.Exit(writer.printHelpBeforeExit(1, parser))
+			os.Exit(writer.printHelpBeforeExit(exitCodeBadInput, parser))
 
 		}
 
@@ -59,18 +90,15 @@ func main() {
 				strings.Join(remaining, " "),
 			)
 
-			os.Exit(writer.printHelpBeforeExit(1, parser))
+			os.Exit(writer.printHelpBeforeExit(exitCodeBadInput, parser))
 		}
 
 		if p.MCPTools.RunAsStandaloneSTDIOServer { // run as a MCP server?
 			// then serve as a MCP server
 			exit, err := serve(writer, p)
+			removeToolResultsDir()
 			if err != nil {
-				os.Exit(writer.printErrorBeforeExit(
-					exit,
-					"Error: %s",
-					err,
-				))
+				os.Exit(printErrorBeforeExit(writer, p, exit, err))
 			} else {
 				os.Exit(exit)
 			}
@@ -100,42 +128,25 @@ func main() {
 
 			// run with params
 			exit, err := run(parser, writer, p)
+			removeToolResultsDir()
 
 			if err != nil {
-				if gt.IsQuotaExceeded(err) {
-					os.Exit(writer.printErrorBeforeExit(
-						exit,
-						"API quota exceeded, try again later: %s",
-						err,
-					))
-				} else if gt.IsModelOverloaded(err) {
-					os.Exit(writer.printErrorBeforeExit(
-						exit,
-						"Model overloaded, try again later: %s",
-						err,
-					))
-				} else {
-					os.Exit(writer.printErrorBeforeExit(
-						exit,
-						"Error: %s",
-						err,
-					))
-				}
+				os.Exit(printErrorBeforeExit(writer, p, exit, err))
 			} else {
 				os.Exit(exit)
 			}
 
 			// should not reach here
 			os.Exit(writer.printErrorBeforeExit(
-				1,
+				exitCodeGeneral,
 				"Unhandled error.",
 			))
 		}
 	} else {
 		if e, ok := err.(*flags.Error); ok {
-			helpExitCode := 0
+			helpExitCode := exitCodeSuccess
 			if e.Type != flags.ErrHelp {
-				helpExitCode = 1
+				helpExitCode = exitCodeBadInput
 
 				writer.printWithColorForLevel(
 					verboseMedium,
@@ -151,7 +162,7 @@ func main() {
 		}
 
 		os.Exit(writer.printErrorBeforeExit(
-			1,
+			exitCodeBadInput,
 			"Failed to parse flags: %s",
 			err,
 		))
@@ -0,0 +1,495 @@
+// markdown.go
+//
+// Things for rendering Markdown texts on terminals (`--render-markdown`).
+
+package main
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/fatih/color"
+	"github.com/jwalton/go-supportscolor"
+)
+
+// markdown styles
+var (
+	mdStyleHeading1   = color.New(color.Bold, color.Underline, color.FgHiMagenta)
+	mdStyleHeading2   = color.New(color.Bold, color.FgHiBlue)
+	mdStyleHeadingN   = color.New(color.Bold, color.FgHiCyan)
+	mdStyleText       = color.New(color.FgHiWhite)
+	mdStyleBold       = color.New(color.Bold, color.FgHiWhite)
+	mdStyleItalic     = color.New(color.Italic, color.FgHiWhite)
+	mdStyleStrike     = color.New(color.CrossedOut, color.FgWhite)
+	mdStyleInlineCode = color.New(color.FgHiYellow)
+	mdStyleLinkText   = color.New(color.Underline, color.FgHiBlue)
+	mdStyleDimmed     = color.New(color.Faint, color.FgWhite)
+	mdStyleBullet     = color.New(color.FgHiCyan)
+	mdStyleQuote      = color.New(color.Italic, color.FgWhite)
+
+	mdStyleCodeKeyword = color.New(color.FgHiBlue)
+	mdStyleCodeString  = color.New(color.FgGreen)
+	mdStyleCodeNumber  = color.New(color.FgMagenta)
+	mdStyleCodeComment = color.New(color.Faint, color.Italic, color.FgWhite)
+	mdStyleCodePlain   = color.New(color.FgWhite)
+)
+
+// regular expressions for markdown syntaxes
+var (
+	mdRegexHeading    = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*\s*$`)
+	mdRegexRule       = regexp.MustCompile(`^\s{0,3}(-(\s*-){2,}|\*(\s*\*){2,}|_(\s*_){2,})\s*$`)
+	mdRegexFence      = regexp.MustCompile("^\\s{0,3}(`{3,}|~{3,})\\s*([^`\\s]*)")
+	mdRegexQuote      = regexp.MustCompile(`^\s{0,3}>\s?(.*)$`)
+	mdRegexTaskItem   = regexp.MustCompile(`^(\s*)[-*+]\s+\[([ xX])\]\s+(.*)$`)
+	mdRegexBulletItem = regexp.MustCompile(`^(\s*)[-*+]\s+(.*)$`)
+	mdRegexOrderItem  = regexp.MustCompile(`^(\s*)(\d+[.)])\s+(.*)$`)
+	mdRegexTableSep   = regexp.MustCompile(`^\s*\|?\s*:?-+:?\s*(\|\s*:?-+:?\s*)*\|?\s*$`)
+
+	mdRegexInlineCode = regexp.MustCompile("`[^`]+`")
+	mdRegexLink       = regexp.MustCompile(`!?\[([^\]]+)\]\(([^)\s]+)[^)]*\)`)
+	mdRegexBold       = regexp.MustCompile(`\*\*([^*]+)\*\*|__([^_]+)__`)
+	mdRegexItalic     = regexp.MustCompile(`\*([^*\s][^*]*)\*`)
+	mdRegexStrike     = regexp.MustCompile(`~~([^~]+)~~`)
+
+	mdRegexANSI = regexp.MustCompile("\x1b\\[[0-9;]*m")
+)
+
+// check if generated texts should be rendered as markdown with given params
+//
+// (only when stdout is a terminal, and the output is neither JSON nor events)
+func shouldRenderMarkdown(p params) bool {
+	return p.Generation.RenderMarkdown &&
+		!p.outputAsJSON() &&
+		p.Generation.ResponseSchema == nil &&
+		supportscolor.Stdout().SupportsColor
+}
+
+// markdown renderer which renders streamed texts line by line
+//
+// (incomplete lines are buffered until they are completed or flushed,
+// and tables are buffered until they end)
+type markdownRenderer struct {
+	print func(rendered string)
+
+	partial strings.Builder // incomplete line
+
+	inCodeBlock  bool
+	codeFence    string
+	codeLanguage string
+
+	tableRows [][]string
+}
+
+// generate a new markdown renderer which prints rendered texts with given function
+func newMarkdownRenderer(print func(rendered string)) *markdownRenderer {
+	return &markdownRenderer{
+		print: print,
+	}
+}
+
+// write given (partial) text to the renderer
+//
+// (only completed lines are rendered and printed)
+func (r *markdownRenderer) write(text string) {
+	for {
+		line, rest, found := strings.Cut(text, "\n")
+		if !found {
+			r.partial.WriteString(text)
+			return
+		}
+
+		r.partial.WriteString(line)
+		r.renderLine(r.partial.String())
+		r.partial.Reset()
+
+		text = rest
+	}
+}
+
+// render and print all buffered things
+//
+// (an incomplete line is rendered without a trailing new line)
+func (r *markdownRenderer) flush() {
+	if r.partial.Len() > 0 {
+		line := r.partial.String()
+		r.partial.Reset()
+
+		if !r.inCodeBlock && isMarkdownTableRow(line) {
+			r.tableRows = append(r.tableRows, splitMarkdownTableRow(line))
+			r.flushTable()
+		} else {
+			r.flushTable()
+			r.print(r.renderBlock(line))
+		}
+	} else {
+		r.flushTable()
+	}
+}
+
+// render a completed line
+func (r *markdownRenderer) renderLine(line string) {
+	if !r.inCodeBlock && isMarkdownTableRow(line) {
+		if !mdRegexTableSep.MatchString(line) {
+			r.tableRows = append(r.tableRows, splitMarkdownTableRow(line))
+		}
+		return
+	}
+	r.flushTable()
+
+	r.print(r.renderBlock(line) + "\n")
+}
+
+// render a line of block
+func (r *markdownRenderer) renderBlock(line string) string {
+	// code blocks
+	if r.inCodeBlock {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, r.codeFence) && strings.Trim(trimmed, r.codeFence[:1]) == "" {
+			r.inCodeBlock = false
+			return mdStyleDimmed.Sprint("└───")
+		}
+		return mdStyleDimmed.Sprint("│ ") + highlightCode(line, r.codeLanguage)
+	}
+	if matches := mdRegexFence.FindStringSubmatch(line); matches != nil {
+		r.inCodeBlock = true
+		r.codeFence = matches[1]
+		r.codeLanguage = strings.ToLower(matches[2])
+		return mdStyleDimmed.Sprint("┌─── " + r.codeLanguage)
+	}
+
+	// headings
+	if matches := mdRegexHeading.FindStringSubmatch(line); matches != nil {
+		style := mdStyleHeadingN
+		switch len(matches[1]) {
+		case 1:
+			style = mdStyleHeading1
+		case 2:
+			style = mdStyleHeading2
+		}
+		return style.Sprint(stripInlineMarkdown(matches[2]))
+	}
+
+	// horizontal rules
+	if mdRegexRule.MatchString(line) {
+		return mdStyleDimmed.Sprint(strings.Repeat("─", 40))
+	}
+
+	// block quotes
+	if matches := mdRegexQuote.FindStringSubmatch(line); matches != nil {
+		return mdStyleDimmed.Sprint("│ ") + renderInlineMarkdown(matches[1], mdStyleQuote)
+	}
+
+	// list items
+	if matches := mdRegexTaskItem.FindStringSubmatch(line); matches != nil {
+		box := "☐"
+		if matches[2] != " " {
+			box = "☑"
+		}
+		return matches[1] + mdStyleBullet.Sprint(box) + " " + renderInlineMarkdown(matches[3], mdStyleText)
+	}
+	if matches := mdRegexBulletItem.FindStringSubmatch(line); matches != nil {
+		return matches[1] + mdStyleBullet.Sprint("•") + " " + renderInlineMarkdown(matches[2], mdStyleText)
+	}
+	if matches := mdRegexOrderItem.FindStringSubmatch(line); matches != nil {
+		return matches[1] + mdStyleBullet.Sprint(matches[2]) + " " + renderInlineMarkdown(matches[3], mdStyleText)
+	}
+
+	// paragraphs
+	return renderInlineMarkdown(line, mdStyleText)
+}
+
+// render and print buffered table rows with aligned columns
+func (r *markdownRenderer) flushTable() {
+	if len(r.tableRows) == 0 {
+		return
+	}
+	rows := r.tableRows
+	r.tableRows = nil
+
+	// render cells and calculate widths of columns
+	rendered := make([][]string, len(rows))
+	widths := []int{}
+	for i, row := range rows {
+		rendered[i] = make([]string, len(row))
+		for j, cell := range row {
+			style := mdStyleText
+			if i == 0 {
+				style = mdStyleBold
+			}
+			rendered[i][j] = renderInlineMarkdown(cell, style)
+
+			if j >= len(widths) {
+				widths = append(widths, 0)
+			}
+			widths[j] = max(widths[j], visibleWidth(rendered[i][j]))
+		}
+	}
+
+	var sb strings.Builder
+	border := mdStyleDimmed.Sprint("│")
+	for i, row := range rendered {
+		sb.WriteString(border)
+		for j, width := range widths {
+			cell := ""
+			if j < len(row) {
+				cell = row[j]
+			}
+			sb.WriteString(" " + cell + strings.Repeat(" ", width-visibleWidth(cell)) + " " + border)
+		}
+		sb.WriteString("\n")
+
+		// separator between the header and the body
+		if i == 0 && len(rendered) > 1 {
+			segments := []string{}
+			for _, width := range widths {
+				segments = append(segments, strings.Repeat("─", width+2))
+			}
+			sb.WriteString(mdStyleDimmed.Sprint("├" + strings.Join(segments, "┼") + "┤"))
+			sb.WriteString("\n")
+		}
+	}
+
+	r.print(sb.String())
+}
+
+// check if given line is a row of table
+func isMarkdownTableRow(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	return len(trimmed) > 1 && strings.HasPrefix(trimmed, "|")
+}
+
+// split given table row into cells
+func splitMarkdownTableRow(line string) []string {
+	trimmed := strings.TrimSpace(line)
+	trimmed = strings.TrimPrefix(trimmed, "|")
+	trimmed = strings.TrimSuffix(trimmed, "|")
+
+	cells := []string{}
+	for cell := range strings.SplitSeq(trimmed, "|") {
+		cells = append(cells, strings.TrimSpace(cell))
+	}
+	return cells
+}
+
+// render inline syntaxes (code spans, links, bold, italic, and strikethrough) of given text with base style
+func renderInlineMarkdown(text string, base *color.Color) string {
+	var sb strings.Builder
+
+	// NOTE: code spans are not rendered further
+	last := 0
+	for _, loc := range mdRegexInlineCode.FindAllStringIndex(text, -1) {
+		sb.WriteString(renderEmphases(text[last:loc[0]], base))
+		sb.WriteString(mdStyleInlineCode.Sprint(text[loc[0]+1 : loc[1]-1]))
+		last = loc[1]
+	}
+	sb.WriteString(renderEmphases(text[last:], base))
+
+	return sb.String()
+}
+
+// render links and emphases of given text with base style
+func renderEmphases(text string, base *color.Color) string {
+	if text == "" {
+		return ""
+	}
+
+	// NOTE: styled segments end with a reset, so the base style is re-applied after them
+	resume := func(s string) string {
+		return s + startOfStyle(base)
+	}
+
+	text = mdRegexLink.ReplaceAllStringFunc(text, func(s string) string {
+		matches := mdRegexLink.FindStringSubmatch(s)
+		return resume(mdStyleLinkText.Sprint(matches[1]) + mdStyleDimmed.Sprint(" ("+matches[2]+")"))
+	})
+	text = mdRegexBold.ReplaceAllStringFunc(text, func(s string) string {
+		matches := mdRegexBold.FindStringSubmatch(s)
+		return resume(mdStyleBold.Sprint(matches[1] + matches[2]))
+	})
+	text = mdRegexStrike.ReplaceAllStringFunc(text, func(s string) string {
+		return resume(mdStyleStrike.Sprint(mdRegexStrike.FindStringSubmatch(s)[1]))
+	})
+	text = mdRegexItalic.ReplaceAllStringFunc(text, func(s string) string {
+		return resume(mdStyleItalic.Sprint(mdRegexItalic.FindStringSubmatch(s)[1]))
+	})
+
+	return base.Sprint(text)
+}
+
+// return the escape sequence which starts given style
+func startOfStyle(c *color.Color) string {
+	const marker = "\x00"
+	start, _, _ := strings.Cut(c.Sprint(marker), marker)
+	return start
+}
+
+// strip inline syntaxes of given text
+func stripInlineMarkdown(text string) string {
+	text = mdRegexInlineCode.ReplaceAllStringFunc(text, func(s string) string {
+		return s[1 : len(s)-1]
+	})
+	text = mdRegexLink.ReplaceAllString(text, "$1")
+	text = mdRegexBold.ReplaceAllString(text, "$1$2")
+	text = mdRegexStrike.ReplaceAllString(text, "$1")
+	text = mdRegexItalic.ReplaceAllString(text, "$1")
+	return text
+}
+
+// return the visible width of given text (without escape sequences)
+func visibleWidth(text string) int {
+	return utf8.RuneCountInString(mdRegexANSI.ReplaceAllString(text, ""))
+}
+
+// syntax of a programming language for highlighting codes
+type codeSyntax struct {
+	lineComments []string
+	keywords     map[string]struct{}
+}
+
+// generate a set of keywords from given space-separated string
+func keywordSet(keywords string) map[string]struct{} {
+	set := map[string]struct{}{}
+	for keyword := range strings.FieldsSeq(keywords) {
+		set[keyword] = struct{}{}
+	}
+	return set
+}
+
+// syntaxes of programming languages
+var (
+	codeSyntaxGo = codeSyntax{
+		lineComments: []string{"//"},
+		keywords:     keywordSet(`break case chan const continue default defer else fallthrough for func go goto if import interface map package range return select struct switch type var nil true false iota`),
+	}
+	codeSyntaxPython = codeSyntax{
+		lineComments: []string{"#"},
+		keywords:     keywordSet(`and as assert async await break class continue def del elif else except finally for from global if import in is lambda nonlocal not or pass raise return try while with yield None True False self`),
+	}
+	codeSyntaxJavaScript = codeSyntax{
+		lineComments: []string{"//"},
+		keywords:     keywordSet(`async await break case catch class const continue debugger default delete do else export extends finally for from function if import in instanceof interface let new of return static super switch this throw try type typeof var void while yield null undefined true false`),
+	}
+	codeSyntaxRust = codeSyntax{
+		lineComments: []string{"//"},
+		keywords:     keywordSet(`as async await break const continue crate else enum extern fn for if impl in let loop match mod move mut pub ref return self Self static struct super trait type unsafe use where while true false`),
+	}
+	codeSyntaxC = codeSyntax{
+		lineComments: []string{"//"},
+		keywords:     keywordSet(`auto break case catch char class const continue default delete do double else enum extends extern final finally float for fun goto if implements import int interface long namespace new null nullptr package private protected public return short signed sizeof static struct super switch template this throw try typedef union unsigned using val var void volatile while true false`),
+	}
+	codeSyntaxShell = codeSyntax{
+		lineComments: []string{"#"},
+		keywords:     keywordSet(`if then else elif fi for while until do done case esac in function return local export set unset echo exit`),
+	}
+	codeSyntaxSQL = codeSyntax{
+		lineComments: []string{"--"},
+		keywords:     keywordSet(`select from where and or not insert into values update set delete create table drop alter index join left right inner outer on group by order having limit offset as distinct null is in like primary key SELECT FROM WHERE AND OR NOT INSERT INTO VALUES UPDATE SET DELETE CREATE TABLE DROP ALTER INDEX JOIN LEFT RIGHT INNER OUTER ON GROUP BY ORDER HAVING LIMIT OFFSET AS DISTINCT NULL IS IN LIKE PRIMARY KEY`),
+	}
+	codeSyntaxData = codeSyntax{
+		lineComments: []string{"#"},
+		keywords:     keywordSet(`true false null`),
+	}
+	codeSyntaxPlain = codeSyntax{}
+)
+
+// return the syntax of given language (name or alias) of code blocks
+func codeSyntaxFor(language string) codeSyntax {
+	switch language {
+	case "go", "golang":
+		return codeSyntaxGo
+	case "python", "py":
+		return codeSyntaxPython
+	case "javascript", "js", "jsx", "typescript", "ts", "tsx":
+		return codeSyntaxJavaScript
+	case "rust", "rs":
+		return codeSyntaxRust
+	case "c", "h", "cpp", "c++", "cc", "java", "kotlin", "kt", "swift", "csharp", "cs", "c#", "dart", "scala":
+		return codeSyntaxC
+	case "bash", "sh", "shell", "zsh", "fish", "console":
+		return codeSyntaxShell
+	case "sql":
+		return codeSyntaxSQL
+	case "json", "jsonc", "yaml", "yml", "toml":
+		return codeSyntaxData
+	}
+	return codeSyntaxPlain
+}
+
+// highlight given line of code in given language
+//
+// (comments and strings spanning multiple lines are not tracked)
+func highlightCode(line, language string) string {
+	syntax := codeSyntaxFor(language)
+
+	var sb, plain strings.Builder
+	flushPlain := func() {
+		if plain.Len() > 0 {
+			sb.WriteString(mdStyleCodePlain.Sprint(plain.String()))
+			plain.Reset()
+		}
+	}
+
+	runes := []rune(line)
+	for i := 0; i < len(runes); {
+		rest := string(runes[i:])
+
+		// comments
+		isComment := false
+		for _, prefix := range syntax.lineComments {
+			if strings.HasPrefix(rest, prefix) {
+				isComment = true
+				break
+			}
+		}
+		if isComment {
+			flushPlain()
+			sb.WriteString(mdStyleCodeComment.Sprint(rest))
+			break
+		}
+
+		ch := runes[i]
+		switch {
+		case ch == '"' || ch == '\'' || ch == '`': // strings
+			j := i + 1
+			for j < len(runes) && runes[j] != ch {
+				if runes[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			j = min(j+1, len(runes))
+			flushPlain()
+			sb.WriteString(mdStyleCodeString.Sprint(string(runes[i:j])))
+			i = j
+		case unicode.IsDigit(ch): // numbers
+			j := i
+			for j < len(runes) && (unicode.IsDigit(runes[j]) || unicode.IsLetter(runes[j]) || runes[j] == '.' || runes[j] == '_') {
+				j++
+			}
+			flushPlain()
+			sb.WriteString(mdStyleCodeNumber.Sprint(string(runes[i:j])))
+			i = j
+		case unicode.IsLetter(ch) || ch == '_': // identifiers and keywords
+			j := i
+			for j < len(runes) && (unicode.IsLetter(runes[j]) || unicode.IsDigit(runes[j]) || runes[j] == '_') {
+				j++
+			}
+			word := string(runes[i:j])
+			if _, exists := syntax.keywords[word]; exists {
+				flushPlain()
+				sb.WriteString(mdStyleCodeKeyword.Sprint(word))
+			} else {
+				plain.WriteString(word)
+			}
+			i = j
+		default: // others
+			plain.WriteRune(ch)
+			i++
+		}
+	}
+	flushPlain()
+
+	return sb.String()
+}
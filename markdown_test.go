@@ -0,0 +1,120 @@
+// markdown_test.go
+//
+// Things for testing `markdown.go`.
+
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/fatih/color"
+)
+
+// test `markdownRenderer` with streamed chunks (without colors)
+func TestMarkdownRenderer(t *testing.T) {
+	noColor := color.NoColor
+	color.NoColor = true
+	defer func() { color.NoColor = noColor }()
+
+	type test struct {
+		chunks   []string
+		expected string
+	}
+
+	tests := []test{
+		{
+			chunks:   []string{"# Hel", "lo **wor", "ld**\n", "plain *text*"},
+			expected: "Hello world\nplain text",
+		},
+		{
+			chunks:   []string{"- one\n  * two\n", "3. three\n- [x] done\n"},
+			expected: "• one\n  • two\n3. three\n☑ done\n",
+		},
+		{
+			chunks:   []string{"see `a*b*c` and [docs](https://example.com)\n"},
+			expected: "see a*b*c and docs (https://example.com)\n",
+		},
+		{
+			chunks:   []string{"```go\nfunc", " main() {}\n```\n"},
+			expected: "┌─── go\n│ func main() {}\n└───\n",
+		},
+		{
+			chunks:   []string{"| a | bb |\n|---|:-:|\n| ccc | d |", "\nafter\n"},
+			expected: "│ a   │ bb │\n├─────┼────┤\n│ ccc │ d  │\nafter\n",
+		},
+		{
+			chunks:   []string{"| x | y |\n| 1 |"},
+			expected: "│ x │ y │\n├───┼───┤\n│ 1 │   │\n",
+		},
+	}
+
+	for _, test := range tests {
+		var sb strings.Builder
+		renderer := newMarkdownRenderer(func(rendered string) {
+			sb.WriteString(rendered)
+		})
+		for _, chunk := range test.chunks {
+			renderer.write(chunk)
+		}
+		renderer.flush()
+
+		if sb.String() != test.expected {
+			t.Errorf("expected '%s' for %q, got '%s'", test.expected, test.chunks, sb.String())
+		}
+	}
+}
+
+// test `highlightCode` with various languages
+func TestHighlightCode(t *testing.T) {
+	noColor := color.NoColor
+	color.NoColor = false
+	defer func() { color.NoColor = noColor }()
+
+	type test struct {
+		line     string
+		language string
+		styled   map[string]*color.Color
+	}
+
+	tests := []test{
+		{
+			line:     `func main() { // entry`,
+			language: "go",
+			styled: map[string]*color.Color{
+				"func":     mdStyleCodeKeyword,
+				"// entry": mdStyleCodeComment,
+			},
+		},
+		{
+			line:     `x = "a # b" # 42`,
+			language: "py",
+			styled: map[string]*color.Color{
+				`"a # b"`: mdStyleCodeString,
+				"# 42":    mdStyleCodeComment,
+			},
+		},
+		{
+			line:     `SELECT 1 -- one`,
+			language: "sql",
+			styled: map[string]*color.Color{
+				"SELECT": mdStyleCodeKeyword,
+				"1":      mdStyleCodeNumber,
+				"-- one": mdStyleCodeComment,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		highlighted := highlightCode(test.line, test.language)
+
+		if visible := mdRegexANSI.ReplaceAllString(highlighted, ""); visible != test.line {
+			t.Errorf("expected visible text '%s', got '%s'", test.line, visible)
+		}
+		for token, style := range test.styled {
+			if !strings.Contains(highlighted, style.Sprint(token)) {
+				t.Errorf("expected '%s' to be styled in '%s' (%s), got %q", token, test.line, test.language, highlighted)
+			}
+		}
+	}
+}
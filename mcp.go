@@ -8,6 +8,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"os"
@@ -37,62 +38,114 @@ const (
 	mcpDefaultExpectContinueTimeoutSeconds = 15
 
 	mcpDefaultMaxRetries = 3
+
+	mcpProgressIntervalSeconds = 5
+	mcpLoggerName              = `gmn`
 )
 
 // mcpConnectionDetails holds the details of an MCP server connection and its tools.
 type mcpConnectionDetails struct {
 	serverType mcpServerType
-	connection *mcp.ClientSession
+	connection *mcpServerConnection
 	tools      []*mcp.Tool
+
+	confirmHooks map[string]toolConfirmHook // (tool name => hook; only for tools of self)
 }
 
 // fetchAndRegisterMCPTools connects to an MCP server and fetches its tools.
+//
+// `stdioServer` is for stdio servers configured in the config file. (nil if `serverIdentifier` is a commandline)
+//
+// With `--mcp-lazy`, it uses tools cached from previous runs instead (if any),
+// and the connection will be established on the first tool call.
 func fetchAndRegisterMCPTools(
 	ctx context.Context,
 	writer outputWriter,
 	p params,
 	serverType mcpServerType,
 	serverIdentifier string,
+	stdioServer *mcpStdioServerConfig,
 ) (*mcpConnectionDetails, error) {
-	writer.verbose(
-		verboseMedium,
-		p.Verbose,
-		"fetching tools from MCP server: %s",
-		stripServerInfo(serverType, serverIdentifier),
-	)
+	cacheKey := mcpToolsCacheKey(serverIdentifier, stdioServer)
 
-	var mc *mcp.ClientSession
-	var err error
+	var connect mcpConnectFunc
 	switch serverType {
 	case mcpServerStreamable:
-		mc, err = mcpConnect(context.Background(), serverIdentifier)
+		connect = func(ctx context.Context) (*mcp.ClientSession, error) {
+			return mcpConnect(context.Background(), serverIdentifier)
+		}
 	case mcpServerStdio:
-		mc, err = mcpRun(context.Background(), serverIdentifier)
+		if stdioServer == nil {
+			stdioServer = &mcpStdioServerConfig{
+				Command: serverIdentifier,
+			}
+		}
+		connect = func(ctx context.Context) (*mcp.ClientSession, error) {
+			return mcpRun(context.Background(), writer, p, serverIdentifier, *stdioServer)
+		}
 	default:
 		return nil, fmt.Errorf("unsupported MCP server type: %v", serverType)
 	}
+	conn := newMCPServerConnection(writer, p, serverType, serverIdentifier, connect)
+
+	// use cached tools, (connect later)
+	if p.MCPTools.Lazy {
+		if cachedTools, err := readCachedMCPTools(cacheKey); err == nil {
+			writer.verbose(
+				verboseMinimum,
+				p.Verbose,
+				"MCP server '%s' will be connected on its first use (%d cached tools)",
+				conn.name(),
+				len(cachedTools),
+			)
+
+			return &mcpConnectionDetails{
+				serverType: serverType,
+				connection: conn,
+				tools:      cachedTools,
+			}, nil
+		}
+	}
 
+	writer.verbose(
+		verboseMedium,
+		p.Verbose,
+		"fetching tools from MCP server: %s",
+		conn.name(),
+	)
+
+	fetchedTools, err := conn.listTools(ctx)
 	if err != nil {
+		_ = conn.Close() // Ensure connection is closed on fetch error
 		return nil, fmt.Errorf(
-			"failed to connect to MCP server '%s': %w",
-			stripServerInfo(serverType, serverIdentifier),
+			"failed to fetch tools from MCP server '%s': %w",
+			conn.name(),
 			err,
 		)
 	}
 
-	fetchedTools, err := fetchMCPTools(ctx, mc)
-	if err != nil {
-		_ = mc.Close() // Ensure connection is closed on fetch error
-		return nil, fmt.Errorf(
-			"failed to fetch tools from MCP server '%s': %w",
-			stripServerInfo(serverType, serverIdentifier),
+	writer.verbose(
+		verboseMinimum,
+		p.Verbose,
+		"MCP server '%s' is connected (%d tools)",
+		conn.name(),
+		len(fetchedTools),
+	)
+
+	// cache tools for lazy connections
+	if err := cacheMCPTools(cacheKey, fetchedTools); err != nil {
+		writer.verbose(
+			verboseMedium,
+			p.Verbose,
+			"failed to cache tools of MCP server '%s': %s",
+			conn.name(),
 			err,
 		)
 	}
 
 	return &mcpConnectionDetails{
 		serverType: serverType,
-		connection: mc,
+		connection: conn,
 		tools:      fetchedTools,
 	}, nil
 }
@@ -147,7 +200,7 @@ func keysFromTools(
 func mcpToolFrom(
 	mcpConnsAndTools mcpConnectionsAndTools,
 	fnName string,
-) (serverKey string, serverType mcpServerType, mc *mcp.ClientSession, tool mcp.Tool, exists bool) {
+) (serverKey string, serverType mcpServerType, mc *mcpServerConnection, tool mcp.Tool, exists bool) {
 	for serverKey, connsAndTools := range mcpConnsAndTools {
 		for _, tool := range connsAndTools.tools {
 			if tool != nil && tool.Name == fnName {
@@ -171,11 +224,7 @@ const (
 // a map for keeping MCP connections and their tools
 //
 // * keys are identifiers of servers (server url or commandline string)
-type mcpConnectionsAndTools map[string]struct {
-	serverType mcpServerType
-	connection *mcp.ClientSession
-	tools      []*mcp.Tool
-}
+type mcpConnectionsAndTools map[string]mcpConnectionDetails
 
 // connect to MCP server, start, initialize, and return the client
 func mcpConnect(
@@ -203,16 +252,21 @@ func mcpConnect(
 	return nil, err
 }
 
-// run MCP server with given `cmdline`, connect to it, start, initialize, and return the client
+// run MCP server with given `server` config, connect to it, start, initialize, and return the client
+//
+// (stderr of the server goes to its log file, or to stderr in verbose mode)
 func mcpRun(
 	ctx context.Context,
-	cmdline string,
+	writer outputWriter,
+	p params,
+	name string,
+	server mcpStdioServerConfig,
 ) (connection *mcp.ClientSession, err error) {
-	command, args, err := parseCommandline(cmdline)
+	command, args, err := parseCommandline(server.Command)
 	if err != nil {
 		return nil, fmt.Errorf(
 			"failed to parse command line `%s` %w",
-			stripServerInfo(mcpServerStdio, cmdline),
+			stripServerInfo(mcpServerStdio, server.Command),
 			err,
 		)
 	}
@@ -223,6 +277,42 @@ func mcpRun(
 		return nil, err
 	}
 
+	cmd := exec.Command(command, args...)
+	if server.Cwd != nil {
+		cmd.Dir = expandPath(*server.Cwd)
+	}
+	cmd.Env = server.environ()
+
+	// stderr of the server
+	tail := &tailBuffer{max: mcpStderrTailBytes}
+	var logFile *os.File
+	if logFile, err = server.openStderrLog(name, p.MCPTools.STDIOStderrDir); err != nil {
+		return nil, fmt.Errorf(
+			"failed to open stderr log file for MCP server '%s': %w",
+			stripServerInfo(mcpServerStdio, name),
+			err,
+		)
+	}
+	if logFile != nil {
+		// (closed when the session ends, as the server keeps writing to it while running)
+		cmd.Stderr = io.MultiWriter(logFile, tail)
+	} else {
+		cmd.Stderr = io.MultiWriter(
+			&prefixedLineWriter{
+				print: func(line string) {
+					writer.verbose(
+						verboseMinimum,
+						p.Verbose,
+						"[%s] %s",
+						stripServerInfo(mcpServerStdio, name),
+						line,
+					)
+				},
+			},
+			tail,
+		)
+	}
+
 	if connection, err = mcp.NewClient(
 		&mcp.Implementation{
 			Name:    mcpClientName,
@@ -232,12 +322,27 @@ func mcpRun(
 	).Connect(
 		ctx,
 		&mcp.CommandTransport{
-			Command: exec.Command(command, args...),
+			Command: cmd,
 		},
 		&mcp.ClientSessionOptions{},
 	); err == nil {
+		if logFile != nil {
+			go func() {
+				_ = connection.Wait()
+				_ = logFile.Close()
+			}()
+		}
+
 		return connection, nil
 	}
+	if logFile != nil {
+		_ = logFile.Close()
+	}
+
+	// show the last lines of stderr for diagnostics
+	if stderr := strings.TrimSpace(tail.String()); len(stderr) > 0 {
+		err = fmt.Errorf("%w (stderr: %s)", err, stderr)
+	}
 
 	return nil, err
 }
@@ -289,18 +394,23 @@ func fetchMCPTools(
 	return tools, err
 }
 
-// fetch function result from MCP server connection
+// fetch function result from MCP server connection (reconnecting if needed)
+//
+// (the call is sent again after reconnecting only if `tool` is idempotent or read-only)
 func fetchMCPToolCallResult(
 	ctx context.Context,
-	connection *mcp.ClientSession,
-	fnName string, fnArgs map[string]any,
+	connection *mcpServerConnection,
+	tool mcp.Tool,
+	fnArgs map[string]any,
 ) (res *mcp.CallToolResult, err error) {
-	if res, err = connection.CallTool(
+	resendable := tool.Annotations != nil &&
+		(tool.Annotations.IdempotentHint || tool.Annotations.ReadOnlyHint)
+
+	if res, err = connection.callTool(
 		ctx,
-		&mcp.CallToolParams{
-			Name:      fnName,
-			Arguments: fnArgs,
-		},
+		tool.Name,
+		fnArgs,
+		resendable,
 	); err == nil {
 		return res, nil
 	}
@@ -339,6 +449,96 @@ func mcpJSONResult(marshalled []byte) (*mcp.CallToolResult, error) {
 	}, nil
 }
 
+// mcpLog sends a log message to the client of the given tool call request.
+//
+// (it will be dropped if the client has not set any logging level)
+func mcpLog(
+	ctx context.Context,
+	request *mcp.CallToolRequest,
+	level mcp.LoggingLevel,
+	format string,
+	args ...any,
+) {
+	if request == nil || request.Session == nil {
+		return
+	}
+
+	_ = request.Session.Log(ctx, &mcp.LoggingMessageParams{
+		Level:  level,
+		Logger: mcpLoggerName,
+		Data:   fmt.Sprintf(format, args...),
+	})
+}
+
+// mcpReportProgress notifies the client of the given tool call request about
+// the elapsed time periodically, until the returned function is called or `ctx` is done.
+//
+// (the total amount is not reported, as it is unknown;
+// nothing will be sent if the client did not request progress notifications)
+func mcpReportProgress(
+	ctx context.Context,
+	request *mcp.CallToolRequest,
+	message string,
+) (stop func()) {
+	if request == nil || request.Session == nil || request.Params.GetProgressToken() == nil {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(mcpProgressIntervalSeconds * time.Second)
+		defer ticker.Stop()
+
+		started := time.Now()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				elapsed := time.Since(started).Round(time.Second)
+				mcpNotifyProgress(
+					ctx,
+					request,
+					elapsed.Seconds(),
+					0,
+					fmt.Sprintf("%s (%s elapsed)", message, elapsed),
+				)
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+		})
+	}
+}
+
+// mcpNotifyProgress notifies the client of the given tool call request about the progress.
+//
+// (`total` is omitted if it is not positive;
+// nothing will be sent if the client did not request progress notifications)
+func mcpNotifyProgress(
+	ctx context.Context,
+	request *mcp.CallToolRequest,
+	progress, total float64,
+	message string,
+) {
+	if request == nil || request.Session == nil || request.Params.GetProgressToken() == nil {
+		return
+	}
+
+	_ = request.Session.NotifyProgress(ctx, &mcp.ProgressNotificationParams{
+		ProgressToken: request.Params.GetProgressToken(),
+		Message:       message,
+		Progress:      progress,
+		Total:         max(total, 0),
+	})
+}
+
 // strip sensitive information from given server info
 func stripServerInfo(
 	serverType mcpServerType,
@@ -0,0 +1,125 @@
+// mcp_test.go
+//
+// Things for testing `mcp.go`.
+
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// test `mcpLog` and `mcpNotifyProgress` with an in-memory session
+func TestMCPLogAndProgress(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	server := mcp.NewServer(&mcp.Implementation{Name: "test"}, &mcp.ServerOptions{
+		Capabilities: &mcp.ServerCapabilities{
+			Logging: &mcp.LoggingCapabilities{},
+		},
+	})
+	server.AddTool(&mcp.Tool{
+		Name:        "work",
+		InputSchema: map[string]any{"type": "object"},
+	}, func(ctx context.Context, request *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		mcpLog(ctx, request, "info", "working on %s", "it")
+		mcpNotifyProgress(ctx, request, 30, 100, "30%")
+		mcpNotifyProgress(ctx, request, 45, 0, "45s elapsed")
+
+		stop := mcpReportProgress(ctx, request, "working...")
+		stop()
+		stop() // (should be safe to call twice)
+
+		return mcpTextResult("done")
+	})
+
+	logs := make(chan *mcp.LoggingMessageParams, 10)
+	progresses := make(chan *mcp.ProgressNotificationParams, 10)
+	client := mcp.NewClient(&mcp.Implementation{Name: "test-client"}, &mcp.ClientOptions{
+		LoggingMessageHandler: func(_ context.Context, request *mcp.LoggingMessageRequest) {
+			logs <- request.Params
+		},
+		ProgressNotificationHandler: func(_ context.Context, request *mcp.ProgressNotificationClientRequest) {
+			progresses <- request.Params
+		},
+	})
+
+	serverTransport, clientTransport := mcp.NewInMemoryTransports()
+	serverSession, err := server.Connect(ctx, serverTransport, nil)
+	if err != nil {
+		t.Fatalf("failed to connect server: %s", err)
+	}
+	defer func() { _ = serverSession.Close() }()
+	session, err := client.Connect(ctx, clientTransport, nil)
+	if err != nil {
+		t.Fatalf("failed to connect client: %s", err)
+	}
+	defer func() { _ = session.Close() }()
+
+	call := func(withProgressToken bool) {
+		params := &mcp.CallToolParams{
+			Name:      "work",
+			Arguments: map[string]any{},
+		}
+		if withProgressToken {
+			params.SetProgressToken("token")
+		}
+		if _, err := session.CallTool(ctx, params); err != nil {
+			t.Fatalf("failed to call tool: %s", err)
+		}
+	}
+
+	// nothing is sent without a logging level nor a progress token
+	call(false)
+
+	// logs and progresses are sent when requested
+	if err := session.SetLoggingLevel(ctx, &mcp.SetLoggingLevelParams{Level: "debug"}); err != nil {
+		t.Fatalf("failed to set logging level: %s", err)
+	}
+	call(true)
+
+	select {
+	case log := <-logs:
+		if log.Logger != mcpLoggerName || log.Level != "info" || log.Data != "working on it" {
+			t.Errorf("unexpected log: %+v", log)
+		}
+	case <-ctx.Done():
+		t.Fatalf("no log was received")
+	}
+
+	expected := []mcp.ProgressNotificationParams{
+		{Progress: 30, Total: 100, Message: "30%"},
+		{Progress: 45, Total: 0, Message: "45s elapsed"},
+	}
+	for _, e := range expected {
+		select {
+		case progress := <-progresses:
+			if progress.ProgressToken != "token" ||
+				progress.Progress != e.Progress ||
+				progress.Total != e.Total ||
+				progress.Message != e.Message {
+				t.Errorf("expected progress %+v, got %+v", e, progress)
+			}
+		case <-ctx.Done():
+			t.Fatalf("no progress was received")
+		}
+	}
+
+	// (no more notifications)
+	select {
+	case log := <-logs:
+		t.Errorf("unexpected log: %+v", log)
+	case progress := <-progresses:
+		t.Errorf("unexpected progress: %+v", progress)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// nothing happens without a session
+	mcpLog(ctx, nil, "info", "nowhere")
+	mcpNotifyProgress(ctx, &mcp.CallToolRequest{Params: &mcp.CallToolParamsRaw{}}, 1, 1, "nowhere")
+	mcpReportProgress(ctx, nil, "nowhere")()
+}
@@ -0,0 +1,488 @@
+// mcpconn.go
+//
+// Things for managing connections to MCP servers (lazy connection, reconnection, cached tool lists, and stdio servers).
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+const (
+	mcpReconnectBackoffBaseMilliseconds = 500
+	mcpReconnectBackoffMaxSeconds       = 10
+
+	mcpToolsCacheDirname = "mcp-tools"
+
+	mcpStderrTailBytes = 2 * 1024 // 2KB
+)
+
+// config of a local stdio MCP server (in the config file)
+type mcpStdioServerConfig struct {
+	Command string `json:"command"`
+
+	Cwd        *string           `json:"cwd,omitempty"`         // working directory (default: current working directory)
+	Env        map[string]string `json:"env,omitempty"`         // explicit environment variables
+	InheritEnv *bool             `json:"inherit_env,omitempty"` // whether to inherit all environment variables (default: true)
+	PassEnv    []string          `json:"pass_env,omitempty"`    // names of environment variables to inherit when `inherit_env` is false
+
+	StderrLog *string `json:"stderr_log,omitempty"` // filepath to append stderr outputs to
+}
+
+// environment variables for running the server
+func (c mcpStdioServerConfig) environ() (env []string) {
+	if c.InheritEnv == nil || *c.InheritEnv {
+		env = os.Environ()
+	} else {
+		// NOTE: not nil, as `exec.Cmd` inherits all environment variables with a nil `Env`
+		env = []string{}
+		for _, name := range c.PassEnv {
+			if value, exists := os.LookupEnv(name); exists {
+				env = append(env, name+"="+value)
+			}
+		}
+	}
+	for name, value := range c.Env {
+		env = append(env, name+"="+value)
+	}
+
+	return env
+}
+
+// open a file for appending stderr outputs of the server
+//
+// (returns nil if there is no file to log to)
+func (c mcpStdioServerConfig) openStderrLog(name string, logDir *string) (*os.File, error) {
+	var fpath string
+	if c.StderrLog != nil {
+		fpath = expandPath(*c.StderrLog)
+	} else if logDir != nil {
+		// (identifiers are hashed, as they may contain secrets)
+		hash := sha256.Sum256([]byte(name))
+		fpath = filepath.Join(
+			expandPath(*logDir),
+			fmt.Sprintf(
+				"%s_%s.log",
+				filepath.Base(stripServerInfo(mcpServerStdio, name)),
+				hex.EncodeToString(hash[:4]),
+			),
+		)
+	} else {
+		return nil, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(fpath), 0o750); err != nil {
+		return nil, err
+	}
+
+	return os.OpenFile(fpath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+}
+
+// a writer which keeps only the last `max` bytes written to it
+type tailBuffer struct {
+	mu  sync.Mutex
+	max int
+	buf []byte
+}
+
+// write given bytes, dropping old ones
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.buf = append(b.buf, p...)
+	if len(b.buf) > b.max {
+		b.buf = b.buf[len(b.buf)-b.max:]
+	}
+
+	return len(p), nil
+}
+
+// return the kept bytes as a string
+func (b *tailBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return string(b.buf)
+}
+
+// a writer which calls `print` for each line written to it
+type prefixedLineWriter struct {
+	mu    sync.Mutex
+	print func(line string)
+	buf   []byte
+}
+
+// write given bytes, printing complete lines
+func (w *prefixedLineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf = append(w.buf, p...)
+	for {
+		idx := bytes.IndexByte(w.buf, '\n')
+		if idx < 0 {
+			break
+		}
+		w.print(strings.TrimRight(string(w.buf[:idx]), "\r"))
+		w.buf = w.buf[idx+1:]
+	}
+
+	return len(p), nil
+}
+
+// a function for (re)connecting to a MCP server
+type mcpConnectFunc func(ctx context.Context) (*mcp.ClientSession, error)
+
+// a connection to a MCP server, which is established on its first use,
+// and re-established when it gets disconnected
+type mcpServerConnection struct {
+	writer outputWriter
+	vbs    []bool
+
+	serverType    mcpServerType
+	identifier    string
+	connect       mcpConnectFunc
+	maxReconnects int
+
+	mu         sync.Mutex
+	session    *mcp.ClientSession
+	calls      int
+	failures   int
+	reconnects int
+	lastErr    error
+}
+
+// create a new MCP server connection (not connected yet)
+func newMCPServerConnection(
+	writer outputWriter,
+	p params,
+	serverType mcpServerType,
+	identifier string,
+	connect mcpConnectFunc,
+) *mcpServerConnection {
+	return &mcpServerConnection{
+		writer: writer,
+		vbs:    p.Verbose,
+
+		serverType:    serverType,
+		identifier:    identifier,
+		connect:       connect,
+		maxReconnects: p.MCPTools.MaxReconnects,
+	}
+}
+
+// stripped name of the server, for printing
+func (c *mcpServerConnection) name() string {
+	return stripServerInfo(c.serverType, c.identifier)
+}
+
+// return the current session, or connect to the server if there is none
+func (c *mcpServerConnection) ensureSession(ctx context.Context) (*mcp.ClientSession, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.ensureSessionLocked(ctx)
+}
+
+// (should be called with `c.mu` locked)
+func (c *mcpServerConnection) ensureSessionLocked(ctx context.Context) (*mcp.ClientSession, error) {
+	if c.session != nil {
+		return c.session, nil
+	}
+
+	c.writer.verbose(
+		verboseMedium,
+		c.vbs,
+		"connecting to MCP server: %s",
+		c.name(),
+	)
+
+	session, err := c.connect(ctx)
+	if err != nil {
+		c.lastErr = err
+		return nil, fmt.Errorf(
+			"failed to connect to MCP server '%s': %w",
+			c.name(),
+			err,
+		)
+	}
+	c.session = session
+
+	return session, nil
+}
+
+// drop given session if it is still the current one, so that it will be re-established on the next use
+func (c *mcpServerConnection) dropSession(session *mcp.ClientSession) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.session != nil && c.session == session {
+		_ = c.session.Close()
+		c.session = nil
+	}
+}
+
+// list tools of the server
+func (c *mcpServerConnection) listTools(ctx context.Context) (tools []*mcp.Tool, err error) {
+	var session *mcp.ClientSession
+	if session, err = c.ensureSession(ctx); err != nil {
+		return nil, err
+	}
+
+	return fetchMCPTools(ctx, session)
+}
+
+// record the result of a call
+func (c *mcpServerConnection) record(err error, reconnected bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err != nil {
+		c.lastErr = err
+	}
+	if reconnected {
+		c.reconnects++
+	}
+}
+
+// call a tool of the server, reconnecting with backoff when disconnected
+//
+// The call is sent again after reconnecting only if it was not sent yet,
+// or `resendable` is true (eg. the tool is idempotent or read-only).
+// Otherwise it will return the error after reconnecting, as the call might have been handled by the server.
+//
+// (`c.mu` is not held during the call and the backoff, so other calls are not blocked)
+func (c *mcpServerConnection) callTool(
+	ctx context.Context,
+	fnName string,
+	fnArgs map[string]any,
+	resendable bool,
+) (res *mcp.CallToolResult, err error) {
+	c.mu.Lock()
+	c.calls++
+	c.mu.Unlock()
+
+	defer func() {
+		if err != nil {
+			c.mu.Lock()
+			c.failures++
+			c.lastErr = err
+			c.mu.Unlock()
+		}
+	}()
+
+	for attempt := 0; ; attempt++ {
+		var session *mcp.ClientSession
+		if session, err = c.ensureSession(ctx); err == nil {
+			if res, err = session.CallTool(
+				ctx,
+				&mcp.CallToolParams{
+					Name:      fnName,
+					Arguments: fnArgs,
+				},
+			); err == nil {
+				return res, nil
+			}
+			c.record(err, false)
+
+			// errors from the server itself are not recoverable by reconnecting
+			if !isMCPDisconnected(err) {
+				return nil, err
+			}
+			c.dropSession(session)
+
+			// the call might have been handled, so do not send it again
+			if !resendable && !isMCPCallNotSent(err) {
+				if _, rerr := c.ensureSession(ctx); rerr == nil {
+					c.record(nil, true)
+				}
+				return nil, err
+			}
+		}
+
+		if attempt >= c.maxReconnects || ctx.Err() != nil {
+			return nil, err
+		}
+
+		// wait and reconnect
+		backoff := min(
+			mcpReconnectBackoffBaseMilliseconds*time.Millisecond<<attempt,
+			mcpReconnectBackoffMaxSeconds*time.Second,
+		)
+		c.writer.verbose(
+			verboseMinimum,
+			c.vbs,
+			"MCP server '%s' seems disconnected (%s), reconnecting in %s (%d/%d)...",
+			c.name(),
+			err,
+			backoff,
+			attempt+1,
+			c.maxReconnects,
+		)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(backoff):
+		}
+		c.record(nil, true)
+	}
+}
+
+// report the health of this connection
+func (c *mcpServerConnection) health() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	status := "connected"
+	if c.session == nil {
+		status = "not connected"
+	}
+	report := fmt.Sprintf(
+		"%s, %d call(s), %d failure(s), %d reconnect(s)",
+		status,
+		c.calls,
+		c.failures,
+		c.reconnects,
+	)
+	if c.lastErr != nil {
+		report += fmt.Sprintf(", last error: %s", c.lastErr)
+	}
+
+	return report
+}
+
+// close the connection
+func (c *mcpServerConnection) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.session != nil {
+		err := c.session.Close()
+		c.session = nil
+		return err
+	}
+
+	return nil
+}
+
+// check if given error means that the connection to the MCP server is lost
+func isMCPDisconnected(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var netErr net.Error
+	return errors.Is(err, mcp.ErrConnectionClosed) ||
+		errors.Is(err, mcp.ErrSessionMissing) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.As(err, &netErr)
+}
+
+// check if given error means that the call failed before being sent to the MCP server
+//
+// NOTE: the mcp sdk does not expose the error for calls on closing connections ("client is closing"),
+// so it is checked with the message
+func isMCPCallNotSent(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	return errors.Is(err, mcp.ErrSessionMissing) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE) ||
+		(errors.Is(err, mcp.ErrConnectionClosed) && strings.Contains(err.Error(), "client is closing"))
+}
+
+// key for caching tools of a MCP server with given identifier,
+// and its config (nil if it is not from the config file)
+//
+// (configs are included, so that cached tools are not used after the command, cwd, or env is changed)
+func mcpToolsCacheKey(identifier string, stdioServer *mcpStdioServerConfig) string {
+	if stdioServer == nil {
+		return identifier
+	}
+
+	resolved := *stdioServer
+	if resolved.Cwd != nil {
+		resolved.Cwd = new(expandPath(*resolved.Cwd))
+	}
+	resolved.StderrLog = nil // (not related to the tools)
+
+	marshalled, _ := json.Marshal(resolved) // NOTE: keys of maps are sorted
+	return identifier + "\n" + string(marshalled)
+}
+
+// path of the file for caching tools of a MCP server
+//
+// (identifiers are hashed, as they may contain secrets)
+func mcpToolsCacheFilepath(identifier string) (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.Sum256([]byte(identifier))
+	return filepath.Join(
+		dir,
+		appName,
+		mcpToolsCacheDirname,
+		hex.EncodeToString(hash[:])+".json",
+	), nil
+}
+
+// read cached tools of a MCP server
+func readCachedMCPTools(identifier string) (tools []*mcp.Tool, err error) {
+	var fpath string
+	if fpath, err = mcpToolsCacheFilepath(identifier); err != nil {
+		return nil, err
+	}
+
+	var bytes []byte
+	if bytes, err = os.ReadFile(fpath); err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(bytes, &tools); err != nil {
+		return nil, err
+	}
+
+	return tools, nil
+}
+
+// cache tools of a MCP server for lazy connections
+func cacheMCPTools(identifier string, tools []*mcp.Tool) (err error) {
+	var fpath string
+	if fpath, err = mcpToolsCacheFilepath(identifier); err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(fpath), 0o750); err != nil {
+		return err
+	}
+
+	var bytes []byte
+	if bytes, err = json.Marshal(tools); err != nil {
+		return err
+	}
+
+	return os.WriteFile(fpath, bytes, 0o640)
+}
@@ -0,0 +1,286 @@
+// mcpconn_test.go
+//
+// Things for testing `mcpconn.go`.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// test `mcpServerConnection` with lazy connection and reconnection
+func TestMCPServerConnectionReconnect(t *testing.T) {
+	server := mcp.NewServer(
+		&mcp.Implementation{Name: "test-server"},
+		&mcp.ServerOptions{},
+	)
+	server.AddTool(
+		&mcp.Tool{
+			Name:        "ping",
+			InputSchema: &jsonschema.Schema{Type: "object"},
+		},
+		func(ctx context.Context, request *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			return mcpTextResult("pong")
+		},
+	)
+
+	connected := 0
+	var p params
+	p.MCPTools.MaxReconnects = 2
+	conn := newMCPServerConnection(
+		newStdoutWriter(),
+		p,
+		mcpServerInMemory,
+		"test",
+		func(ctx context.Context) (*mcp.ClientSession, error) {
+			connected++
+			return mcpRunInMemory(ctx, server)
+		},
+	)
+	defer func() { _ = conn.Close() }()
+
+	// should not be connected until its first use
+	if connected != 0 {
+		t.Errorf("expected no connection before the first use, got %d", connected)
+	}
+
+	ctx := context.Background()
+	if _, err := conn.callTool(ctx, "ping", nil, false); err != nil {
+		t.Fatalf("failed to call tool: %s", err)
+	}
+	if connected != 1 {
+		t.Errorf("expected 1 connection, got %d", connected)
+	}
+
+	// should reconnect after being disconnected
+	_ = conn.session.Close()
+	if res, err := conn.callTool(ctx, "ping", nil, false); err != nil {
+		t.Fatalf("failed to call tool after disconnection: %s", err)
+	} else if text, ok := res.Content[0].(*mcp.TextContent); !ok || text.Text != "pong" {
+		t.Errorf("unexpected result: %+v", res.Content)
+	}
+	if connected != 2 || conn.reconnects != 1 {
+		t.Errorf("expected 2 connections and 1 reconnect, got %d and %d", connected, conn.reconnects)
+	}
+
+	// should not reconnect on errors from the server
+	if _, err := conn.callTool(ctx, "no_such_tool", nil, true); err == nil {
+		t.Errorf("should fail with non-existent tool")
+	}
+	if connected != 2 {
+		t.Errorf("expected no more connections, got %d", connected)
+	}
+}
+
+// test that `mcpServerConnection` sends calls again only when it is safe
+func TestMCPServerConnectionResend(t *testing.T) {
+	server := mcp.NewServer(
+		&mcp.Implementation{Name: "test-server"},
+		&mcp.ServerOptions{},
+	)
+	handled := 0
+	server.AddTool(
+		&mcp.Tool{
+			Name:        "crash",
+			InputSchema: &jsonschema.Schema{Type: "object"},
+		},
+		func(ctx context.Context, request *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			handled++
+			if handled == 1 { // (drop the connection while handling the first call)
+				go func() { _ = request.Session.Close() }()
+				select {
+				case <-ctx.Done():
+				case <-time.After(time.Second):
+				}
+			}
+			return mcpTextResult("survived")
+		},
+	)
+
+	var p params
+	p.MCPTools.MaxReconnects = 2
+	newConn := func() *mcpServerConnection {
+		handled = 0
+		return newMCPServerConnection(
+			newStdoutWriter(),
+			p,
+			mcpServerInMemory,
+			"test",
+			func(ctx context.Context) (*mcp.ClientSession, error) {
+				return mcpRunInMemory(ctx, server)
+			},
+		)
+	}
+	ctx := context.Background()
+
+	// should not send a call again when it might have been handled
+	conn := newConn()
+	if _, err := conn.callTool(ctx, "crash", nil, false); err == nil {
+		t.Errorf("expected an error for the dropped call")
+	}
+	if handled != 1 {
+		t.Errorf("expected the call to be handled once, got %d", handled)
+	}
+	if conn.session == nil || conn.reconnects != 1 {
+		t.Errorf("expected to be reconnected after the dropped call, got %s", conn.health())
+	}
+	_ = conn.Close()
+
+	// should send a call again when it is resendable
+	conn = newConn()
+	if res, err := conn.callTool(ctx, "crash", nil, true); err != nil {
+		t.Errorf("failed to call tool again: %s", err)
+	} else if text, ok := res.Content[0].(*mcp.TextContent); !ok || text.Text != "survived" {
+		t.Errorf("unexpected result: %+v", res.Content)
+	}
+	if handled != 2 {
+		t.Errorf("expected the call to be handled twice, got %d", handled)
+	}
+	_ = conn.Close()
+}
+
+// test `isMCPCallNotSent` with various errors
+func TestIsMCPCallNotSent(t *testing.T) {
+	type test struct {
+		err      error
+		expected bool
+	}
+
+	tests := []test{
+		{err: nil, expected: false},
+		{err: io.EOF, expected: false},
+		{err: fmt.Errorf("%w: calling \"tools/call\": server is closing", mcp.ErrConnectionClosed), expected: false},
+		{err: fmt.Errorf("%w: calling \"tools/call\": client is closing", mcp.ErrConnectionClosed), expected: true},
+		{err: fmt.Errorf("failed to write: %w", syscall.EPIPE), expected: true},
+		{err: fmt.Errorf("failed to connect: %w", syscall.ECONNREFUSED), expected: true},
+		{err: mcp.ErrSessionMissing, expected: true},
+	}
+
+	for _, test := range tests {
+		if actual := isMCPCallNotSent(test.err); actual != test.expected {
+			t.Errorf("expected %t for '%v', got %t", test.expected, test.err, actual)
+		}
+	}
+}
+
+// test `mcpStdioServerConfig.environ` with various configs
+func TestMCPStdioServerConfigEnviron(t *testing.T) {
+	t.Setenv("GMN_TEST_PASSED", "passed")
+	t.Setenv("GMN_TEST_NOT_PASSED", "not passed")
+
+	type test struct {
+		config      mcpStdioServerConfig
+		included    []string
+		notIncluded []string
+	}
+
+	tests := []test{
+		// should inherit all environment variables by default
+		{
+			config: mcpStdioServerConfig{
+				Env: map[string]string{"GMN_TEST_EXPLICIT": "explicit"},
+			},
+			included: []string{"GMN_TEST_PASSED=passed", "GMN_TEST_NOT_PASSED=not passed", "GMN_TEST_EXPLICIT=explicit"},
+		},
+		// should pass only the given environment variables
+		{
+			config: mcpStdioServerConfig{
+				Env:        map[string]string{"GMN_TEST_EXPLICIT": "explicit"},
+				InheritEnv: new(false),
+				PassEnv:    []string{"GMN_TEST_PASSED", "GMN_TEST_NO_SUCH_VAR"},
+			},
+			included:    []string{"GMN_TEST_PASSED=passed", "GMN_TEST_EXPLICIT=explicit"},
+			notIncluded: []string{"GMN_TEST_NOT_PASSED=not passed", "GMN_TEST_NO_SUCH_VAR="},
+		},
+		// should pass nothing (not nil, which means inheriting all of them)
+		{
+			config: mcpStdioServerConfig{
+				InheritEnv: new(false),
+			},
+			notIncluded: []string{"GMN_TEST_PASSED=passed", "GMN_TEST_NOT_PASSED=not passed"},
+		},
+	}
+
+	for _, test := range tests {
+		env := test.config.environ()
+		if env == nil {
+			t.Errorf("expected non-nil environment variables for %+v", test.config)
+		}
+		for _, e := range test.included {
+			if !slices.Contains(env, e) {
+				t.Errorf("expected '%s' to be included in %v", e, env)
+			}
+		}
+		for _, e := range test.notIncluded {
+			if slices.Contains(env, e) {
+				t.Errorf("expected '%s' not to be included in %v", e, env)
+			}
+		}
+	}
+}
+
+// test `tailBuffer` and `prefixedLineWriter`
+func TestStderrWriters(t *testing.T) {
+	tail := &tailBuffer{max: 5}
+	_, _ = tail.Write([]byte("abc"))
+	_, _ = tail.Write([]byte("defg"))
+	if tail.String() != "cdefg" {
+		t.Errorf("expected 'cdefg', got '%s'", tail.String())
+	}
+
+	lines := []string{}
+	w := &prefixedLineWriter{
+		print: func(line string) {
+			lines = append(lines, line)
+		},
+	}
+	_, _ = w.Write([]byte("first\r\nsec"))
+	_, _ = w.Write([]byte("ond\nthird"))
+	if !slices.Equal(lines, []string{"first", "second"}) {
+		t.Errorf("expected complete lines only, got %v", lines)
+	}
+}
+
+// test `mcpToolsCacheKey` with changes of configs
+func TestMCPToolsCacheKey(t *testing.T) {
+	base := mcpStdioServerConfig{
+		Command: "server --flag",
+		Cwd:     new("/tmp"),
+		Env:     map[string]string{"A": "1", "B": "2"},
+	}
+	key := mcpToolsCacheKey("name", &base)
+
+	type test struct {
+		config  mcpStdioServerConfig
+		changed bool
+	}
+
+	tests := []test{
+		{config: mcpStdioServerConfig{Command: "server --flag", Cwd: new("/tmp"), Env: map[string]string{"B": "2", "A": "1"}}},
+		{config: mcpStdioServerConfig{Command: "server --flag", Cwd: new("/tmp"), Env: map[string]string{"A": "1", "B": "2"}, StderrLog: new("/tmp/log")}},
+		{config: mcpStdioServerConfig{Command: "server --other-flag", Cwd: new("/tmp"), Env: map[string]string{"A": "1", "B": "2"}}, changed: true},
+		{config: mcpStdioServerConfig{Command: "server --flag", Cwd: new("/var"), Env: map[string]string{"A": "1", "B": "2"}}, changed: true},
+		{config: mcpStdioServerConfig{Command: "server --flag", Cwd: new("/tmp"), Env: map[string]string{"A": "1", "B": "3"}}, changed: true},
+		{config: mcpStdioServerConfig{Command: "server --flag", Cwd: new("/tmp"), Env: map[string]string{"A": "1", "B": "2"}, InheritEnv: new(false)}, changed: true},
+	}
+
+	for _, test := range tests {
+		if changed := mcpToolsCacheKey("name", &test.config) != key; changed != test.changed {
+			t.Errorf("expected changed: %t for %+v, got %t", test.changed, test.config, changed)
+		}
+	}
+
+	// identifiers are used as they are without configs
+	if key := mcpToolsCacheKey("server --flag", nil); key != "server --flag" {
+		t.Errorf("expected the identifier as the key, got '%s'", key)
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/fatih/color"
+	"google.golang.org/genai"
 
 	gt "github.com/meinside/gemini-things-go"
 )
@@ -38,6 +39,14 @@ func listModels(
 
 	if models, err := gtc.ListModels(ctx); err != nil {
 		return 1, err
+	} else if p.outputAsJSON() {
+		if err := printJSONResult(writer, struct {
+			Models []*genai.Model `json:"models"`
+		}{
+			Models: models,
+		}); err != nil {
+			return 1, err
+		}
 	} else {
 		for _, model := range models {
 			// model name
@@ -32,7 +32,19 @@ type params struct {
 		GroundingOn bool      `short:"g" long:"with-grounding" description:"Generate with grounding (Google Search)"`
 
 		// other generation options
-		OutputAsJSON bool `short:"j" long:"json" description:"Whether to output generated results as JSON"`
+		OutputAsJSON   bool    `short:"j" long:"json" description:"Whether to output generated results, or results of other commands (listing models, cached contexts, file search stores, ...), as JSON"`
+		OutputFormat   *string `long:"output-format" description:"Format of the output ('text' or 'ndjson'; 'ndjson' emits one JSON event per line, and saves generated images to files) (default: 'text')" value-name:"FORMAT"`
+		MetadataTo     *string `long:"metadata-to" description:"Write metadata of generations (grounding, citations, token usages, and finish reasons) to a file as JSON lines" value-name:"FILEPATH"`
+		Citations      bool    `long:"citations" description:"Insert numbered citation markers from grounding sources into the answer, and print a list of references after it (the answer is printed when generation is finished)"`
+		RenderMarkdown bool    `long:"render-markdown" description:"Render generated Markdown texts (headings, lists, tables, and code blocks with syntax highlighting) when stdout is a terminal (can also be set in config)"`
+
+		// structured output
+		ResponseSchema        *string `long:"response-schema" description:"Path of a JSON Schema file for the response (implies --json; the response is validated locally before being printed)" value-name:"FILEPATH"`
+		ResponseSchemaRepairs int     `long:"response-schema-repairs" description:"Maximum number of times to ask the model again with validation errors when the response does not conform to --response-schema" default:"0" value-name:"COUNT"`
+
+		// prompt templates
+		Template     *string           `long:"template" description:"Name of a prompt template in the prompts directory to generate with (prompt from -p or stdin will be appended to it)" value-name:"NAME"`
+		TemplateArgs map[string]string `long:"template-arg" description:"Argument for the prompt template (can be used multiple times, eg. 'language:Go')"`
 
 		// detailed generation options
 		DetailedOptions struct {
@@ -40,12 +52,16 @@ type params struct {
 
 			ThinkingLevel *string `long:"thinking-level" description:"Level for thinking ('low', 'medium', 'high', or 'minimal')" value-name:"LEVEL"`
 			ShowThinking  bool    `long:"show-thinking" description:"Show thinking process between <thought></thought> tags"`
+			ThoughtsTo    *string `long:"thoughts-to" description:"Write thinking process to 'stderr' or a file, instead of stdout (implies --with-thinking)" value-name:"FILEPATH|stderr"`
+
+			SafetySettings map[string]string `long:"safety-setting" description:"Safety threshold for a harm category (can be used multiple times, eg. 'dangerous-content:only-high'; categories are off unless set here or in config)" value-name:"CATEGORY:THRESHOLD"`
 
 			FileSearchStores []string `long:"file-search-store" description:"Name of file search store (can be used multiple times)"`
 
 			Seed *int32 `long:"seed" description:"Seed for generation" value-name:"SEED"`
 
 			MaxOutputTokens  *int32   `long:"max-output-tokens" description:"Maximum number of tokens to generate" value-name:"TOKENS"`
+			AutoContinue     int      `long:"auto-continue" description:"Maximum number of times to ask the model to continue when generation stops on the maximum number of tokens (outputs are stitched together)" default:"0" value-name:"COUNT"`
 			StopSequences    []string `long:"stop-sequence" description:"Stop sequence for generation (can be used multiple times)" value-name:"SEQ"`
 			PresencePenalty  *float32 `long:"presence-penalty" description:"Presence penalty for generation (positive values increase diversity)" value-name:"PENALTY"`
 			FrequencyPenalty *float32 `long:"frequency-penalty" description:"Frequency penalty for generation (positive values reduce repetition)" value-name:"PENALTY"`
@@ -53,6 +69,14 @@ type params struct {
 			MediaResolution *string `long:"media-resolution" description:"Resolution for processing input media ('low', 'medium', or 'high')" value-name:"RESOLUTION"`
 		} `group:"Detailed Generation Options"`
 
+		// for retrying on transient errors
+		Retry struct {
+			MaxRetries      int      `long:"retries" description:"Maximum number of retries with exponential backoff on transient API errors (quota exceeded, model overloaded, or server errors) (can also be set in config)" value-name:"COUNT"`
+			DelaySeconds    float64  `long:"retry-delay" description:"Base delay in seconds before the first retry, doubled on each retry (can also be set in config) (default: 1)" value-name:"SECONDS"`
+			MaxDelaySeconds float64  `long:"retry-max-delay" description:"Maximum delay in seconds between retries (can also be set in config) (default: 60)" value-name:"SECONDS"`
+			FallbackModels  []string `long:"fallback-model" description:"Model to fall back to when retries are exhausted (can be used multiple times, tried in order; can also be set in config)" value-name:"MODEL_NAME"`
+		} `group:"Retries"`
+
 		// google maps
 		GoogleMaps struct {
 			WithGoogleMaps bool     `long:"with-google-maps" description:"Generate with Google Maps"`
@@ -112,14 +136,18 @@ type params struct {
 		MaxCallbackLoopCount     int  `long:"max-callback-loop-count" description:"Maximum number of times to call a tool callback with the same arguments" default:"0" value-name:"COUNT"`
 
 		ForceCallDestructiveTools bool `short:"y" long:"force-call-destructive-tools" description:"Whether to force calling destructive tools without asking (like YOLO mode)"`
+
+		MaxResultBytes      int   `long:"max-tool-result-bytes" description:"Maximum size of a tool result's text to be sent back to the model; larger ones will be shortened and saved to temporary files (default: 65536)" value-name:"BYTES"`
+		MaxResultMediaBytes int64 `long:"max-tool-result-media-bytes" description:"Maximum total size of media (images, audios, and PDFs) in a tool result to be sent back to the model (default: 4194304)" value-name:"BYTES"`
 	} `group:"Tools"`
 
 	// tools (local)
 	LocalTools struct {
-		Tools                *string           `long:"tools" description:"Tools for function call (in JSON)" value-name:"JSON"`
-		ToolConfig           *string           `long:"tool-config" description:"Tool configuration for function call (in JSON)" value-name:"JSON"`
-		ToolCallbacks        map[string]string `long:"tool-callbacks" description:"Tool callbacks (can be used multiple times, eg. 'fn_name1:/path/to/script1.sh', 'fn_name2:/path/to/script2.sh')"`
-		ToolCallbacksConfirm map[string]bool   `long:"tool-callbacks-confirm" description:"Confirm before executing tool callbacks (can be used multiple times, eg. 'fn_name1:true', 'fn_name2:false')"`
+		Tools                 *string           `long:"tools" description:"Tools for function call (in JSON)" value-name:"JSON"`
+		ToolConfig            *string           `long:"tool-config" description:"Tool configuration for function call (in JSON)" value-name:"JSON"`
+		ToolCallbacks         map[string]string `long:"tool-callbacks" description:"Tool callbacks (can be used multiple times, eg. 'fn_name1:/path/to/script1.sh', 'fn_name2:/path/to/script2.sh')"`
+		ToolCallbacksConfirm  map[string]bool   `long:"tool-callbacks-confirm" description:"Confirm before executing tool callbacks (can be used multiple times, eg. 'fn_name1:true', 'fn_name2:false')"`
+		ToolCallbacksMIMEType map[string]string `long:"tool-callbacks-mimetype" description:"MIME type of tool callbacks' outputs, for sending them back to the model as media (can be used multiple times, eg. 'fn_name1:image/png', 'fn_name2:application/pdf')"`
 	} `group:"Tools (Local)"`
 
 	// tools (MCP)
@@ -128,12 +156,32 @@ type params struct {
 		STDIOCommands          []string `long:"mcp-stdio-command" description:"Commands of local stdio MCP Tools (can be used multiple times)" value-name:"CMD"`
 		WithSelfAsSTDIOCommand bool     `short:"T" long:"mcp-tool-self" description:"Will add itself as an internal MCP tool"`
 
+		STDIOServers   []string `long:"mcp-stdio-server" description:"Name of a local stdio MCP server configured in the config file (with its env, cwd, and stderr log) (can be used multiple times)" value-name:"NAME"`
+		STDIOStderrDir *string  `long:"mcp-stdio-stderr-dir" description:"Directory for log files of stderr outputs from local stdio MCP servers (default: printed to stderr in verbose mode)" value-name:"DIR"`
+
+		Optional      bool `long:"mcp-optional" description:"Skip unreachable MCP servers with warnings, instead of failing"`
+		Lazy          bool `long:"mcp-lazy" description:"Connect to MCP servers on their first tool calls, with their tools cached from previous runs (servers without cached tools will be connected immediately)"`
+		MaxReconnects int  `long:"mcp-max-reconnects" description:"Maximum number of reconnections to a disconnected MCP server on each tool call" default:"3" value-name:"COUNT"`
+
 		RunAsStandaloneSTDIOServer bool `short:"M" long:"mcp-server-self" description:"Run as a standalone STDIO MCP server"`
+
+		SelfMediaOutput         *string `long:"mcp-self-media-output" description:"How generated media are returned from 'gmn_generate' of the self MCP server ('path' for saved filepaths only, or 'content' for inline media or resource links along with them) (default: 'path')" value-name:"MODE"`
+		SelfInlineMediaMaxBytes int64   `long:"mcp-self-inline-media-max-bytes" description:"Maximum size of generated media to be returned inline with 'content' media output; larger ones will be returned as resource links (default: 1048576)" value-name:"BYTES"`
+
+		SelfTools        []string `long:"mcp-self-tools" description:"Name of a tool to expose from the self MCP server (can be used multiple times; default: all tools)" value-name:"TOOL"`
+		SelfExcludeTools []string `long:"mcp-self-exclude-tools" description:"Name of a tool not to expose from the self MCP server (can be used multiple times)" value-name:"TOOL"`
+		SelfReadOnly     bool     `long:"mcp-self-read-only" description:"Expose only read-only tools (and 'gmn_generate') from the self MCP server, without ones exposing environment variables or contents of local files"`
+
+		PromptsDirectory *string `long:"mcp-prompts-dir" description:"Directory of prompt templates (Markdown files with front matter) to be served by the self MCP server, or used with --template" value-name:"DIR"`
 	} `group:"Tools (MCP)"`
 
 	// tools (skills)
 	Skills struct {
-		SkillsDirectory *string `long:"skills-dir" description:"Load skills in the given directory" value-name:"DIR"`
+		SkillsDirectories []string `long:"skills-dir" description:"Load skills in the given directory (can be used multiple times; earlier ones take precedence over later ones on name conflicts)" value-name:"DIR"`
+		NoAutoDiscovery   bool     `long:"skills-no-auto-discovery" description:"Do not load skills in '.gmn/skills' of the current directory and '$XDG_CONFIG_HOME/gmn/skills' automatically"`
+		ListSkills        bool     `long:"list-skills" description:"List skills with their names, descriptions, and files"`
+		NewSkill          *string  `long:"new-skill" description:"Create a skeleton of a new skill with the given name (in the first --skills-dir, or in '.gmn/skills' of the current directory)" value-name:"NAME"`
+		ValidateSkills    *string  `long:"validate-skills" description:"Validate skills in the given directory and report their problems" value-name:"DIR"`
 	} `group:"Tools (Skills)"`
 
 	// for embedding
@@ -169,13 +217,21 @@ type params struct {
 	OverrideFileMIMEType map[string]string `long:"override-file-mimetype" description:"Override MIME type for the given file's extension (can be used multiple times, eg. '.apk:application/zip', '.md:text/markdown')"`
 
 	// for logging and debugging
-	Verbose                []bool `short:"v" long:"verbose" description:"Show verbose logs (can be used multiple times)"`
-	ErrorOnUnsupportedType bool   `long:"error-on-unsupported-type" description:"Exit with error when unsupported type of stream is received"`
+	Verbose                []bool  `short:"v" long:"verbose" description:"Show verbose logs (can be used multiple times)"`
+	ErrorOnUnsupportedType bool    `long:"error-on-unsupported-type" description:"Exit with error when unsupported type of stream is received"`
+	ErrorFormat            *string `long:"error-format" description:"Format of errors printed to stderr ('text' or 'json'; 'json' prints an object with the exit code, kind, message, and whether it is transient) (default: 'text')" value-name:"FORMAT"`
 }
 
 // check if prompt is given in the params
 func (p *params) hasPrompt() bool {
-	return p.Generation.Prompt != nil && len(*p.Generation.Prompt) > 0
+	return (p.Generation.Prompt != nil && len(*p.Generation.Prompt) > 0) ||
+		p.Generation.Template != nil // (will be rendered as a prompt)
+}
+
+// check if results should be printed as JSON
+func (p *params) outputAsJSON() bool {
+	return p.Generation.OutputAsJSON ||
+		(p.Generation.OutputFormat != nil && *p.Generation.OutputFormat == outputFormatNDJSON)
 }
 
 // check if any task is requested
@@ -185,6 +241,9 @@ func (p *params) taskRequested() bool {
 		p.Caching.ListCachedContexts ||
 		p.Caching.DeleteCachedContext != nil ||
 		p.ListModels ||
+		p.Skills.ListSkills ||
+		p.Skills.NewSkill != nil ||
+		p.Skills.ValidateSkills != nil ||
 		p.MCPTools.RunAsStandaloneSTDIOServer ||
 		p.Embeddings.GenerateEmbeddings ||
 		p.FileSearch.ListFileSearchStores ||
@@ -231,6 +290,27 @@ func (p *params) multipleTasksRequested() bool {
 			promptCounted = true
 		}
 	}
+	if p.Skills.ListSkills { // list skills
+		num++
+		if hasPrompt && !promptCounted {
+			num++
+			promptCounted = true
+		}
+	}
+	if p.Skills.NewSkill != nil { // create a new skill
+		num++
+		if hasPrompt && !promptCounted {
+			num++
+			promptCounted = true
+		}
+	}
+	if p.Skills.ValidateSkills != nil { // validate skills
+		num++
+		if hasPrompt && !promptCounted {
+			num++
+			promptCounted = true
+		}
+	}
 	if p.MCPTools.RunAsStandaloneSTDIOServer { // run as a STDIO MCP server
 		num++
 		if hasPrompt && !promptCounted {
@@ -0,0 +1,308 @@
+// patch.go
+//
+// Things for editing text files with patches.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// patch formats
+const (
+	patchFormatUnified       = "unified"
+	patchFormatSearchReplace = "search_replace"
+)
+
+// markers of search/replace blocks
+const (
+	searchReplaceMarkerSearch  = "<<<<<<< SEARCH"
+	searchReplaceMarkerDivider = "======="
+	searchReplaceMarkerReplace = ">>>>>>> REPLACE"
+)
+
+// pre-compiled regexps
+var (
+	_unifiedHunkHeaderRegexp = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+)
+
+// an edit of consecutive lines
+type patchEdit struct {
+	oldLines []string
+	newLines []string
+
+	// 0-based line index in the original content where `oldLines` are expected (-1 if unknown)
+	hint int
+}
+
+// detect the format of given patch
+func detectPatchFormat(patch string) (format string, err error) {
+	if strings.Contains(patch, searchReplaceMarkerSearch) {
+		return patchFormatSearchReplace, nil
+	}
+	for line := range strings.SplitSeq(patch, "\n") {
+		if _unifiedHunkHeaderRegexp.MatchString(line) {
+			return patchFormatUnified, nil
+		}
+	}
+	return "", fmt.Errorf("could not detect the format of patch: neither a unified diff nor search/replace blocks")
+}
+
+// split given text into lines (without newlines), and report if it ended with a newline
+func splitLines(text string) (lines []string, endsWithNewline bool) {
+	if text == "" {
+		return []string{}, false
+	}
+
+	endsWithNewline = strings.HasSuffix(text, "\n")
+	lines = strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+
+	return lines, endsWithNewline
+}
+
+// parse search/replace blocks into edits
+func parseSearchReplaceBlocks(patch string) (edits []patchEdit, err error) {
+	lines, _ := splitLines(strings.ReplaceAll(patch, "\r\n", "\n"))
+
+	const (
+		stateNone = iota
+		stateSearch
+		stateReplace
+	)
+
+	state := stateNone
+	var edit patchEdit
+	for i, line := range lines {
+		switch state {
+		case stateNone:
+			if strings.TrimSpace(line) == searchReplaceMarkerSearch {
+				edit = patchEdit{oldLines: []string{}, newLines: []string{}, hint: -1}
+				state = stateSearch
+			}
+		case stateSearch:
+			if strings.TrimSpace(line) == searchReplaceMarkerDivider {
+				state = stateReplace
+			} else {
+				edit.oldLines = append(edit.oldLines, line)
+			}
+		case stateReplace:
+			if strings.TrimSpace(line) == searchReplaceMarkerReplace {
+				if len(edit.oldLines) == 0 {
+					return nil, fmt.Errorf("empty search block (ending at line %d)", i+1)
+				}
+				edits = append(edits, edit)
+				state = stateNone
+			} else {
+				edit.newLines = append(edit.newLines, line)
+			}
+		}
+	}
+
+	if state != stateNone {
+		return nil, fmt.Errorf("unterminated search/replace block")
+	}
+	if len(edits) == 0 {
+		return nil, fmt.Errorf("no search/replace block found")
+	}
+
+	return edits, nil
+}
+
+// parse hunks of a unified diff into edits
+//
+// NOTE: only a diff of a single file is supported
+func parseUnifiedDiff(patch string) (edits []patchEdit, err error) {
+	lines, _ := splitLines(strings.ReplaceAll(patch, "\r\n", "\n"))
+
+	numFiles := 0
+	oldRemaining, newRemaining := 0, 0 // numbers of lines left in the current hunk
+	for _, line := range lines {
+		// lines in a hunk
+		if oldRemaining > 0 || newRemaining > 0 {
+			edit := &edits[len(edits)-1]
+
+			if line == "" { // NOTE: some tools strip the leading space of empty context lines
+				line = " "
+			}
+			switch line[0] {
+			case ' ':
+				edit.oldLines = append(edit.oldLines, line[1:])
+				edit.newLines = append(edit.newLines, line[1:])
+				oldRemaining--
+				newRemaining--
+			case '-':
+				edit.oldLines = append(edit.oldLines, line[1:])
+				oldRemaining--
+			case '+':
+				edit.newLines = append(edit.newLines, line[1:])
+				newRemaining--
+			case '\\': // '\ No newline at end of file'
+			default:
+				return nil, fmt.Errorf("malformed line in hunk: %q", line)
+			}
+			continue
+		}
+
+		// headers
+		if strings.HasPrefix(line, "--- ") {
+			if numFiles++; numFiles > 1 {
+				return nil, fmt.Errorf("unified diff of multiple files is not supported")
+			}
+		} else if matches := _unifiedHunkHeaderRegexp.FindStringSubmatch(line); matches != nil {
+			oldStart, _ := strconv.Atoi(matches[1])
+			oldRemaining, newRemaining = 1, 1
+			if matches[2] != "" {
+				oldRemaining, _ = strconv.Atoi(matches[2])
+			}
+			if matches[4] != "" {
+				newRemaining, _ = strconv.Atoi(matches[4])
+			}
+
+			hint := max(oldStart-1, 0)
+			if oldRemaining == 0 { // NOTE: pure insertion is placed after the given line
+				hint = oldStart
+			}
+
+			edits = append(edits, patchEdit{oldLines: []string{}, newLines: []string{}, hint: hint})
+		}
+	}
+
+	if len(edits) == 0 {
+		return nil, fmt.Errorf("no hunk found in unified diff")
+	}
+	if oldRemaining > 0 || newRemaining > 0 {
+		return nil, fmt.Errorf("unexpected end of hunk in unified diff")
+	}
+
+	return edits, nil
+}
+
+// find all indices of `sub` in `lines`, starting from `from`
+func indicesOfLines(lines, sub []string, from int) (indices []int) {
+	for i := from; i+len(sub) <= len(lines); i++ {
+		if slices.Equal(lines[i:i+len(sub)], sub) {
+			indices = append(indices, i)
+		}
+	}
+	return indices
+}
+
+// apply given patch to `content`, and return the patched content with a preview of changes
+func applyPatch(
+	content, patch, format string,
+) (patched, preview string, err error) {
+	if format == "" {
+		if format, err = detectPatchFormat(patch); err != nil {
+			return "", "", err
+		}
+	}
+
+	var edits []patchEdit
+	switch format {
+	case patchFormatUnified:
+		edits, err = parseUnifiedDiff(patch)
+	case patchFormatSearchReplace:
+		edits, err = parseSearchReplaceBlocks(patch)
+	default:
+		err = fmt.Errorf("unsupported patch format: '%s'", format)
+	}
+	if err != nil {
+		return "", "", err
+	}
+
+	usesCRLF := strings.Contains(content, "\r\n")
+	lines, endsWithNewline := splitLines(strings.ReplaceAll(content, "\r\n", "\n"))
+
+	var sb strings.Builder
+	offset := 0 // difference of line counts caused by previous edits
+	from := 0   // edits are applied in order, so search after the previous one
+	for i, edit := range edits {
+		var index int
+
+		if len(edit.oldLines) == 0 { // pure insertion
+			if edit.hint < 0 || edit.hint+offset > len(lines) {
+				return "", "", fmt.Errorf("edit #%d: insertion point is out of range", i+1)
+			}
+			index = edit.hint + offset
+		} else {
+			indices := indicesOfLines(lines, edit.oldLines, from)
+			switch {
+			case len(indices) == 0:
+				return "", "", fmt.Errorf("edit #%d: lines to replace were not found:\n%s", i+1, strings.Join(edit.oldLines, "\n"))
+			case len(indices) == 1:
+				index = indices[0]
+			case edit.hint >= 0 && slices.Contains(indices, edit.hint+offset):
+				index = edit.hint + offset
+			default:
+				return "", "", fmt.Errorf("edit #%d: lines to replace were found %d times, add more lines for a unique match:\n%s", i+1, len(indices), strings.Join(edit.oldLines, "\n"))
+			}
+		}
+
+		// preview (common leading and trailing lines are shown as context)
+		prefix := 0
+		for prefix < len(edit.oldLines) && prefix < len(edit.newLines) && edit.oldLines[prefix] == edit.newLines[prefix] {
+			prefix++
+		}
+		suffix := 0
+		for suffix < len(edit.oldLines)-prefix && suffix < len(edit.newLines)-prefix &&
+			edit.oldLines[len(edit.oldLines)-1-suffix] == edit.newLines[len(edit.newLines)-1-suffix] {
+			suffix++
+		}
+		fmt.Fprintf(&sb, "@@ -%d,%d +%d,%d @@\n", index+1-offset, len(edit.oldLines), index+1, len(edit.newLines))
+		for _, line := range edit.oldLines[:prefix] {
+			fmt.Fprintf(&sb, " %s\n", line)
+		}
+		for _, line := range edit.oldLines[prefix : len(edit.oldLines)-suffix] {
+			fmt.Fprintf(&sb, "-%s\n", line)
+		}
+		for _, line := range edit.newLines[prefix : len(edit.newLines)-suffix] {
+			fmt.Fprintf(&sb, "+%s\n", line)
+		}
+		for _, line := range edit.oldLines[len(edit.oldLines)-suffix:] {
+			fmt.Fprintf(&sb, " %s\n", line)
+		}
+
+		// replace lines
+		lines = slices.Concat(lines[:index], edit.newLines, lines[index+len(edit.oldLines):])
+		offset += len(edit.newLines) - len(edit.oldLines)
+		from = index + len(edit.newLines)
+	}
+
+	patched = strings.Join(lines, "\n")
+	if endsWithNewline || (len(lines) > 0 && content == "") {
+		patched += "\n"
+	}
+	if usesCRLF {
+		patched = strings.ReplaceAll(patched, "\n", "\r\n")
+	}
+
+	return patched, sb.String(), nil
+}
+
+// read the file at given path, and apply given patch to its content
+//
+// (the file itself is not modified; returns the patched content, a preview of changes, and the file's permission)
+func patchFile(
+	fpath, patch, format string,
+) (patched, preview string, perm os.FileMode, err error) {
+	var stat os.FileInfo
+	if stat, err = os.Stat(fpath); err != nil {
+		return "", "", 0, err
+	}
+
+	var content []byte
+	if content, err = os.ReadFile(fpath); err != nil {
+		return "", "", 0, err
+	}
+
+	if patched, preview, err = applyPatch(string(content), patch, format); err != nil {
+		return "", "", 0, err
+	}
+
+	return patched, preview, stat.Mode().Perm(), nil
+}
@@ -0,0 +1,182 @@
+// patch_test.go
+//
+// Things for testing `patch.go`.
+
+package main
+
+import (
+	"testing"
+)
+
+// test `applyPatch` with unified diffs and search/replace blocks
+func TestApplyPatch(t *testing.T) {
+	type test struct {
+		content string
+		patch   string
+		format  string
+
+		patched string
+		failed  bool
+	}
+
+	content := `package main
+
+func main() {
+	println("hello")
+}
+
+func other() {
+	println("hello")
+}
+`
+
+	tests := []test{
+		// unified diff
+		{
+			content: content,
+			patch: `--- a/main.go
++++ b/main.go
+@@ -3,3 +3,4 @@
+ func main() {
+-	println("hello")
++	println("hello, world")
++	println("bye")
+ }
+`,
+			patched: `package main
+
+func main() {
+	println("hello, world")
+	println("bye")
+}
+
+func other() {
+	println("hello")
+}
+`,
+		},
+		// unified diff with ambiguous lines, resolved by line numbers
+		{
+			content: content,
+			patch: `@@ -8 +8 @@
+-	println("hello")
++	println("other")
+`,
+			format: patchFormatUnified,
+			patched: `package main
+
+func main() {
+	println("hello")
+}
+
+func other() {
+	println("other")
+}
+`,
+		},
+		// unified diff of pure insertion
+		{
+			content: "a\nb\n",
+			patch: `@@ -1,0 +2,1 @@
++inserted
+`,
+			patched: "a\ninserted\nb\n",
+		},
+		// search/replace blocks
+		{
+			content: content,
+			patch: `<<<<<<< SEARCH
+func other() {
+	println("hello")
+=======
+func other() {
+	println("other")
+>>>>>>> REPLACE
+<<<<<<< SEARCH
+package main
+=======
+package other
+>>>>>>> REPLACE
+`,
+			failed: true, // NOTE: blocks must be in order
+		},
+		{
+			content: content,
+			patch: `<<<<<<< SEARCH
+package main
+=======
+package other
+>>>>>>> REPLACE
+<<<<<<< SEARCH
+func other() {
+	println("hello")
+=======
+func other() {
+	println("other")
+>>>>>>> REPLACE
+`,
+			patched: `package other
+
+func main() {
+	println("hello")
+}
+
+func other() {
+	println("other")
+}
+`,
+		},
+		// ambiguous search block
+		{
+			content: content,
+			patch: `<<<<<<< SEARCH
+	println("hello")
+=======
+	println("bye")
+>>>>>>> REPLACE
+`,
+			failed: true,
+		},
+		// not found
+		{
+			content: content,
+			patch: `<<<<<<< SEARCH
+	println("not found")
+=======
+	println("bye")
+>>>>>>> REPLACE
+`,
+			failed: true,
+		},
+		// CRLF line endings are kept
+		{
+			content: "a\r\nb\r\n",
+			patch: `<<<<<<< SEARCH
+b
+=======
+c
+>>>>>>> REPLACE
+`,
+			patched: "a\r\nc\r\n",
+		},
+		// unknown format
+		{
+			content: content,
+			patch:   "not a patch",
+			failed:  true,
+		},
+	}
+
+	for i, test := range tests {
+		patched, _, err := applyPatch(test.content, test.patch, test.format)
+		if test.failed {
+			if err == nil {
+				t.Errorf("test #%d: expected to fail, but succeeded with: %q", i+1, patched)
+			}
+		} else if err != nil {
+			t.Errorf("test #%d: failed to apply patch: %s", i+1, err)
+		} else if patched != test.patched {
+			t.Errorf("test #%d: expected %q, got %q", i+1, test.patched, patched)
+		}
+	}
+}
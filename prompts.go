@@ -0,0 +1,229 @@
+// prompts.go
+//
+// Things for prompt templates, served through the self MCP server or used with `--template`.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/template"
+
+	"github.com/adrg/frontmatter"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+const (
+	promptTemplateExtension = ".md"
+)
+
+// a prompt template, read from a Markdown file with front matter
+//
+// eg.
+//
+//	---
+//	description: Review the given diff
+//	arguments:
+//	  - name: language
+//	    description: Programming language of the diff
+//	    required: true
+//	---
+//	Review the following diff written in {{.language}}:
+type promptTemplate struct {
+	Name        string                   `yaml:"name"`
+	Title       string                   `yaml:"title"`
+	Description string                   `yaml:"description"`
+	Arguments   []promptTemplateArgument `yaml:"arguments"`
+
+	Body string `yaml:"-"`
+}
+
+// an argument of a prompt template
+type promptTemplateArgument struct {
+	Name        string `yaml:"name"`
+	Description string `yaml:"description"`
+	Required    bool   `yaml:"required"`
+}
+
+// load prompt templates from Markdown files in given directory
+//
+// (the name of a template is its filename without extension, unless declared in its front matter)
+func loadPromptTemplates(dir string) (templates []promptTemplate, err error) {
+	dir = expandPath(dir)
+
+	var entries []os.DirEntry
+	if entries, err = os.ReadDir(dir); err != nil {
+		return nil, fmt.Errorf("failed to read prompts directory '%s': %w", dir, err)
+	}
+
+	names := map[string]string{}
+	for _, entry := range entries {
+		if entry.IsDir() ||
+			!strings.EqualFold(filepath.Ext(entry.Name()), promptTemplateExtension) {
+			continue
+		}
+
+		fpath := filepath.Join(dir, entry.Name())
+
+		var data []byte
+		if data, err = os.ReadFile(fpath); err != nil {
+			return nil, fmt.Errorf("failed to read prompt template '%s': %w", fpath, err)
+		}
+
+		var tpl promptTemplate
+		var body []byte
+		if body, err = frontmatter.Parse(bytes.NewReader(data), &tpl); err != nil {
+			return nil, fmt.Errorf("failed to parse front matter of prompt template '%s': %w", fpath, err)
+		}
+		if len(tpl.Name) == 0 {
+			tpl.Name = strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name()))
+		}
+		tpl.Body = strings.TrimSpace(string(body))
+
+		// check template syntax
+		if _, err = template.New(tpl.Name).Parse(tpl.Body); err != nil {
+			return nil, fmt.Errorf("failed to parse prompt template '%s': %w", fpath, err)
+		}
+
+		if duplicated, exists := names[tpl.Name]; exists {
+			return nil, fmt.Errorf("duplicated name of prompt templates '%s': '%s' and '%s'", tpl.Name, duplicated, fpath)
+		}
+		names[tpl.Name] = fpath
+
+		templates = append(templates, tpl)
+	}
+
+	return templates, nil
+}
+
+// find a prompt template with given name
+func findPromptTemplate(templates []promptTemplate, name string) (promptTemplate, bool) {
+	idx := slices.IndexFunc(templates, func(t promptTemplate) bool {
+		return t.Name == name
+	})
+	if idx < 0 {
+		return promptTemplate{}, false
+	}
+	return templates[idx], true
+}
+
+// render the prompt template with given arguments
+func (t promptTemplate) render(args map[string]string) (string, error) {
+	for _, arg := range t.Arguments {
+		if _, exists := args[arg.Name]; arg.Required && !exists {
+			return "", fmt.Errorf("missing required argument '%s' for prompt template '%s'", arg.Name, t.Name)
+		}
+	}
+	if args == nil {
+		args = map[string]string{}
+	}
+
+	tpl, err := template.New(t.Name).
+		Option("missingkey=zero").
+		Parse(t.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse prompt template '%s': %w", t.Name, err)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := tpl.Execute(buf, args); err != nil {
+		return "", fmt.Errorf("failed to execute prompt template '%s': %w", t.Name, err)
+	}
+
+	return buf.String(), nil
+}
+
+// add prompt templates to given MCP server
+func addPromptTemplatesToServer(
+	server *mcp.Server,
+	templates []promptTemplate,
+) {
+	for _, t := range templates {
+		arguments := []*mcp.PromptArgument{}
+		for _, arg := range t.Arguments {
+			arguments = append(arguments, &mcp.PromptArgument{
+				Name:        arg.Name,
+				Description: arg.Description,
+				Required:    arg.Required,
+			})
+		}
+
+		server.AddPrompt(
+			&mcp.Prompt{
+				Name:        t.Name,
+				Title:       t.Title,
+				Description: t.Description,
+				Arguments:   arguments,
+			},
+			func(
+				ctx context.Context,
+				request *mcp.GetPromptRequest,
+			) (*mcp.GetPromptResult, error) {
+				rendered, err := t.render(request.Params.Arguments)
+				if err != nil {
+					return nil, err
+				}
+
+				return &mcp.GetPromptResult{
+					Description: t.Description,
+					Messages: []*mcp.PromptMessage{
+						{
+							Role: "user",
+							Content: &mcp.TextContent{
+								Text: rendered,
+							},
+						},
+					},
+				}, nil
+			},
+		)
+	}
+}
+
+// replace the prompt in params with the rendered `--template`
+//
+// (a prompt given with `-p` or stdin is appended to the rendered one)
+func applyPromptTemplate(
+	writer outputWriter,
+	p params,
+) (params, error) {
+	if p.MCPTools.PromptsDirectory == nil {
+		return p, fmt.Errorf("prompts directory is not given for template '%s'", *p.Generation.Template)
+	}
+
+	templates, err := loadPromptTemplates(*p.MCPTools.PromptsDirectory)
+	if err != nil {
+		return p, err
+	}
+
+	tpl, exists := findPromptTemplate(templates, *p.Generation.Template)
+	if !exists {
+		return p, fmt.Errorf("no such prompt template: '%s'", *p.Generation.Template)
+	}
+
+	rendered, err := tpl.render(p.Generation.TemplateArgs)
+	if err != nil {
+		return p, err
+	}
+	if p.Generation.Prompt != nil && len(*p.Generation.Prompt) > 0 {
+		rendered += "\n\n" + *p.Generation.Prompt
+	}
+
+	writer.verbose(
+		verboseMedium,
+		p.Verbose,
+		"rendered prompt template '%s': %s\n\n",
+		tpl.Name,
+		rendered,
+	)
+
+	p.Generation.Prompt = &rendered
+	p.Generation.Template = nil
+
+	return p, nil
+}
@@ -0,0 +1,83 @@
+// prompts_test.go
+//
+// Things for testing `prompts.go`.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// test `loadPromptTemplates` and rendering of loaded templates
+func TestLoadAndRenderPromptTemplates(t *testing.T) {
+	dir := t.TempDir()
+
+	files := map[string]string{
+		"code-review.md": `---
+description: Review the given diff
+arguments:
+  - name: language
+    description: Programming language of the diff
+    required: true
+  - name: focus
+---
+Review the following diff written in {{.language}}.
+{{if .focus}}Focus on: {{.focus}}{{end}}
+`,
+		"changelog.md": `---
+name: release-notes
+title: Release Notes
+---
+Write release notes.
+`,
+		"not-a-template.txt": `ignored`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o640); err != nil {
+			t.Fatalf("failed to write test file: %s", err)
+		}
+	}
+
+	templates, err := loadPromptTemplates(dir)
+	if err != nil {
+		t.Fatalf("failed to load prompt templates: %s", err)
+	}
+	if len(templates) != 2 {
+		t.Fatalf("expected 2 templates, got %d", len(templates))
+	}
+
+	// should be named after its filename
+	review, exists := findPromptTemplate(templates, "code-review")
+	if !exists {
+		t.Fatalf("template 'code-review' was not found")
+	}
+	if len(review.Arguments) != 2 || !review.Arguments[0].Required || review.Arguments[1].Required {
+		t.Errorf("unexpected arguments: %+v", review.Arguments)
+	}
+
+	// should fail without required arguments
+	if _, err := review.render(nil); err == nil {
+		t.Errorf("should fail without required argument 'language'")
+	}
+
+	// should render with arguments
+	if rendered, err := review.render(map[string]string{"language": "Go"}); err != nil {
+		t.Errorf("failed to render template: %s", err)
+	} else if expected := "Review the following diff written in Go.\n"; rendered != expected {
+		t.Errorf("expected '%s', got '%s'", expected, rendered)
+	}
+	if rendered, err := review.render(map[string]string{"language": "Go", "focus": "errors"}); err != nil {
+		t.Errorf("failed to render template: %s", err)
+	} else if expected := "Review the following diff written in Go.\nFocus on: errors"; rendered != expected {
+		t.Errorf("expected '%s', got '%s'", expected, rendered)
+	}
+
+	// should be named as declared in its front matter
+	if notes, exists := findPromptTemplate(templates, "release-notes"); !exists {
+		t.Errorf("template 'release-notes' was not found")
+	} else if notes.Title != "Release Notes" {
+		t.Errorf("expected title 'Release Notes', got '%s'", notes.Title)
+	}
+}
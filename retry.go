@@ -0,0 +1,305 @@
+// retry.go
+//
+// Things for retrying on transient API errors with backoff (`--retries`),
+// rotating api keys on quota exhaustion, and falling back to other models (`--fallback-model`).
+
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"iter"
+	"math/rand/v2"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	gt "github.com/meinside/gemini-things-go"
+	"google.golang.org/genai"
+)
+
+// regular expression for retry hints in error messages (eg. 'Please retry in 23.5s.')
+var retryHintRegex = regexp.MustCompile(`(?i)retry(?:[ -]after:?| in)\s*([0-9]+(?:\.[0-9]+)?)\s*(ms|s)?\b`)
+
+// policy for retrying on transient errors
+type retryPolicy struct {
+	maxRetries int
+	baseDelay  time.Duration
+	maxDelay   time.Duration
+}
+
+// generate a retry policy from given params
+func retryPolicyFrom(p params) retryPolicy {
+	return retryPolicy{
+		maxRetries: max(p.Generation.Retry.MaxRetries, 0),
+		baseDelay:  time.Duration(p.Generation.Retry.DelaySeconds * float64(time.Second)),
+		maxDelay:   time.Duration(p.Generation.Retry.MaxDelaySeconds * float64(time.Second)),
+	}
+}
+
+// return the delay before the retry of given attempt (0-based) which failed with given error
+//
+// (retry hints from the server are honored up to the max delay; otherwise it grows exponentially with jitter)
+func (r retryPolicy) delay(attempt int, err error) time.Duration {
+	if hint, exists := retryAfter(err); exists {
+		if r.maxDelay > 0 && hint > r.maxDelay {
+			return r.maxDelay
+		}
+		return hint
+	}
+
+	delay := r.maxDelay
+	if attempt < 32 {
+		if exponential := r.baseDelay << attempt; exponential > 0 && exponential < r.maxDelay {
+			delay = exponential
+		}
+	}
+	if delay <= 0 {
+		return 0
+	}
+
+	// NOTE: randomize it between the half and the full delay, for not retrying all at once
+	return delay/2 + rand.N(delay/2+1)
+}
+
+// return the retry delay hinted by the server in given error
+func retryAfter(err error) (time.Duration, bool) {
+	ae, isAPIError := gt.APIError(err)
+	if !isAPIError {
+		return 0, false
+	}
+
+	// `google.rpc.RetryInfo` in details
+	for _, detail := range ae.Details {
+		if typ, _ := detail["@type"].(string); !strings.HasSuffix(typ, "google.rpc.RetryInfo") {
+			continue
+		}
+		if retryDelay, ok := detail["retryDelay"].(string); ok {
+			if delay, err := time.ParseDuration(retryDelay); err == nil && delay >= 0 {
+				return delay, true
+			}
+		}
+	}
+
+	// or, in the message
+	if matches := retryHintRegex.FindStringSubmatch(ae.Message); len(matches) == 3 {
+		if value, err := strconv.ParseFloat(matches[1], 64); err == nil {
+			unit := time.Second
+			if matches[2] == "ms" {
+				unit = time.Millisecond
+			}
+			return time.Duration(value * float64(unit)), true
+		}
+	}
+
+	return 0, false
+}
+
+// check if given error is transient, so generation can be retried
+func isRetriableError(err error) bool {
+	var blocked *blockedError
+	switch {
+	case err == nil,
+		errors.As(err, &blocked),
+		errors.Is(err, context.Canceled),
+		errors.Is(err, context.DeadlineExceeded): // NOTE: timeout of the whole generation
+		return false
+	case gt.IsQuotaExceeded(err),
+		gt.IsModelOverloaded(err):
+		return true
+	}
+
+	if ae, isAPIError := gt.APIError(err); isAPIError {
+		switch ae.Code {
+		case 429, 500, 502, 503, 504:
+			return true
+		}
+		return false
+	}
+
+	// failures of connections (eg. while streaming)
+	var netErr net.Error
+	return errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.As(err, &netErr)
+}
+
+// a client for generating with a model (and an api key)
+type modelClient struct {
+	model string
+	gtc   *gt.Client // (nil until its first use, then created with `create`)
+
+	create    func() (*gt.Client, error)
+	configure func(gtc *gt.Client) // (applied to the client when it is created)
+
+	apiKey string      // (empty if not one of multiple api keys)
+	keys   *apiKeyRing // (for cooling down the api key on quota exhaustion)
+}
+
+// return the gemini-things client, creating and configuring it on its first use
+func (c *modelClient) client() (*gt.Client, error) {
+	if c.gtc == nil {
+		gtc, err := c.create()
+		if err != nil {
+			return nil, err
+		}
+		if c.configure != nil {
+			c.configure(gtc)
+		}
+		c.gtc = gtc
+	}
+	return c.gtc, nil
+}
+
+// check if given error is from an exhausted quota
+func isQuotaError(err error) bool {
+	if gt.IsQuotaExceeded(err) {
+		return true
+	}
+	ae, isAPIError := gt.APIError(err)
+	return isAPIError && ae.Code == 429
+}
+
+// run given function with the api keys of given config in order,
+// rotating to the next one when the quota of a key is exhausted
+//
+// (for requests which are not streamed, eg. embeddings, caching contexts, and generating videos)
+func withAPIKeyRotation(
+	writer outputWriter,
+	conf config,
+	fn func(conf config) (int, error),
+) (exit int, err error) {
+	if conf.apiKeys == nil {
+		return fn(conf)
+	}
+
+	for i, key := range conf.apiKeys.keys {
+		if i > 0 {
+			writer.warn("Rotating to the next API key: %s", maskAPIKey(key))
+			writer.emit(eventRetry, map[string]any{
+				"error": gt.ErrToStr(err),
+			})
+		}
+
+		c := conf
+		c.GoogleAIAPIKey = &key
+		if exit, err = fn(c); err == nil || !isQuotaError(err) {
+			return exit, err
+		}
+
+		hint, _ := retryAfter(err)
+		if err := conf.apiKeys.coolDown(key, hint); err != nil {
+			writer.warn("Failed to cool down API key: %s", err)
+		}
+	}
+
+	return exit, err
+}
+
+// generate stream with given clients in order, retrying on transient errors with given policy
+//
+// (each client is retried until its retries are exhausted, then the next one is tried;
+// when the quota of a client's api key is exhausted, the key is cooled down and the next one is tried at once)
+//
+// (`resume` returns contents for the next attempt, so that failures in the middle of a stream
+// can be resumed with what was generated so far)
+func generateStreamWithRetries(
+	ctx context.Context,
+	writer outputWriter,
+	clients []modelClient,
+	contents []*genai.Content,
+	resume func() []*genai.Content,
+	opts *genai.GenerateContentConfig,
+	policy retryPolicy,
+) iter.Seq2[*genai.GenerateContentResponse, error] {
+	return func(yield func(*genai.GenerateContentResponse, error) bool) {
+		var failed error
+
+		for i := range clients {
+			client := &clients[i] // (for keeping the lazily created client)
+
+			if i > 0 {
+				if client.model == clients[i-1].model {
+					writer.warn("Rotating to the next API key: %s", maskAPIKey(client.apiKey))
+				} else {
+					writer.warn("Falling back to model: %s", client.model)
+				}
+				writer.emit(eventRetry, map[string]any{
+					"model": client.model,
+					"error": gt.ErrToStr(failed),
+				})
+
+				contents = resume()
+			}
+
+			gtc, err := client.client()
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+
+			for attempt := 0; ; attempt++ {
+				failed = nil
+				for it, err := range gtc.GenerateStreamIterated(ctx, contents, opts) {
+					if err != nil {
+						failed = err
+						break
+					}
+					if !yield(it, nil) {
+						return
+					}
+				}
+				if failed == nil { // finished successfully
+					return
+				}
+				if !isRetriableError(failed) {
+					yield(nil, failed)
+					return
+				}
+				if client.keys != nil && isQuotaError(failed) {
+					hint, _ := retryAfter(failed)
+					if err := client.keys.coolDown(client.apiKey, hint); err != nil {
+						writer.warn("Failed to cool down API key: %s", err)
+					}
+
+					if i < len(clients)-1 { // rotate to the next api key (or fall back to the next model)
+						break
+					}
+				}
+				if attempt >= policy.maxRetries { // fall back to the next client
+					break
+				}
+
+				delay := policy.delay(attempt, failed)
+				writer.warn(
+					"Retrying in %s (%d/%d): %s",
+					delay.Round(time.Millisecond),
+					attempt+1,
+					policy.maxRetries,
+					gt.ErrToStr(failed),
+				)
+				writer.emit(eventRetry, map[string]any{
+					"model":         client.model,
+					"attempt":       attempt + 1,
+					"delay_seconds": delay.Seconds(),
+					"error":         gt.ErrToStr(failed),
+				})
+
+				select {
+				case <-ctx.Done():
+					yield(nil, failed)
+					return
+				case <-time.After(delay):
+				}
+
+				contents = resume()
+			}
+		}
+
+		yield(nil, failed)
+	}
+}
@@ -0,0 +1,275 @@
+// retry_test.go
+//
+// Things for testing `retry.go`.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	gt "github.com/meinside/gemini-things-go"
+	"google.golang.org/genai"
+)
+
+// test `isRetriableError` with various errors
+func TestIsRetriableError(t *testing.T) {
+	type test struct {
+		err      error
+		expected bool
+	}
+
+	tests := []test{
+		{
+			err:      nil,
+			expected: false,
+		},
+		{
+			err:      genai.APIError{Code: 429, Message: "You exceeded your current quota"},
+			expected: true,
+		},
+		{
+			err:      fmt.Errorf("wrapped: %w", genai.APIError{Code: 503, Message: "The model is overloaded."}),
+			expected: true,
+		},
+		{
+			err:      genai.APIError{Code: 500, Message: "internal error"},
+			expected: true,
+		},
+		{
+			err:      genai.APIError{Code: 400, Message: "invalid argument"},
+			expected: false,
+		},
+		{
+			err:      genai.APIError{Code: 404, Message: "model not found"},
+			expected: false,
+		},
+		{
+			err:      fmt.Errorf("stream failed: %w", io.ErrUnexpectedEOF),
+			expected: true,
+		},
+		{
+			err:      fmt.Errorf("generation timed out: %w", context.DeadlineExceeded),
+			expected: false,
+		},
+		{
+			err:      &blockedError{target: "response", reason: "SAFETY"},
+			expected: false,
+		},
+		{
+			err:      errors.New("something went wrong"),
+			expected: false,
+		},
+	}
+
+	for _, test := range tests {
+		if retriable := isRetriableError(test.err); retriable != test.expected {
+			t.Errorf("expected %t for '%v', got %t", test.expected, test.err, retriable)
+		}
+	}
+}
+
+// test `retryAfter` with retry hints in errors
+func TestRetryAfter(t *testing.T) {
+	type test struct {
+		err            error
+		expectedDelay  time.Duration
+		expectedExists bool
+	}
+
+	tests := []test{
+		{ // retry info in details
+			err: genai.APIError{
+				Code:    429,
+				Message: "You exceeded your current quota",
+				Details: []map[string]any{
+					{"@type": "type.googleapis.com/google.rpc.QuotaFailure"},
+					{"@type": "type.googleapis.com/google.rpc.RetryInfo", "retryDelay": "23s"},
+				},
+			},
+			expectedDelay:  23 * time.Second,
+			expectedExists: true,
+		},
+		{ // retry hint in the message
+			err:            genai.APIError{Code: 429, Message: "You exceeded your current quota. Please retry in 1.5s."},
+			expectedDelay:  1500 * time.Millisecond,
+			expectedExists: true,
+		},
+		{
+			err:            genai.APIError{Code: 503, Message: "Service unavailable, Retry-After: 250ms"},
+			expectedDelay:  250 * time.Millisecond,
+			expectedExists: true,
+		},
+		{ // no hint
+			err:            genai.APIError{Code: 503, Message: "The model is overloaded."},
+			expectedExists: false,
+		},
+		{ // not an api error
+			err:            errors.New("please retry in 3s"),
+			expectedExists: false,
+		},
+	}
+
+	for _, test := range tests {
+		delay, exists := retryAfter(test.err)
+		if exists != test.expectedExists {
+			t.Errorf("expected existence %t for '%v', got %t", test.expectedExists, test.err, exists)
+		} else if delay != test.expectedDelay {
+			t.Errorf("expected delay %s for '%v', got %s", test.expectedDelay, test.err, delay)
+		}
+	}
+}
+
+// test `retryPolicy.delay` with exponential backoff and retry hints
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := retryPolicy{
+		maxRetries: 10,
+		baseDelay:  time.Second,
+		maxDelay:   5 * time.Second,
+	}
+	overloaded := genai.APIError{Code: 503, Message: "The model is overloaded."}
+
+	type test struct {
+		attempt  int
+		min, max time.Duration
+	}
+
+	tests := []test{
+		{attempt: 0, min: 500 * time.Millisecond, max: time.Second},
+		{attempt: 1, min: time.Second, max: 2 * time.Second},
+		{attempt: 2, min: 2 * time.Second, max: 4 * time.Second},
+		{attempt: 3, min: 2500 * time.Millisecond, max: 5 * time.Second}, // (capped)
+		{attempt: 100, min: 2500 * time.Millisecond, max: 5 * time.Second},
+	}
+
+	for _, test := range tests {
+		for range 20 {
+			if delay := policy.delay(test.attempt, overloaded); delay < test.min || delay > test.max {
+				t.Errorf("expected delay of attempt %d between %s and %s, got %s", test.attempt, test.min, test.max, delay)
+			}
+		}
+	}
+
+	// retry hints are honored
+	hinted := genai.APIError{Code: 429, Message: "You exceeded your current quota. Please retry in 3s."}
+	if delay := policy.delay(0, hinted); delay != 3*time.Second {
+		t.Errorf("expected hinted delay of 3s, got %s", delay)
+	}
+
+	// retry hints are capped by the max delay
+	hinted = genai.APIError{Code: 429, Message: "You exceeded your current quota. Please retry in 30s."}
+	if delay := policy.delay(0, hinted); delay != 5*time.Second {
+		t.Errorf("expected hinted delay capped to 5s, got %s", delay)
+	}
+}
+
+// test `withAPIKeyRotation` with quota and other errors
+func TestWithAPIKeyRotation(t *testing.T) {
+	quota := genai.APIError{Code: 429, Message: "You exceeded your current quota."}
+	invalid := genai.APIError{Code: 400, Message: "Invalid argument."}
+
+	type test struct {
+		errs map[string]error // (errors for each api key)
+
+		expectedKeys  []string // (api keys tried in order)
+		expectedError string   // (empty for no error)
+	}
+
+	tests := []test{
+		// should stop at the first success
+		{
+			expectedKeys: []string{"key-a"},
+		},
+		// should rotate to the next key on quota exhaustion
+		{
+			errs:         map[string]error{"key-a": quota},
+			expectedKeys: []string{"key-a", "key-b"},
+		},
+		// should not rotate on other errors
+		{
+			errs:          map[string]error{"key-a": invalid},
+			expectedKeys:  []string{"key-a"},
+			expectedError: invalid.Error(),
+		},
+		// should return the last error when all keys are exhausted
+		{
+			errs:          map[string]error{"key-a": quota, "key-b": quota, "key-c": quota},
+			expectedKeys:  []string{"key-a", "key-b", "key-c"},
+			expectedError: quota.Error(),
+		},
+	}
+
+	for _, test := range tests {
+		statePath := filepath.Join(t.TempDir(), apiKeysStateFilename)
+		ring, err := newAPIKeyRing([]string{"key-a", "key-b", "key-c"}, apiKeySelectionFailover, time.Minute, statePath)
+		if err != nil {
+			t.Fatalf("failed to create api key ring: %s", err)
+		}
+
+		tried := []string{}
+		_, err = withAPIKeyRotation(newStdoutWriter(), config{apiKeys: ring}, func(conf config) (int, error) {
+			tried = append(tried, *conf.GoogleAIAPIKey)
+			if err := test.errs[*conf.GoogleAIAPIKey]; err != nil {
+				return 1, err
+			}
+			return 0, nil
+		})
+		if !slices.Equal(tried, test.expectedKeys) {
+			t.Errorf("expected keys %v to be tried, got %v", test.expectedKeys, tried)
+		}
+		if (err == nil && test.expectedError != "") || (err != nil && err.Error() != test.expectedError) {
+			t.Errorf("expected error '%s', got %v", test.expectedError, err)
+		}
+
+		// keys with exhausted quotas are cooled down
+		state := ring.readState()
+		for key, err := range test.errs {
+			if _, cooled := state.Cooldowns[apiKeyID(key)]; cooled != isQuotaError(err) {
+				t.Errorf("expected cooldown of '%s' to be %t", key, isQuotaError(err))
+			}
+		}
+	}
+}
+
+// test that `modelClient` is created and configured only on its first use
+func TestModelClientLazyCreation(t *testing.T) {
+	created, configured := 0, 0
+	client := modelClient{
+		model: "test-model",
+		create: func() (*gt.Client, error) {
+			created++
+			return &gt.Client{}, nil
+		},
+		configure: func(gtc *gt.Client) {
+			configured++
+		},
+	}
+	if created != 0 {
+		t.Errorf("expected no client before the first use, got %d", created)
+	}
+
+	first, err := client.client()
+	if err != nil {
+		t.Fatalf("failed to create client: %s", err)
+	}
+	second, _ := client.client()
+	if first != second || created != 1 || configured != 1 {
+		t.Errorf("expected the client to be created and configured once, got %d and %d", created, configured)
+	}
+
+	// creation errors are returned
+	failing := modelClient{
+		create: func() (*gt.Client, error) {
+			return nil, errNoCredentials
+		},
+	}
+	if _, err := failing.client(); !errors.Is(err, errNoCredentials) {
+		t.Errorf("expected error %v, got %v", errNoCredentials, err)
+	}
+}
@@ -6,7 +6,6 @@ package main
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"os"
 	"time"
@@ -77,7 +76,7 @@ func withGTClient(
 ) (int, error) {
 	gtc, err := gtClient(conf, options...)
 	if err != nil {
-		return 1, err
+		return exitCodeForClientError(err), err
 	}
 	defer func() {
 		if err := gtc.Close(); err != nil {
@@ -88,6 +87,18 @@ func withGTClient(
 	return fn(gtc)
 }
 
+// withRotatedGTClient is like withGTClient, but rotates api keys when their quotas are exhausted.
+func withRotatedGTClient(
+	writer outputWriter,
+	conf config,
+	fn func(gtc *gt.Client) (int, error),
+	options ...gt.ClientOption,
+) (int, error) {
+	return withAPIKeyRotation(writer, conf, func(conf config) (int, error) {
+		return withGTClient(writer, conf, fn, options...)
+	})
+}
+
 // run with params
 func run(
 	parser *flags.Parser,
@@ -101,7 +112,7 @@ func run(
 			"No task was requested.\n\n",
 		)
 
-		return writer.printHelpBeforeExit(1, parser), nil
+		return writer.printHelpBeforeExit(exitCodeBadInput, parser), nil
 	}
 
 	// early return after printing the version
@@ -116,16 +127,36 @@ func run(
 		return writer.printHelpBeforeExit(0, parser), nil
 	}
 
+	// responses with a schema cannot be stitched, as each part of them should be a valid JSON
+	if p.Generation.DetailedOptions.AutoContinue > 0 && p.Generation.ResponseSchema != nil {
+		return exitCodeBadInput, fmt.Errorf("--auto-continue cannot be used with --response-schema")
+	}
+
+	// check safety settings (before they are merged with the ones in the config)
+	if err = validateSafetySettings(p.Generation.DetailedOptions.SafetySettings); err != nil {
+		return exitCodeBadInput, fmt.Errorf("invalid safety settings: %w", err)
+	}
+
 	// read and apply configs
 	var conf config
 	if conf, p, err = readAndFillConfig(p, writer); err != nil {
-		return 1, fmt.Errorf("failed to read and fill configs: %w", err)
+		return exitCodeConfig, fmt.Errorf("failed to read and fill configs: %w", err)
+	}
+	if err = validateSafetySettings(conf.SafetySettings); err != nil {
+		return exitCodeConfig, fmt.Errorf("invalid safety settings in config: %w", err)
+	}
+
+	// render prompt template
+	if p.Generation.Template != nil {
+		if p, err = applyPromptTemplate(writer, p); err != nil {
+			return exitCodeBadInput, fmt.Errorf("failed to apply prompt template: %w", err)
+		}
 	}
 
 	// expand filepaths (recurse directories)
 	p.Generation.Filepaths, err = expandFilepaths(writer, p)
 	if err != nil {
-		return 1, fmt.Errorf(
+		return exitCodeBadInput, fmt.Errorf(
 			"failed to read given filepaths: %w",
 			err,
 		)
@@ -155,7 +186,7 @@ func runWithPrompt(
 	if p.Embeddings.GenerateEmbeddings {
 		p.Configuration.GoogleAIModel = resolveGoogleAIModel(&p, &conf, modelForEmbeddings)
 
-		return withGTClient(writer, conf, func(gtc *gt.Client) (int, error) {
+		return withRotatedGTClient(writer, conf, func(gtc *gt.Client) (int, error) {
 			return doEmbeddingsGeneration(context.TODO(),
 				writer,
 				conf.TimeoutSeconds,
@@ -168,14 +199,14 @@ func runWithPrompt(
 	// prepare prompts (shared by cache context and generation)
 	prompts, promptFiles, err := preparePrompts(writer, conf, p)
 	if err != nil {
-		return 1, err
+		return exitCodeBadInput, err
 	}
 
 	// cache context with prompt
 	if p.Caching.CacheContext {
 		p.Configuration.GoogleAIModel = resolveGoogleAIModel(&p, &conf, modelForGeneralPurpose)
 
-		return withGTClient(writer, conf, func(gtc *gt.Client) (int, error) {
+		return withRotatedGTClient(writer, conf, func(gtc *gt.Client) (int, error) {
 			return cacheContext(context.TODO(),
 				writer,
 				conf.TimeoutSeconds,
@@ -206,7 +237,7 @@ func preparePrompts(
 		}
 
 		// replace urls in the prompt,
-		replacedPrompt, extractedFiles := replaceURLsInPrompt(writer, conf, p)
+		replacedPrompt, extractedFiles := replaceURLsInPrompt(writer, conf, p, false)
 
 		prompts = append(prompts, gt.PromptFromText(replacedPrompt))
 
@@ -257,18 +288,26 @@ func runGeneration(
 
 	// function call (local)
 	if err := unmarshalJSONFromBytes(p.LocalTools.Tools, &tools); err != nil {
-		return 1, fmt.Errorf("failed to read tools: %w", err)
+		return exitCodeBadInput, fmt.Errorf("failed to read tools: %w", err)
 	}
 
 	var toolConfig *genai.ToolConfig
 	if err := unmarshalJSONFromBytes(p.LocalTools.ToolConfig, &toolConfig); err != nil {
-		return 1, fmt.Errorf("failed to read tool config: %w", err)
+		return exitCodeBadInput, fmt.Errorf("failed to read tool config: %w", err)
 	}
 
 	// function call (MCP)
 	allMCPConnections := make(mcpConnectionsAndTools)
 	defer func() {
 		for _, connDetails := range allMCPConnections {
+			writer.verbose(
+				verboseMedium,
+				p.Verbose,
+				"health of MCP server '%s': %s",
+				connDetails.connection.name(),
+				connDetails.connection.health(),
+			)
+
 			_ = connDetails.connection.Close()
 		}
 	}()
@@ -287,9 +326,17 @@ func runGeneration(
 			p,
 			mcpServerStreamable,
 			serverURL,
+			nil,
 		)
 		if err != nil {
-			return 1, err
+			if p.MCPTools.Optional {
+				writer.warn(
+					"Skipping unreachable MCP server: %s",
+					err,
+				)
+				continue
+			}
+			return exitCodeToolFailure, err
 		}
 		allMCPConnections[serverURL] = *connDetails
 	}
@@ -308,34 +355,59 @@ func runGeneration(
 			p,
 			mcpServerStdio,
 			cmdline,
+			nil,
 		)
 		if err != nil {
-			return 1, err
+			if p.MCPTools.Optional {
+				writer.warn(
+					"Skipping unreachable MCP server: %s",
+					err,
+				)
+				continue
+			}
+			return exitCodeToolFailure, err
 		}
 		allMCPConnections[cmdline] = *connDetails
 	}
 
-	// attach self as a MCP tool
-	if p.MCPTools.WithSelfAsSTDIOCommand {
+	// from local stdio servers in the config file
+	for _, name := range p.MCPTools.STDIOServers {
+		server, exists := conf.MCPStdioServers[name]
+		if !exists {
+			return exitCodeConfig, fmt.Errorf("no such stdio MCP server in config: '%s'", name)
+		}
+
 		ctx, cancel := context.WithTimeout(
 			context.TODO(),
 			mcpDefaultDialTimeoutSeconds*time.Second,
 		)
 		defer cancel()
 
-		if connDetails, err := selfAsMCPTool(ctx, conf, p, writer); err == nil {
-			allMCPConnections[mcpToolNameSelf] = *connDetails
-		} else {
-			return 1, fmt.Errorf("failed to run self as a local MCP tool: %w", err)
+		connDetails, err := fetchAndRegisterMCPTools(
+			ctx,
+			writer,
+			p,
+			mcpServerStdio,
+			name,
+			&server,
+		)
+		if err != nil {
+			if p.MCPTools.Optional {
+				writer.warn(
+					"Skipping unreachable MCP server: %s",
+					err,
+				)
+				continue
+			}
+			return exitCodeToolFailure, err
 		}
+		allMCPConnections[name] = *connDetails
 	}
 
-	// load local skills
-	if p.Skills.SkillsDirectory != nil {
-		// check skills directory
-		p.Skills.SkillsDirectory = new(expandPath(*p.Skills.SkillsDirectory))
-		if _, err := os.Stat(*p.Skills.SkillsDirectory); errors.Is(err, os.ErrNotExist) {
-			return 1, fmt.Errorf("skills directory not found: %w", err)
+	// attach self as a MCP tool
+	if p.MCPTools.WithSelfAsSTDIOCommand {
+		if err := checkMediaOutput(p.MCPTools.SelfMediaOutput); err != nil {
+			return exitCodeBadInput, err
 		}
 
 		ctx, cancel := context.WithTimeout(
@@ -344,10 +416,36 @@ func runGeneration(
 		)
 		defer cancel()
 
-		if connDetails, err := skillsAsMCPTool(ctx, conf, p, writer); err == nil {
-			allMCPConnections[mcpToolNameSkills] = *connDetails
+		if connDetails, err := selfAsMCPTool(ctx, conf, p, writer); err == nil {
+			allMCPConnections[mcpToolNameSelf] = *connDetails
 		} else {
-			return 1, fmt.Errorf("failed to run skills as a local MCP tool: %w", err)
+			return 1, fmt.Errorf("failed to run self as a local MCP tool: %w", err)
+		}
+	}
+
+	// load local skills (from given and auto-discovered directories)
+	skillsDirs, err := resolveSkillsDirectories(conf, p)
+	if err != nil {
+		return exitCodeBadInput, err
+	}
+	if len(skillsDirs) > 0 {
+		merged, err := loadSkills(writer, p, skillsDirs)
+		if err != nil {
+			return exitCodeBadInput, err
+		}
+
+		if len(merged.skills) > 0 {
+			ctx, cancel := context.WithTimeout(
+				context.TODO(),
+				mcpDefaultDialTimeoutSeconds*time.Second,
+			)
+			defer cancel()
+
+			if connDetails, err := skillsAsMCPTool(ctx, p, writer, skillsDirs, merged); err == nil {
+				allMCPConnections[mcpToolNameSkills] = *connDetails
+			} else {
+				return 1, fmt.Errorf("failed to run skills as a local MCP tool: %w", err)
+			}
 		}
 	}
 
@@ -355,7 +453,7 @@ func runGeneration(
 	if value, duplicated := duplicated(
 		keysFromTools(tools, allMCPConnections),
 	); duplicated {
-		return 1, fmt.Errorf(
+		return exitCodeBadInput, fmt.Errorf(
 			"duplicated function name in tools: '%s'",
 			value,
 		)
@@ -382,19 +480,79 @@ func runGeneration(
 		}
 	}
 
+	// prepare files for thoughts and metadata
+	if err := prepareOutputChannels(p); err != nil {
+		return 1, err
+	}
+
 	// gemini things client
-	return withGTClient(writer, conf, func(gtc *gt.Client) (int, error) {
+	//
+	// (videos are generated with a single request, so api keys are rotated around it)
+	withClient := withGTClient
+	if p.Generation.Video.GenerateVideos {
+		withClient = withRotatedGTClient
+	}
+	return withClient(writer, conf, func(gtc *gt.Client) (int, error) {
 		if len(p.Verbose) > 3 {
 			writer.warn("Full verbose mode: %d > 3", len(p.Verbose))
 
 			gtc.Verbose = true
 		}
 
+		// clients for each model and api key (`gtc` first, then other api keys, and fallback models)
+		keys := []string{""} // NOTE: "" for the api key (or credentials) in the config as it is
+		if conf.apiKeys != nil {
+			keys = conf.apiKeys.keys
+		}
+		clients := []modelClient{}
+		defer func() {
+			for _, client := range clients {
+				if client.gtc == nil || client.gtc == gtc {
+					continue
+				}
+				if err := client.gtc.Close(); err != nil {
+					writer.error("Failed to close client: %s", err)
+				}
+			}
+		}()
+		models := append([]string{*p.Configuration.GoogleAIModel}, p.Generation.Retry.FallbackModels...)
+		if p.Caching.CachedContextName != nil && len(models) > 1 {
+			// NOTE: cached contexts are bound to the model they were created with
+			writer.warn("Not falling back to other models, as a cached context is in use.")
+			models = models[:1]
+		}
+		for _, model := range models {
+			for _, key := range keys {
+				client := modelClient{
+					model:  model,
+					gtc:    gtc,
+					apiKey: key,
+					keys:   conf.apiKeys,
+				}
+				if len(clients) > 0 { // NOTE: created lazily, only when retries or fallbacks are needed
+					c := conf
+					if key != "" {
+						c.GoogleAIAPIKey = &key
+					}
+					client.gtc = nil
+					client.create = func() (*gt.Client, error) {
+						created, err := gtClient(c, gt.WithModel(model))
+						if err != nil {
+							return nil, err
+						}
+						created.Verbose = gtc.Verbose
+						return created, nil
+					}
+				}
+				clients = append(clients, client)
+			}
+		}
+
 		return doGeneration(
 			context.TODO(),
 			writer,
 			conf.TimeoutSeconds,
-			gtc,
+			gtc, clients,
 			nil, // NOTE: first call => no history
 			prompts,
 			promptFiles,
@@ -402,6 +560,8 @@ func runGeneration(
 			toolConfig,
 			allMCPConnections,
 			nil, // NOTE: first call => no thought signature
+			nil, // NOTE: first call => no markdown renderer
+			nil, // NOTE: first call => no citations
 			p,
 		)
 	}, gt.WithModel(*p.Configuration.GoogleAIModel))
@@ -423,7 +583,7 @@ func runWithoutPrompt(
 
 	// cache context (files only)
 	if p.Caching.CacheContext {
-		return withGTClient(writer, conf, func(gtc *gt.Client) (int, error) {
+		return withRotatedGTClient(writer, conf, func(gtc *gt.Client) (int, error) {
 			return cacheContext(
 				context.TODO(),
 				writer,
@@ -462,6 +622,21 @@ func runWithoutPrompt(
 		})
 	}
 
+	// list skills
+	if p.Skills.ListSkills {
+		return listSkills(writer, conf, p)
+	}
+
+	// create a new skill
+	if p.Skills.NewSkill != nil {
+		return newSkill(writer, conf, p)
+	}
+
+	// validate skills
+	if p.Skills.ValidateSkills != nil {
+		return validateSkills(writer, p)
+	}
+
 	// list models
 	if p.ListModels {
 		return withGTClient(writer, conf, func(gtc *gt.Client) (int, error) {
@@ -479,7 +654,7 @@ func runWithoutPrompt(
 	if p.Embeddings.GenerateEmbeddings {
 		p.Configuration.GoogleAIModel = resolveGoogleAIModel(&p, &conf, modelForEmbeddings)
 
-		return withGTClient(writer, conf, func(gtc *gt.Client) (int, error) {
+		return withRotatedGTClient(writer, conf, func(gtc *gt.Client) (int, error) {
 			return doEmbeddingsGeneration(context.TODO(),
 				writer,
 				conf.TimeoutSeconds,
@@ -560,7 +735,7 @@ func runWithoutPrompt(
 	}
 
 	// should not reach here
-	writer.printWithColorForLevel(
+	writer.errorWithColorForLevel(
 		verboseMedium,
 		"Parameter error: no task was requested or handled properly.",
 	)
@@ -575,12 +750,12 @@ func runUploadToFileSearchStore(
 	p params,
 ) (int, error) {
 	if len(p.Generation.Filepaths) == 0 {
-		return 1, fmt.Errorf("no file was given for file search store '%s'", *p.FileSearch.FileSearchStoreNameToUploadFiles)
+		return exitCodeBadInput, fmt.Errorf("no file was given for file search store '%s'", *p.FileSearch.FileSearchStoreNameToUploadFiles)
 	}
 
 	files, err := openFilesForPrompt(nil, p.Generation.Filepaths)
 	if err != nil {
-		return 1, fmt.Errorf("failed to open files for file search: %s", err)
+		return exitCodeBadInput, fmt.Errorf("failed to open files for file search: %s", err)
 	}
 
 	// close files
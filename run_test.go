@@ -0,0 +1,97 @@
+// run_test.go
+//
+// Things for testing `run.go`.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jessevdk/go-flags"
+)
+
+// test `run` with invalid params and configs
+func TestRunWithInvalidParams(t *testing.T) {
+	configFilepath := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(configFilepath, []byte(`{"google_ai_api_key": "xyz", "safety_settings": {"dangerous-content": "sometimes"}}`), 0o600); err != nil {
+		t.Fatalf("failed to write config file: %s", err)
+	}
+	validConfigFilepath := filepath.Join(t.TempDir(), "valid.json")
+	if err := os.WriteFile(validConfigFilepath, []byte(`{"google_ai_api_key": "xyz", "mcp_stdio_servers": {}}`), 0o600); err != nil {
+		t.Fatalf("failed to write config file: %s", err)
+	}
+	noCredentialsConfigFilepath := filepath.Join(t.TempDir(), "no_credentials.json")
+	if err := os.WriteFile(noCredentialsConfigFilepath, []byte(`{"google_credentials_filepath": "/no/such/credentials.json", "location": "us-central1", "gcs_bucket_name_for_file_uploads": "bucket"}`), 0o600); err != nil {
+		t.Fatalf("failed to write config file: %s", err)
+	}
+
+	type test struct {
+		autoContinue   int
+		responseSchema *string
+		safetySettings map[string]string
+		configFilepath *string
+		template       *string
+		stdioServers   []string
+
+		expectedExit  int
+		expectedError string
+	}
+
+	tests := []test{
+		{ // auto-continue with a response schema
+			autoContinue:   2,
+			responseSchema: new("schema.json"),
+			expectedExit:   exitCodeBadInput,
+			expectedError:  "--auto-continue cannot be used with --response-schema",
+		},
+		{ // invalid safety settings in params
+			safetySettings: map[string]string{"no-such-category": "only-high"},
+			expectedExit:   exitCodeBadInput,
+			expectedError:  "unknown harm category",
+		},
+		{ // invalid safety settings in the config file
+			configFilepath: &configFilepath,
+			expectedExit:   exitCodeConfig,
+			expectedError:  "invalid safety settings in config",
+		},
+		{ // no such prompt template
+			configFilepath: &validConfigFilepath,
+			template:       new("no_such_template"),
+			expectedExit:   exitCodeBadInput,
+			expectedError:  "failed to apply prompt template",
+		},
+		{ // no such stdio MCP server in the config file
+			configFilepath: &validConfigFilepath,
+			stdioServers:   []string{"no_such_server"},
+			expectedExit:   exitCodeConfig,
+			expectedError:  "no such stdio MCP server in config",
+		},
+		{ // no credentials file for the config file
+			configFilepath: &noCredentialsConfigFilepath,
+			expectedExit:   exitCodeConfig,
+			expectedError:  "failed to read google credentials",
+		},
+	}
+
+	for _, test := range tests {
+		var p params
+		p.Generation.Prompt = new("hello")
+		p.Generation.DetailedOptions.AutoContinue = test.autoContinue
+		p.Generation.ResponseSchema = test.responseSchema
+		p.Generation.DetailedOptions.SafetySettings = test.safetySettings
+		p.Configuration.ConfigFilepath = test.configFilepath
+		p.Generation.Template = test.template
+		p.MCPTools.STDIOServers = test.stdioServers
+
+		exit, err := run(flags.NewParser(&p, flags.Default), newStdoutWriter(), p)
+		if exit != test.expectedExit {
+			t.Errorf("expected exit code %d, got %d", test.expectedExit, exit)
+		}
+		if err == nil || !strings.Contains(err.Error(), test.expectedError) {
+			t.Errorf("expected error '%s', got %v", test.expectedError, err)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+// safety.go
+//
+// Things for safety settings, and reporting blocked prompts or responses.
+
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"google.golang.org/genai"
+)
+
+// all harm categories which can be configured
+var harmCategories = []genai.HarmCategory{
+	genai.HarmCategoryHarassment,
+	genai.HarmCategoryHateSpeech,
+	genai.HarmCategorySexuallyExplicit,
+	genai.HarmCategoryDangerousContent,
+	genai.HarmCategoryCivicIntegrity,
+	genai.HarmCategoryImageHate,
+	genai.HarmCategoryImageDangerousContent,
+	genai.HarmCategoryImageHarassment,
+	genai.HarmCategoryImageSexuallyExplicit,
+	genai.HarmCategoryJailbreak,
+}
+
+// all harm block thresholds which can be configured
+var harmBlockThresholds = []genai.HarmBlockThreshold{
+	genai.HarmBlockThresholdBlockLowAndAbove,
+	genai.HarmBlockThresholdBlockMediumAndAbove,
+	genai.HarmBlockThresholdBlockOnlyHigh,
+	genai.HarmBlockThresholdBlockNone,
+	genai.HarmBlockThresholdOff,
+}
+
+// finish reasons of blocked responses
+var blockedFinishReasons = []genai.FinishReason{
+	genai.FinishReasonSafety,
+	genai.FinishReasonRecitation,
+	genai.FinishReasonBlocklist,
+	genai.FinishReasonProhibitedContent,
+	genai.FinishReasonSPII,
+	genai.FinishReasonImageSafety,
+	genai.FinishReasonImageProhibitedContent,
+	genai.FinishReasonImageRecitation,
+}
+
+// generate safety settings for the client with given thresholds (category => threshold)
+//
+// NOTE: all possible categories will be turned off, unless their thresholds are given
+func safetySettings(
+	clientType genai.Backend,
+	thresholds map[string]string,
+) ([]*genai.SafetySetting, error) {
+	var categories []genai.HarmCategory
+	switch clientType {
+	case genai.BackendGeminiAPI:
+		categories = []genai.HarmCategory{
+			genai.HarmCategoryHarassment,
+			genai.HarmCategoryHateSpeech,
+			genai.HarmCategorySexuallyExplicit,
+			genai.HarmCategoryDangerousContent,
+		}
+	case genai.BackendVertexAI:
+		categories = []genai.HarmCategory{
+			genai.HarmCategoryHarassment,
+			genai.HarmCategoryHateSpeech,
+			genai.HarmCategorySexuallyExplicit,
+			genai.HarmCategoryDangerousContent,
+			genai.HarmCategoryImageHate,
+			genai.HarmCategoryImageDangerousContent,
+			genai.HarmCategoryImageHarassment,
+			genai.HarmCategoryImageSexuallyExplicit,
+			genai.HarmCategoryJailbreak,
+		}
+	}
+
+	// given thresholds
+	configured := map[genai.HarmCategory]genai.HarmBlockThreshold{}
+	for c, t := range thresholds {
+		category, err := parseHarmCategory(c)
+		if err != nil {
+			return nil, err
+		}
+		threshold, err := parseHarmBlockThreshold(t)
+		if err != nil {
+			return nil, err
+		}
+		configured[category] = threshold
+
+		if !slices.Contains(categories, category) {
+			categories = append(categories, category)
+		}
+	}
+
+	settings := []*genai.SafetySetting{}
+	for _, category := range categories {
+		threshold, exists := configured[category]
+		if !exists {
+			threshold = genai.HarmBlockThresholdOff
+		}
+
+		settings = append(settings, &genai.SafetySetting{
+			Category:  category,
+			Threshold: threshold,
+		})
+	}
+
+	return settings, nil
+}
+
+// check if given thresholds (category => threshold) are all valid
+func validateSafetySettings(thresholds map[string]string) error {
+	for c, t := range thresholds {
+		if _, err := parseHarmCategory(c); err != nil {
+			return err
+		}
+		if _, err := parseHarmBlockThreshold(t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parse given harm category
+//
+// (case-insensitive, and can be without the `HARM_CATEGORY_` prefix, eg. 'dangerous-content')
+func parseHarmCategory(category string) (genai.HarmCategory, error) {
+	normalized := strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(category), "-", "_"))
+	if !strings.HasPrefix(normalized, "HARM_CATEGORY_") {
+		normalized = "HARM_CATEGORY_" + normalized
+	}
+
+	if slices.Contains(harmCategories, genai.HarmCategory(normalized)) {
+		return genai.HarmCategory(normalized), nil
+	}
+	return "", fmt.Errorf("unknown harm category: '%s'", category)
+}
+
+// parse given harm block threshold
+//
+// (case-insensitive, and can be without the `BLOCK_` prefix, eg. 'only-high')
+func parseHarmBlockThreshold(threshold string) (genai.HarmBlockThreshold, error) {
+	normalized := strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(threshold), "-", "_"))
+
+	for _, candidate := range []string{normalized, "BLOCK_" + normalized} {
+		if slices.Contains(harmBlockThresholds, genai.HarmBlockThreshold(candidate)) {
+			return genai.HarmBlockThreshold(candidate), nil
+		}
+	}
+	return "", fmt.Errorf("unknown harm block threshold: '%s'", threshold)
+}
+
+// error for blocked prompts or responses
+type blockedError struct {
+	target  string // 'prompt' or 'response'
+	reason  string
+	message string
+	ratings []*genai.SafetyRating
+}
+
+// return the error string with the reason and safety ratings
+func (e *blockedError) Error() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s was blocked: %s", e.target, e.reason)
+	if e.message != "" {
+		fmt.Fprintf(&sb, " (%s)", e.message)
+	}
+
+	for _, rating := range e.ratings {
+		if rating == nil {
+			continue
+		}
+
+		details := []string{}
+		if rating.Probability != "" {
+			details = append(details, fmt.Sprintf("probability: %s", rating.Probability))
+		}
+		if rating.Severity != "" {
+			details = append(details, fmt.Sprintf("severity: %s", rating.Severity))
+		}
+		if rating.OverwrittenThreshold != "" {
+			details = append(details, fmt.Sprintf("threshold: %s", rating.OverwrittenThreshold))
+		}
+		if rating.Blocked {
+			details = append(details, "blocked")
+		}
+		fmt.Fprintf(&sb, "\n  - %s: %s", rating.Category, strings.Join(details, ", "))
+	}
+
+	return sb.String()
+}
+
+// return an error if the prompt was blocked with given feedback
+func promptBlocked(feedback *genai.GenerateContentResponsePromptFeedback) *blockedError {
+	if feedback == nil ||
+		feedback.BlockReason == "" ||
+		feedback.BlockReason == genai.BlockedReasonUnspecified {
+		return nil
+	}
+
+	return &blockedError{
+		target:  "prompt",
+		reason:  string(feedback.BlockReason),
+		message: feedback.BlockReasonMessage,
+		ratings: feedback.SafetyRatings,
+	}
+}
+
+// return an error if given candidate was blocked
+func responseBlocked(cand *genai.Candidate) *blockedError {
+	if cand == nil || !slices.Contains(blockedFinishReasons, cand.FinishReason) {
+		return nil
+	}
+
+	return &blockedError{
+		target:  "response",
+		reason:  string(cand.FinishReason),
+		message: cand.FinishMessage,
+		ratings: cand.SafetyRatings,
+	}
+}
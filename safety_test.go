@@ -0,0 +1,132 @@
+// safety_test.go
+//
+// Things for testing `safety.go`.
+
+package main
+
+import (
+	"testing"
+
+	"google.golang.org/genai"
+)
+
+// test `safetySettings` with various thresholds
+func TestSafetySettings(t *testing.T) {
+	type test struct {
+		thresholds map[string]string
+		expected   map[genai.HarmCategory]genai.HarmBlockThreshold
+		shouldFail bool
+	}
+
+	tests := []test{
+		{ // all off by default
+			expected: map[genai.HarmCategory]genai.HarmBlockThreshold{
+				genai.HarmCategoryHarassment:       genai.HarmBlockThresholdOff,
+				genai.HarmCategoryHateSpeech:       genai.HarmBlockThresholdOff,
+				genai.HarmCategorySexuallyExplicit: genai.HarmBlockThresholdOff,
+				genai.HarmCategoryDangerousContent: genai.HarmBlockThresholdOff,
+			},
+		},
+		{ // short names and full names
+			thresholds: map[string]string{
+				"dangerous-content":               "only-high",
+				"HARM_CATEGORY_HARASSMENT":        "BLOCK_LOW_AND_ABOVE",
+				"harm_category_civic_integrity":   "none",
+				"Hate_Speech":                     "medium_and_above",
+				"harm-category-sexually-explicit": "off",
+			},
+			expected: map[genai.HarmCategory]genai.HarmBlockThreshold{
+				genai.HarmCategoryHarassment:       genai.HarmBlockThresholdBlockLowAndAbove,
+				genai.HarmCategoryHateSpeech:       genai.HarmBlockThresholdBlockMediumAndAbove,
+				genai.HarmCategorySexuallyExplicit: genai.HarmBlockThresholdOff,
+				genai.HarmCategoryDangerousContent: genai.HarmBlockThresholdBlockOnlyHigh,
+				genai.HarmCategoryCivicIntegrity:   genai.HarmBlockThresholdBlockNone,
+			},
+		},
+		{ // unknown category
+			thresholds: map[string]string{"violence": "none"},
+			shouldFail: true,
+		},
+		{ // unknown threshold
+			thresholds: map[string]string{"harassment": "sometimes"},
+			shouldFail: true,
+		},
+	}
+
+	for _, test := range tests {
+		settings, err := safetySettings(genai.BackendGeminiAPI, test.thresholds)
+		if test.shouldFail {
+			if err == nil {
+				t.Errorf("expected to fail with %v, but succeeded", test.thresholds)
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("failed with %v: %s", test.thresholds, err)
+			continue
+		}
+
+		if len(settings) != len(test.expected) {
+			t.Errorf("expected %d settings, got %d", len(test.expected), len(settings))
+		}
+		for _, setting := range settings {
+			if expected := test.expected[setting.Category]; setting.Threshold != expected {
+				t.Errorf("expected threshold '%s' for '%s', got '%s'", expected, setting.Category, setting.Threshold)
+			}
+		}
+	}
+}
+
+// test `validateSafetySettings` with valid and invalid thresholds
+func TestValidateSafetySettings(t *testing.T) {
+	type test struct {
+		thresholds  map[string]string
+		expectError bool
+	}
+
+	tests := []test{
+		{thresholds: nil},
+		{thresholds: map[string]string{"dangerous-content": "only-high", "HARM_CATEGORY_HARASSMENT": "OFF"}},
+		{thresholds: map[string]string{"no-such-category": "only-high"}, expectError: true},
+		{thresholds: map[string]string{"dangerous-content": "sometimes"}, expectError: true},
+	}
+
+	for _, test := range tests {
+		if err := validateSafetySettings(test.thresholds); (err != nil) != test.expectError {
+			t.Errorf("expected error: %t for %v, got %v", test.expectError, test.thresholds, err)
+		}
+	}
+}
+
+// test `promptBlocked` and `responseBlocked`
+func TestBlocked(t *testing.T) {
+	if promptBlocked(nil) != nil || promptBlocked(&genai.GenerateContentResponsePromptFeedback{}) != nil {
+		t.Errorf("expected prompts without block reasons not to be blocked")
+	}
+	if responseBlocked(&genai.Candidate{FinishReason: genai.FinishReasonMaxTokens}) != nil {
+		t.Errorf("expected responses stopped on max tokens not to be blocked")
+	}
+
+	blocked := promptBlocked(&genai.GenerateContentResponsePromptFeedback{
+		BlockReason:        genai.BlockedReasonSafety,
+		BlockReasonMessage: "unsafe prompt",
+		SafetyRatings: []*genai.SafetyRating{
+			{Category: genai.HarmCategoryDangerousContent, Probability: genai.HarmProbabilityHigh, Blocked: true},
+			{Category: genai.HarmCategoryHarassment, Probability: genai.HarmProbabilityNegligible},
+		},
+	})
+	expected := `prompt was blocked: SAFETY (unsafe prompt)
+  - HARM_CATEGORY_DANGEROUS_CONTENT: probability: HIGH, blocked
+  - HARM_CATEGORY_HARASSMENT: probability: NEGLIGIBLE`
+	if blocked == nil {
+		t.Errorf("expected prompt to be blocked")
+	} else if blocked.Error() != expected {
+		t.Errorf("expected '%s', got '%s'", expected, blocked.Error())
+	}
+
+	blocked = responseBlocked(&genai.Candidate{FinishReason: genai.FinishReasonRecitation})
+	if blocked == nil {
+		t.Errorf("expected response to be blocked")
+	} else if expected := "response was blocked: RECITATION"; blocked.Error() != expected {
+		t.Errorf("expected '%s', got '%s'", expected, blocked.Error())
+	}
+}
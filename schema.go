@@ -0,0 +1,96 @@
+// schema.go
+//
+// Things for generating structured outputs with JSON Schema (`--response-schema`).
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"google.golang.org/genai"
+
+	gt "github.com/meinside/gemini-things-go"
+)
+
+const (
+	// prompt for asking the model to repair its invalid response
+	responseSchemaRepairPromptFormat = `Your last response does not conform to the given JSON schema:
+
+%s
+
+Respond again with only the corrected JSON which conforms to the JSON schema, without any other text.`
+)
+
+// a JSON Schema for responses
+type responseSchema struct {
+	raw      any // (for `genai.GenerateContentConfig.ResponseJsonSchema`)
+	resolved *jsonschema.Resolved
+}
+
+// load a JSON Schema for responses from given filepath
+func loadResponseSchema(fpath string) (*responseSchema, error) {
+	fpath = expandPath(fpath)
+
+	bytes, err := os.ReadFile(fpath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response schema '%s': %w", fpath, err)
+	}
+
+	var raw any
+	if err := json.Unmarshal(bytes, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse response schema '%s': %w", fpath, err)
+	}
+
+	var schema jsonschema.Schema
+	if err := json.Unmarshal(bytes, &schema); err != nil {
+		return nil, fmt.Errorf("failed to parse response schema '%s': %w", fpath, err)
+	}
+	resolved, err := schema.Resolve(nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve response schema '%s': %w", fpath, err)
+	}
+
+	return &responseSchema{
+		raw:      raw,
+		resolved: resolved,
+	}, nil
+}
+
+// validate given response text against this schema
+func (s *responseSchema) validate(text string) error {
+	var instance any
+	if err := json.Unmarshal([]byte(strings.TrimSpace(text)), &instance); err != nil {
+		return fmt.Errorf("response is not a valid JSON: %w", err)
+	}
+
+	if err := s.resolved.Validate(instance); err != nil {
+		return fmt.Errorf("response does not conform to the schema: %w", err)
+	}
+
+	return nil
+}
+
+// return the text of the last model response in given history
+//
+// (texts of all model contents after the last user content are concatenated)
+func lastModelResponseText(history []genai.Content) string {
+	texts := []string{}
+	for _, content := range slices.Backward(history) {
+		if content.Role != string(gt.RoleModel) {
+			break
+		}
+		for _, part := range slices.Backward(content.Parts) {
+			if part != nil && !part.Thought && part.Text != "" {
+				texts = append(texts, part.Text)
+			}
+		}
+	}
+	slices.Reverse(texts)
+
+	return strings.Join(texts, "")
+}
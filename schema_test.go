@@ -0,0 +1,94 @@
+// schema_test.go
+//
+// Things for testing `schema.go`.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"google.golang.org/genai"
+
+	gt "github.com/meinside/gemini-things-go"
+)
+
+// test `responseSchema.validate` with various responses
+func TestResponseSchemaValidate(t *testing.T) {
+	fpath := filepath.Join(t.TempDir(), "schema.json")
+	if err := os.WriteFile(fpath, []byte(`{
+  "type": "object",
+  "properties": {
+    "name": {"type": "string"},
+    "age": {"type": "integer", "minimum": 0}
+  },
+  "required": ["name", "age"]
+}`), 0o644); err != nil {
+		t.Fatalf("failed to write schema: %s", err)
+	}
+
+	schema, err := loadResponseSchema(fpath)
+	if err != nil {
+		t.Fatalf("failed to load schema: %s", err)
+	}
+
+	type test struct {
+		response string
+		valid    bool
+	}
+
+	tests := []test{
+		{response: `{"name": "john", "age": 42}`, valid: true},
+		{response: "\n  {\"name\": \"jane\", \"age\": 0}\n", valid: true},
+		{response: `{"name": "john"}`, valid: false},
+		{response: `{"name": "john", "age": -1}`, valid: false},
+		{response: `{"name": "john", "age": "42"}`, valid: false},
+		{response: `not a json`, valid: false},
+	}
+
+	for _, test := range tests {
+		if err := schema.validate(test.response); (err == nil) != test.valid {
+			t.Errorf("expected validity of '%s' to be %v, got error: %v", test.response, test.valid, err)
+		}
+	}
+}
+
+// test `lastModelResponseText` with various histories
+func TestLastModelResponseText(t *testing.T) {
+	type test struct {
+		history  []genai.Content
+		expected string
+	}
+
+	tests := []test{
+		// no history
+		{
+			expected: "",
+		},
+		// last one is from user
+		{
+			history: []genai.Content{
+				{Role: string(gt.RoleModel), Parts: []*genai.Part{{Text: "old"}}},
+				{Role: string(gt.RoleUser), Parts: []*genai.Part{{Text: "repair it"}}},
+			},
+			expected: "",
+		},
+		// model responses after the last user content, without thoughts
+		{
+			history: []genai.Content{
+				{Role: string(gt.RoleModel), Parts: []*genai.Part{{Text: "old"}}},
+				{Role: string(gt.RoleUser), Parts: []*genai.Part{{Text: "repair it"}}},
+				{Role: string(gt.RoleModel), Parts: []*genai.Part{{Text: "thinking...", Thought: true}, {Text: `{"a":`}}},
+				{Role: string(gt.RoleModel), Parts: []*genai.Part{{Text: ` 1}`}}},
+			},
+			expected: `{"a": 1}`,
+		},
+	}
+
+	for _, test := range tests {
+		if got := lastModelResponseText(test.history); got != test.expected {
+			t.Errorf("expected '%s', got '%s'", test.expected, got)
+		}
+	}
+}
@@ -0,0 +1,925 @@
+// selftools.go
+//
+// Things for exposing embeddings, cached contexts, and file search stores through the self MCP server.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"google.golang.org/genai"
+
+	gt "github.com/meinside/gemini-things-go"
+)
+
+// get an array of strings from function arguments
+func stringsArg(args map[string]any, key string) (values []string) {
+	if arr, _ := gt.FuncArg[[]any](args, key); arr != nil {
+		for _, v := range *arr {
+			if str, ok := v.(string); ok {
+				values = append(values, str)
+			}
+		}
+	}
+	return values
+}
+
+// get an unsigned integer from function arguments
+func uintArg(args map[string]any, key string) *uint {
+	if v, _ := gt.FuncArg[float64](args, key); v != nil && *v > 0 {
+		return new(uint(*v))
+	}
+	return nil
+}
+
+// run given function with a newly created client, and close it after the run
+func withGTClientForMCP(
+	conf config,
+	fn func(gtc *gt.Client) (*mcp.CallToolResult, error),
+	options ...gt.ClientOption,
+) (*mcp.CallToolResult, error) {
+	gtc, err := gtClient(conf, options...)
+	if err != nil {
+		return mcpErrorResult("Failed to initialize Google AI client: %s", err)
+	}
+	defer func() { _ = gtc.Close() }()
+
+	return fn(gtc)
+}
+
+// marshal given value and return it as a JSON result
+func mcpMarshalledResult(v any, what string) (*mcp.CallToolResult, error) {
+	if marshalled, err := json.Marshal(v); err == nil {
+		return mcpJSONResult(marshalled)
+	} else {
+		return mcpErrorResult("Failed to marshal %s: %s", what, err)
+	}
+}
+
+// tools for managing embeddings, cached contexts, and file search stores
+func managementToolsForSelfServer(
+	writer outputWriter,
+	conf config,
+	p params,
+) []toolAndHandler {
+	toolsAndHandlers := make([]toolAndHandler, 0)
+
+	// model for general purpose
+	generationModel := func(model *string) string {
+		if model != nil {
+			return *model
+		}
+		return *resolveGoogleAIModel(&p, &conf, modelForGeneralPurpose)
+	}
+
+	// generate embeddings (read only, idempotent, destructive)
+	toolsAndHandlers = append(toolsAndHandlers, toolAndHandler{
+		tool: mcp.Tool{
+			Name: `gmn_generate_embeddings`,
+			Description: `Use this function when you need to generate embedding vectors of a text or local files, for example for semantic search or clustering.
+
+* NOTE:
+- A long text is split into overlapping chunks, and embeddings are generated for each chunk.
+- Local files are read and sent to the API, so without YOLO mode, this function requires the user's confirmation before running with 'filepaths'.
+- 'filepaths' are not allowed in read-only mode.
+`,
+			InputSchema: &jsonschema.Schema{
+				Type:     "object",
+				ReadOnly: true,
+				Properties: map[string]*jsonschema.Schema{
+					"text": {
+						Title:       "text",
+						Description: `A text to generate embeddings of.`,
+						Type:        "string",
+					},
+					"filepaths": {
+						Title:       "filepaths",
+						Description: `Absolute paths of local files to generate embeddings of.`,
+						Type:        "array",
+					},
+					"task_type": {
+						Title:       "task_type",
+						Description: `The task type of embeddings. If not specified, it will be unspecified.`,
+						Type:        "string",
+						Enum: []any{
+							string(gt.EmbeddingTaskRetrievalQuery),
+							string(gt.EmbeddingTaskRetrievalDocument),
+							string(gt.EmbeddingTaskSemanticSimilarity),
+							string(gt.EmbeddingTaskClassification),
+							string(gt.EmbeddingTaskClustering),
+							string(gt.EmbeddingTaskQuestionAnswering),
+							string(gt.EmbeddingTaskFactVerification),
+							string(gt.EmbeddingTaskCodeRetrievalQuery),
+						},
+					},
+					"chunk_size": {
+						Title:       "chunk_size",
+						Description: fmt.Sprintf(`The size of chunks for a long text. Defaults to %d.`, defaultEmbeddingsChunkSize),
+						Type:        "integer",
+					},
+					"overlapped_chunk_size": {
+						Title:       "overlapped_chunk_size",
+						Description: fmt.Sprintf(`The size of overlapped parts of chunks. Defaults to %d.`, defaultEmbeddingsChunkOverlappedSize),
+						Type:        "integer",
+					},
+					"model": {
+						Title:       "model",
+						Description: `The model to use for embeddings. If not specified, the default model will be used.`,
+						Type:        "string",
+					},
+				},
+			},
+			Annotations: &mcp.ToolAnnotations{
+				DestructiveHint: new(true),
+				IdempotentHint:  true,
+				ReadOnlyHint:    true,
+			},
+		},
+		handler: func(
+			ctx context.Context,
+			request *mcp.CallToolRequest,
+		) (result *mcp.CallToolResult, err error) {
+			// convert arguments
+			var args map[string]any
+			if err = json.Unmarshal(request.Params.Arguments, &args); err != nil {
+				return mcpErrorResult(
+					"Failed to convert arguments to `%T`: %s",
+					args,
+					err,
+				)
+			}
+
+			// get 'text' and 'filepaths',
+			prompts := []gt.Prompt{}
+			if text, _ := gt.FuncArg[string](args, "text"); text != nil {
+				prompts = append(prompts, gt.PromptFromText(*text))
+			}
+			filepaths := stringsArg(args, "filepaths")
+			if len(filepaths) > 0 && p.MCPTools.SelfReadOnly {
+				return mcpErrorResult("Parameter 'filepaths' is not allowed in read-only mode.")
+			}
+			for _, fp := range filepaths {
+				fp = expandPath(fp)
+
+				var bytes []byte
+				if bytes, err = os.ReadFile(fp); err != nil {
+					return mcpErrorResult("Failed to read file for embeddings: %s", err)
+				}
+				prompts = append(prompts, gt.PromptFromBytesWithName(bytes, filepath.Base(fp)))
+			}
+			if len(prompts) <= 0 {
+				return mcpErrorResult("Either 'text' or 'filepaths' is required for embeddings.")
+			}
+
+			// get 'model',
+			model, _ := gt.FuncArg[string](args, "model")
+			if model == nil {
+				if conf.GoogleAIEmbeddingsModel != nil {
+					model = conf.GoogleAIEmbeddingsModel
+				} else {
+					model = new(defaultGoogleAIEmbeddingsModel)
+				}
+			}
+
+			// other options
+			taskType, _ := gt.FuncArg[string](args, "task_type")
+			chunkSize := uintArg(args, "chunk_size")
+			overlappedChunkSize := uintArg(args, "overlapped_chunk_size")
+
+			return withGTClientForMCP(conf, func(gtc *gt.Client) (*mcp.CallToolResult, error) {
+				if embeds, err := generateEmbeddings(
+					ctx,
+					mcpFunctionTimeoutSeconds,
+					gtc,
+					prompts,
+					taskType,
+					chunkSize,
+					overlappedChunkSize,
+				); err == nil {
+					return mcpMarshalledResult(struct {
+						Model      string          `json:"model"`
+						Embeddings []embeddingInfo `json:"embeddings"`
+					}{
+						Model:      *model,
+						Embeddings: embeds,
+					}, "embeddings")
+				} else {
+					return mcpErrorResult("Failed to generate embeddings: %s", gt.ErrToStr(err))
+				}
+			}, gt.WithModel(*model))
+		},
+		confirmHook: func(args map[string]any) (preview string, needsConfirmation bool) {
+			// NOTE: only local files need confirmation, as they are sent to the API
+			return "", len(stringsArg(args, "filepaths")) > 0
+		},
+	})
+
+	// cache context (destructive)
+	toolsAndHandlers = append(toolsAndHandlers, toolAndHandler{
+		tool: mcp.Tool{
+			Name: `gmn_cache_context`,
+			Description: `Use this function when you need to cache local files (and an optional prompt) as a context, for reusing them in later generations without sending them again.
+
+Without YOLO mode, this function requires the user's confirmation before running.
+
+* NOTE:
+- Returns the name of the cached context, which can be used for later generations and deletion.
+`,
+			InputSchema: &jsonschema.Schema{
+				Type:     "object",
+				ReadOnly: true,
+				Properties: map[string]*jsonschema.Schema{
+					"filepaths": {
+						Title:       "filepaths",
+						Description: `Absolute paths of local files to cache.`,
+						Type:        "array",
+					},
+					"prompt": {
+						Title:       "prompt",
+						Description: `An optional text prompt to cache along with the files.`,
+						Type:        "string",
+					},
+					"display_name": {
+						Title:       "display_name",
+						Description: `An optional display name of the cached context.`,
+						Type:        "string",
+					},
+					"model": {
+						Title:       "model",
+						Description: `The model for the cached context. If not specified, the default model will be used.`,
+						Type:        "string",
+					},
+				},
+				Required: []string{
+					"filepaths",
+				},
+			},
+			Annotations: &mcp.ToolAnnotations{
+				DestructiveHint: new(true),
+			},
+		},
+		handler: func(
+			ctx context.Context,
+			request *mcp.CallToolRequest,
+		) (result *mcp.CallToolResult, err error) {
+			// convert arguments
+			var args map[string]any
+			if err = json.Unmarshal(request.Params.Arguments, &args); err != nil {
+				return mcpErrorResult(
+					"Failed to convert arguments to `%T`: %s",
+					args,
+					err,
+				)
+			}
+
+			// get 'prompt' and 'filepaths',
+			prompts := []gt.Prompt{}
+			if prompt, _ := gt.FuncArg[string](args, "prompt"); prompt != nil {
+				prompts = append(prompts, gt.PromptFromText(*prompt))
+			}
+			filepaths := []*string{}
+			for _, fp := range stringsArg(args, "filepaths") {
+				filepaths = append(filepaths, new(expandPath(fp)))
+			}
+			if len(filepaths) <= 0 {
+				return mcpErrorResult("Parameter 'filepaths' is required for caching context.")
+			}
+
+			// (check files before creating a client)
+			for _, fp := range filepaths {
+				if _, err = os.Stat(*fp); err != nil {
+					return mcpErrorResult("Failed to open files: %s", err)
+				}
+			}
+
+			// get 'display_name' and 'model'
+			displayName, _ := gt.FuncArg[string](args, "display_name")
+			model, _ := gt.FuncArg[string](args, "model")
+
+			return withGTClientForMCP(conf, func(gtc *gt.Client) (*mcp.CallToolResult, error) {
+				if name, err := cachePromptsAndFiles(
+					ctx,
+					writer,
+					mcpFunctionTimeoutSeconds,
+					gtc,
+					nil,
+					prompts,
+					nil,
+					filepaths,
+					p.OverrideFileMIMEType,
+					displayName,
+				); err == nil {
+					return mcpMarshalledResult(struct {
+						Name        string  `json:"name"`
+						DisplayName *string `json:"displayName,omitempty"`
+					}{
+						Name:        name,
+						DisplayName: displayName,
+					}, "cached context")
+				} else {
+					return mcpErrorResult("Failed to cache context: %s", gt.ErrToStr(err))
+				}
+			}, gt.WithModel(generationModel(model)))
+		},
+	})
+
+	// list cached contexts (read only, idempotent)
+	toolsAndHandlers = append(toolsAndHandlers, toolAndHandler{
+		tool: mcp.Tool{
+			Name: `gmn_list_cached_contexts`,
+			Description: `Use this function when you need to list all cached contexts, with their models, creation and expiration times, and usage metadata.
+`,
+			InputSchema: &jsonschema.Schema{
+				Type:     "object",
+				ReadOnly: true,
+			},
+			Annotations: &mcp.ToolAnnotations{
+				IdempotentHint: true,
+				ReadOnlyHint:   true,
+			},
+		},
+		handler: func(
+			ctx context.Context,
+			request *mcp.CallToolRequest,
+		) (result *mcp.CallToolResult, err error) {
+			return withGTClientForMCP(conf, func(gtc *gt.Client) (*mcp.CallToolResult, error) {
+				if listed, err := fetchCachedContexts(ctx, mcpFunctionTimeoutSeconds, gtc); err == nil {
+					return mcpMarshalledResult(struct {
+						CachedContexts []*genai.CachedContent `json:"cachedContexts"`
+					}{
+						CachedContexts: listed,
+					}, "cached contexts")
+				} else {
+					return mcpErrorResult("Failed to list cached contexts: %s", gt.ErrToStr(err))
+				}
+			})
+		},
+	})
+
+	// delete cached context (destructive)
+	toolsAndHandlers = append(toolsAndHandlers, toolAndHandler{
+		tool: mcp.Tool{
+			Name: `gmn_delete_cached_context`,
+			Description: `Use this function when you need to delete a cached context with its name.
+
+Without YOLO mode, this function requires the user's confirmation before running.
+`,
+			InputSchema: &jsonschema.Schema{
+				Type:     "object",
+				ReadOnly: true,
+				Properties: map[string]*jsonschema.Schema{
+					"name": {
+						Title:       "name",
+						Description: `The name of a cached context to delete (eg. 'cachedContents/abcd1234').`,
+						Type:        "string",
+					},
+				},
+				Required: []string{
+					"name",
+				},
+			},
+			Annotations: &mcp.ToolAnnotations{
+				DestructiveHint: new(true),
+				IdempotentHint:  true,
+			},
+		},
+		handler: func(
+			ctx context.Context,
+			request *mcp.CallToolRequest,
+		) (result *mcp.CallToolResult, err error) {
+			return withNameArg(request, func(name string) (*mcp.CallToolResult, error) {
+				return withGTClientForMCP(conf, func(gtc *gt.Client) (*mcp.CallToolResult, error) {
+					ctx, cancel := context.WithTimeout(ctx, mcpFunctionTimeoutSeconds*time.Second)
+					defer cancel()
+
+					if err := gtc.DeleteCachedContext(ctx, name); err == nil {
+						return mcpMarshalledResult(struct {
+							Deleted string `json:"deleted"`
+						}{
+							Deleted: name,
+						}, "deleted cached context")
+					} else {
+						return mcpErrorResult("Failed to delete cached context: %s", gt.ErrToStr(err))
+					}
+				})
+			})
+		},
+	})
+
+	// list file search stores (read only, idempotent)
+	toolsAndHandlers = append(toolsAndHandlers, toolAndHandler{
+		tool: mcp.Tool{
+			Name: `gmn_list_file_search_stores`,
+			Description: `Use this function when you need to list all file search stores (for RAG), with their names, display names, document counts, and sizes.
+`,
+			InputSchema: &jsonschema.Schema{
+				Type:     "object",
+				ReadOnly: true,
+			},
+			Annotations: &mcp.ToolAnnotations{
+				IdempotentHint: true,
+				ReadOnlyHint:   true,
+			},
+		},
+		handler: func(
+			ctx context.Context,
+			request *mcp.CallToolRequest,
+		) (result *mcp.CallToolResult, err error) {
+			return withGTClientForMCP(conf, func(gtc *gt.Client) (*mcp.CallToolResult, error) {
+				if stores, err := fetchFileSearchStores(ctx, mcpFunctionTimeoutSeconds, gtc); err == nil {
+					return mcpMarshalledResult(struct {
+						FileSearchStores []*genai.FileSearchStore `json:"fileSearchStores"`
+					}{
+						FileSearchStores: stores,
+					}, "file search stores")
+				} else {
+					return mcpErrorResult("Failed to list file search stores: %s", gt.ErrToStr(err))
+				}
+			})
+		},
+	})
+
+	// create a file search store
+	toolsAndHandlers = append(toolsAndHandlers, toolAndHandler{
+		tool: mcp.Tool{
+			Name: `gmn_create_file_search_store`,
+			Description: `Use this function when you need to create a new file search store (for RAG) with a display name.
+
+* NOTE:
+- Returns the created file search store, whose name is needed for uploading files to it.
+`,
+			InputSchema: &jsonschema.Schema{
+				Type:     "object",
+				ReadOnly: true,
+				Properties: map[string]*jsonschema.Schema{
+					"display_name": {
+						Title:       "display_name",
+						Description: `The display name of a new file search store.`,
+						Type:        "string",
+					},
+				},
+				Required: []string{
+					"display_name",
+				},
+			},
+			Annotations: &mcp.ToolAnnotations{
+				DestructiveHint: new(false),
+			},
+		},
+		handler: func(
+			ctx context.Context,
+			request *mcp.CallToolRequest,
+		) (result *mcp.CallToolResult, err error) {
+			// convert arguments
+			var args map[string]any
+			if err = json.Unmarshal(request.Params.Arguments, &args); err != nil {
+				return mcpErrorResult(
+					"Failed to convert arguments to `%T`: %s",
+					args,
+					err,
+				)
+			}
+
+			// get 'display_name'
+			displayName, _ := gt.FuncArg[string](args, "display_name")
+			if displayName == nil {
+				return mcpErrorResult("Parameter 'display_name' is required for creating a file search store.")
+			}
+
+			return withGTClientForMCP(conf, func(gtc *gt.Client) (*mcp.CallToolResult, error) {
+				ctx, cancel := context.WithTimeout(ctx, mcpFunctionTimeoutSeconds*time.Second)
+				defer cancel()
+
+				if created, err := gtc.CreateFileSearchStore(ctx, *displayName); err == nil {
+					return mcpMarshalledResult(struct {
+						FileSearchStore *genai.FileSearchStore `json:"fileSearchStore"`
+					}{
+						FileSearchStore: created,
+					}, "created file search store")
+				} else {
+					return mcpErrorResult("Failed to create file search store: %s", gt.ErrToStr(err))
+				}
+			})
+		},
+	})
+
+	// delete a file search store (destructive)
+	toolsAndHandlers = append(toolsAndHandlers, toolAndHandler{
+		tool: mcp.Tool{
+			Name: `gmn_delete_file_search_store`,
+			Description: `Use this function when you need to delete a file search store with its name, along with all files in it.
+
+Without YOLO mode, this function requires the user's confirmation before running.
+`,
+			InputSchema: &jsonschema.Schema{
+				Type:     "object",
+				ReadOnly: true,
+				Properties: map[string]*jsonschema.Schema{
+					"name": {
+						Title:       "name",
+						Description: `The name of a file search store to delete (eg. 'fileSearchStores/abcd1234').`,
+						Type:        "string",
+					},
+				},
+				Required: []string{
+					"name",
+				},
+			},
+			Annotations: &mcp.ToolAnnotations{
+				DestructiveHint: new(true),
+				IdempotentHint:  true,
+			},
+		},
+		handler: func(
+			ctx context.Context,
+			request *mcp.CallToolRequest,
+		) (result *mcp.CallToolResult, err error) {
+			return withNameArg(request, func(name string) (*mcp.CallToolResult, error) {
+				return withGTClientForMCP(conf, func(gtc *gt.Client) (*mcp.CallToolResult, error) {
+					ctx, cancel := context.WithTimeout(ctx, mcpFunctionTimeoutSeconds*time.Second)
+					defer cancel()
+
+					if err := gtc.DeleteFileSearchStore(ctx, name); err == nil {
+						return mcpMarshalledResult(struct {
+							Deleted string `json:"deleted"`
+						}{
+							Deleted: name,
+						}, "deleted file search store")
+					} else {
+						return mcpErrorResult("Failed to delete file search store: %s", gt.ErrToStr(err))
+					}
+				})
+			})
+		},
+	})
+
+	// upload files to a file search store (destructive)
+	toolsAndHandlers = append(toolsAndHandlers, toolAndHandler{
+		tool: mcp.Tool{
+			Name: `gmn_upload_files_to_file_search_store`,
+			Description: `Use this function when you need to upload local files to a file search store (for RAG).
+Without YOLO mode, this function requires the user's confirmation before running.
+
+* NOTE:
+- Each uploaded file will have custom metadata: 'filepath', 'filename', and 'mimeType'.
+- Returns the uploaded files and the ones which failed to be uploaded.
+`,
+			InputSchema: &jsonschema.Schema{
+				Type:     "object",
+				ReadOnly: true,
+				Properties: map[string]*jsonschema.Schema{
+					"name": {
+						Title:       "name",
+						Description: `The name of a file search store to upload files to (eg. 'fileSearchStores/abcd1234').`,
+						Type:        "string",
+					},
+					"filepaths": {
+						Title:       "filepaths",
+						Description: `Absolute paths of local files to upload.`,
+						Type:        "array",
+					},
+					"chunk_size": {
+						Title:       "chunk_size",
+						Description: `The maximum number of tokens per chunk. If not specified, the server's default will be used.`,
+						Type:        "integer",
+					},
+					"overlapped_chunk_size": {
+						Title:       "overlapped_chunk_size",
+						Description: `The maximum number of overlapping tokens between chunks. If not specified, the server's default will be used.`,
+						Type:        "integer",
+					},
+				},
+				Required: []string{
+					"name",
+					"filepaths",
+				},
+			},
+			Annotations: &mcp.ToolAnnotations{
+				DestructiveHint: new(true),
+			},
+		},
+		handler: func(
+			ctx context.Context,
+			request *mcp.CallToolRequest,
+		) (result *mcp.CallToolResult, err error) {
+			return withNameArg(request, func(name string) (*mcp.CallToolResult, error) {
+				// convert arguments
+				var args map[string]any
+				if err := json.Unmarshal(request.Params.Arguments, &args); err != nil {
+					return mcpErrorResult(
+						"Failed to convert arguments to `%T`: %s",
+						args,
+						err,
+					)
+				}
+
+				// get 'filepaths', 'chunk_size', and 'overlapped_chunk_size'
+				filepaths := stringsArg(args, "filepaths")
+				if len(filepaths) <= 0 {
+					return mcpErrorResult("Parameter 'filepaths' is required for uploading files.")
+				}
+				chunkConfig := fileSearchChunkingConfig(
+					uintArg(args, "chunk_size"),
+					uintArg(args, "overlapped_chunk_size"),
+				)
+
+				type failure struct {
+					Filepath string `json:"filepath"`
+					Error    string `json:"error"`
+				}
+
+				return withGTClientForMCP(conf, func(gtc *gt.Client) (*mcp.CallToolResult, error) {
+					uploaded, failed := []string{}, []failure{}
+					for _, fp := range filepaths {
+						fp = expandPath(fp)
+
+						if err := uploadSingleFileToFileSearchStore(
+							ctx,
+							mcpFunctionTimeoutSeconds,
+							gtc,
+							name,
+							fp,
+							p.OverrideFileMIMEType,
+							chunkConfig,
+						); err == nil {
+							uploaded = append(uploaded, fp)
+						} else {
+							failed = append(failed, failure{
+								Filepath: fp,
+								Error:    err.Error(),
+							})
+						}
+					}
+
+					return mcpMarshalledResult(struct {
+						FileSearchStore string    `json:"fileSearchStore"`
+						Uploaded        []string  `json:"uploaded"`
+						Failed          []failure `json:"failed,omitempty"`
+					}{
+						FileSearchStore: name,
+						Uploaded:        uploaded,
+						Failed:          failed,
+					}, "uploaded files")
+				})
+			})
+		},
+	})
+
+	// list files in a file search store (read only, idempotent)
+	toolsAndHandlers = append(toolsAndHandlers, toolAndHandler{
+		tool: mcp.Tool{
+			Name: `gmn_list_files_in_file_search_store`,
+			Description: `Use this function when you need to list all files in a file search store, with their names, display names, sizes, mime types, and custom metadata.
+`,
+			InputSchema: &jsonschema.Schema{
+				Type:     "object",
+				ReadOnly: true,
+				Properties: map[string]*jsonschema.Schema{
+					"name": {
+						Title:       "name",
+						Description: `The name of a file search store (eg. 'fileSearchStores/abcd1234').`,
+						Type:        "string",
+					},
+				},
+				Required: []string{
+					"name",
+				},
+			},
+			Annotations: &mcp.ToolAnnotations{
+				IdempotentHint: true,
+				ReadOnlyHint:   true,
+			},
+		},
+		handler: func(
+			ctx context.Context,
+			request *mcp.CallToolRequest,
+		) (result *mcp.CallToolResult, err error) {
+			return withNameArg(request, func(name string) (*mcp.CallToolResult, error) {
+				return withGTClientForMCP(conf, func(gtc *gt.Client) (*mcp.CallToolResult, error) {
+					if files, err := fetchFilesInFileSearchStore(ctx, mcpFunctionTimeoutSeconds, gtc, name); err == nil {
+						return mcpMarshalledResult(struct {
+							FileSearchStore string            `json:"fileSearchStore"`
+							Files           []*genai.Document `json:"files"`
+						}{
+							FileSearchStore: name,
+							Files:           files,
+						}, "files in file search store")
+					} else {
+						return mcpErrorResult("Failed to list files in file search store: %s", gt.ErrToStr(err))
+					}
+				})
+			})
+		},
+	})
+
+	// delete a file in a file search store (destructive)
+	toolsAndHandlers = append(toolsAndHandlers, toolAndHandler{
+		tool: mcp.Tool{
+			Name: `gmn_delete_file_in_file_search_store`,
+			Description: `Use this function when you need to delete a file in a file search store with its name.
+
+Without YOLO mode, this function requires the user's confirmation before running.
+`,
+			InputSchema: &jsonschema.Schema{
+				Type:     "object",
+				ReadOnly: true,
+				Properties: map[string]*jsonschema.Schema{
+					"name": {
+						Title:       "name",
+						Description: `The name of a file to delete (eg. 'fileSearchStores/abcd1234/documents/efgh5678').`,
+						Type:        "string",
+					},
+				},
+				Required: []string{
+					"name",
+				},
+			},
+			Annotations: &mcp.ToolAnnotations{
+				DestructiveHint: new(true),
+				IdempotentHint:  true,
+			},
+		},
+		handler: func(
+			ctx context.Context,
+			request *mcp.CallToolRequest,
+		) (result *mcp.CallToolResult, err error) {
+			return withNameArg(request, func(name string) (*mcp.CallToolResult, error) {
+				return withGTClientForMCP(conf, func(gtc *gt.Client) (*mcp.CallToolResult, error) {
+					ctx, cancel := context.WithTimeout(ctx, mcpFunctionTimeoutSeconds*time.Second)
+					defer cancel()
+
+					if err := gtc.DeleteFileInFileSearchStore(ctx, name); err == nil {
+						return mcpMarshalledResult(struct {
+							Deleted string `json:"deleted"`
+						}{
+							Deleted: name,
+						}, "deleted file")
+					} else {
+						return mcpErrorResult("Failed to delete file in file search store: %s", gt.ErrToStr(err))
+					}
+				})
+			})
+		},
+	})
+
+	// query file search stores (read only)
+	toolsAndHandlers = append(toolsAndHandlers, toolAndHandler{
+		tool: mcp.Tool{
+			Name: `gmn_query_file_search_stores`,
+			Description: `Use this function when you need to answer a question with the files in file search stores (RAG).
+
+* NOTE:
+- Returns the generated answer along with the retrieved contexts (file contents which were referenced for the answer).
+`,
+			InputSchema: &jsonschema.Schema{
+				Type:     "object",
+				ReadOnly: true,
+				Properties: map[string]*jsonschema.Schema{
+					"prompt": {
+						Title:       "prompt",
+						Description: `The question or prompt to answer with the files.`,
+						Type:        "string",
+					},
+					"names": {
+						Title:       "names",
+						Description: `Names of file search stores to search (eg. ['fileSearchStores/abcd1234']).`,
+						Type:        "array",
+					},
+					"metadata_filter": {
+						Title:       "metadata_filter",
+						Description: `An optional filter on custom metadata of files (eg. 'mimeType = "text/plain"').`,
+						Type:        "string",
+					},
+					"model": {
+						Title:       "model",
+						Description: `The model to use for generation. If not specified, the default model will be used.`,
+						Type:        "string",
+					},
+				},
+				Required: []string{
+					"prompt",
+					"names",
+				},
+			},
+			Annotations: &mcp.ToolAnnotations{
+				ReadOnlyHint: true,
+			},
+		},
+		handler: func(
+			ctx context.Context,
+			request *mcp.CallToolRequest,
+		) (result *mcp.CallToolResult, err error) {
+			// convert arguments
+			var args map[string]any
+			if err = json.Unmarshal(request.Params.Arguments, &args); err != nil {
+				return mcpErrorResult(
+					"Failed to convert arguments to `%T`: %s",
+					args,
+					err,
+				)
+			}
+
+			// get 'prompt' and 'names',
+			prompt, _ := gt.FuncArg[string](args, "prompt")
+			if prompt == nil {
+				return mcpErrorResult("Parameter 'prompt' is required for querying file search stores.")
+			}
+			names := stringsArg(args, "names")
+			if len(names) <= 0 {
+				return mcpErrorResult("Parameter 'names' is required for querying file search stores.")
+			}
+
+			// get 'metadata_filter' and 'model'
+			fileSearch := &genai.FileSearch{
+				FileSearchStoreNames: names,
+			}
+			if filter, _ := gt.FuncArg[string](args, "metadata_filter"); filter != nil {
+				fileSearch.MetadataFilter = *filter
+			}
+			model, _ := gt.FuncArg[string](args, "model")
+
+			return withGTClientForMCP(conf, func(gtc *gt.Client) (*mcp.CallToolResult, error) {
+				gtc.SetSystemInstructionFunc(nil)
+
+				ctx, cancel := context.WithTimeout(ctx, mcpFunctionTimeoutSeconds*time.Second)
+				defer cancel()
+
+				if res, err := gtc.Generate(
+					ctx,
+					[]*genai.Content{
+						genai.NewContentFromText(*prompt, gt.RoleUser),
+					},
+					&genai.GenerateContentConfig{
+						Tools: []*genai.Tool{
+							{
+								FileSearch: fileSearch,
+							},
+						},
+					},
+				); err == nil {
+					var answer strings.Builder
+					retrieved := []*genai.GroundingChunkRetrievedContext{}
+					for _, candidate := range res.Candidates {
+						if candidate.Content != nil {
+							for _, part := range candidate.Content.Parts {
+								if !part.Thought {
+									answer.WriteString(part.Text)
+								}
+							}
+						}
+						if candidate.GroundingMetadata != nil {
+							for _, chunk := range candidate.GroundingMetadata.GroundingChunks {
+								if chunk.RetrievedContext != nil {
+									retrieved = append(retrieved, chunk.RetrievedContext)
+								}
+							}
+						}
+					}
+
+					return mcpMarshalledResult(struct {
+						Answer            string                                  `json:"answer"`
+						RetrievedContexts []*genai.GroundingChunkRetrievedContext `json:"retrievedContexts"`
+					}{
+						Answer:            answer.String(),
+						RetrievedContexts: retrieved,
+					}, "query result")
+				} else {
+					return mcpErrorResult("Failed to query file search stores: %s", gt.ErrToStr(err))
+				}
+			}, gt.WithModel(generationModel(model)))
+		},
+	})
+
+	return toolsAndHandlers
+}
+
+// get 'name' from function arguments, and run given function with it
+func withNameArg(
+	request *mcp.CallToolRequest,
+	fn func(name string) (*mcp.CallToolResult, error),
+) (*mcp.CallToolResult, error) {
+	var args map[string]any
+	if err := json.Unmarshal(request.Params.Arguments, &args); err != nil {
+		return mcpErrorResult(
+			"Failed to convert arguments to `%T`: %s",
+			args,
+			err,
+		)
+	}
+
+	if name, err := gt.FuncArg[string](args, "name"); err != nil {
+		return mcpErrorResult("Failed to get parameter 'name': %s", err)
+	} else if name == nil || len(strings.TrimSpace(*name)) == 0 {
+		return mcpErrorResult("Parameter 'name' is required.")
+	} else {
+		return fn(strings.TrimSpace(*name))
+	}
+}
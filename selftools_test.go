@@ -0,0 +1,159 @@
+// selftools_test.go
+//
+// Things for testing `selftools.go`.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// test handlers of management tools with invalid arguments and paths
+//
+// (every case here fails before any request is sent to the API)
+func TestManagementToolsHandlers(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	type test struct {
+		tool     string
+		args     string
+		readOnly bool
+
+		expectedError string // (substring of the error result)
+	}
+
+	tests := []test{
+		// should fail with invalid arguments
+		{
+			tool:          "gmn_generate_embeddings",
+			args:          `[1, 2]`,
+			expectedError: "Failed to convert arguments",
+		},
+		{
+			tool:          "gmn_cache_context",
+			args:          `"not an object"`,
+			expectedError: "Failed to convert arguments",
+		},
+		{
+			tool:          "gmn_upload_files_to_file_search_store",
+			args:          `{`,
+			expectedError: "Failed to convert arguments",
+		},
+		// should fail without required arguments
+		{
+			tool:          "gmn_generate_embeddings",
+			args:          `{}`,
+			expectedError: "Either 'text' or 'filepaths' is required",
+		},
+		{
+			tool:          "gmn_cache_context",
+			args:          `{"prompt": "hello", "filepaths": []}`,
+			expectedError: "Parameter 'filepaths' is required",
+		},
+		{
+			tool:          "gmn_upload_files_to_file_search_store",
+			args:          `{"filepaths": ["/tmp/a.txt"]}`,
+			expectedError: "Parameter 'name' is required",
+		},
+		{
+			tool:          "gmn_upload_files_to_file_search_store",
+			args:          `{"name": "fileSearchStores/abcd1234"}`,
+			expectedError: "Parameter 'filepaths' is required",
+		},
+		// should fail with nonexistent files (with expanded paths)
+		{
+			tool:          "gmn_generate_embeddings",
+			args:          `{"filepaths": ["~/no_such_file.txt"]}`,
+			expectedError: filepath.Join(home, "no_such_file.txt"),
+		},
+		{
+			tool:          "gmn_cache_context",
+			args:          `{"filepaths": ["~/no_such_file.txt"]}`,
+			expectedError: filepath.Join(home, "no_such_file.txt"),
+		},
+		// should not read local files in read-only mode
+		{
+			tool:          "gmn_generate_embeddings",
+			args:          `{"text": "hello", "filepaths": ["~/no_such_file.txt"]}`,
+			readOnly:      true,
+			expectedError: "not allowed in read-only mode",
+		},
+	}
+
+	for _, test := range tests {
+		p := params{}
+		p.MCPTools.SelfReadOnly = test.readOnly
+
+		var handler mcp.ToolHandler
+		for _, th := range managementToolsForSelfServer(newStdoutWriter(), config{}, p) {
+			if th.tool.Name == test.tool {
+				handler = th.handler
+			}
+		}
+		if handler == nil {
+			t.Fatalf("no such tool: '%s'", test.tool)
+		}
+
+		result, err := handler(context.Background(), &mcp.CallToolRequest{
+			Params: &mcp.CallToolParamsRaw{
+				Arguments: json.RawMessage(test.args),
+			},
+		})
+		if err != nil {
+			t.Errorf("unexpected error from '%s': %s", test.tool, err)
+			continue
+		}
+		if !result.IsError || len(result.Content) != 1 {
+			t.Errorf("expected an error result from '%s' with %s, got %+v", test.tool, test.args, result)
+			continue
+		}
+		if text, ok := result.Content[0].(*mcp.TextContent); !ok || !strings.Contains(text.Text, test.expectedError) {
+			t.Errorf("expected '%s' in the error of '%s', got %+v", test.expectedError, test.tool, result.Content[0])
+		}
+	}
+}
+
+// test that management tools which read local files require confirmation
+func TestManagementToolsReadingLocalFiles(t *testing.T) {
+	readers := map[string]bool{
+		"gmn_generate_embeddings":               true,
+		"gmn_cache_context":                     true,
+		"gmn_upload_files_to_file_search_store": true,
+	}
+
+	for _, th := range managementToolsForSelfServer(newStdoutWriter(), config{}, params{}) {
+		if !readers[th.tool.Name] {
+			continue
+		}
+		delete(readers, th.tool.Name)
+
+		if th.tool.Annotations == nil ||
+			th.tool.Annotations.DestructiveHint == nil ||
+			!*th.tool.Annotations.DestructiveHint {
+			t.Errorf("expected '%s' to be destructive", th.tool.Name)
+		}
+	}
+	for name := range readers {
+		t.Errorf("no such tool: '%s'", name)
+	}
+
+	// embeddings of texts need no confirmation
+	for _, th := range managementToolsForSelfServer(newStdoutWriter(), config{}, params{}) {
+		if th.tool.Name != "gmn_generate_embeddings" {
+			continue
+		}
+		if _, needsConfirmation := th.confirmHook(map[string]any{"text": "hello"}); needsConfirmation {
+			t.Errorf("expected no confirmation for embeddings of texts")
+		}
+		if _, needsConfirmation := th.confirmHook(map[string]any{"filepaths": []any{"/tmp/a.txt"}}); !needsConfirmation {
+			t.Errorf("expected confirmation for embeddings of local files")
+		}
+	}
+}
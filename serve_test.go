@@ -0,0 +1,232 @@
+// serve_test.go
+//
+// Things for testing `serve.go`.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// test `filterSelfTools` with various params
+func TestFilterSelfTools(t *testing.T) {
+	toolsAndHandlers := []toolAndHandler{
+		{tool: mcp.Tool{Name: "read_only", Annotations: &mcp.ToolAnnotations{ReadOnlyHint: true}}},
+		{tool: mcp.Tool{Name: "writable", Annotations: &mcp.ToolAnnotations{DestructiveHint: new(true)}}},
+		{tool: mcp.Tool{Name: "no_annotations"}},
+		{tool: mcp.Tool{Name: "gmn_get_envvar", Annotations: &mcp.ToolAnnotations{ReadOnlyHint: true}}},
+		{tool: mcp.Tool{Name: "gmn_generate"}},
+	}
+
+	type test struct {
+		tools    []string
+		excluded []string
+		readOnly bool
+		expected []string
+	}
+
+	tests := []test{
+		// should keep all tools when nothing is given
+		{
+			expected: []string{"read_only", "writable", "no_annotations", "gmn_get_envvar", "gmn_generate"},
+		},
+		// should keep only the given tools
+		{
+			tools:    []string{"writable", "no_such_tool"},
+			expected: []string{"writable"},
+		},
+		// should drop excluded tools
+		{
+			excluded: []string{"writable"},
+			expected: []string{"read_only", "no_annotations", "gmn_get_envvar", "gmn_generate"},
+		},
+		// should keep only read-only tools (without secret readers, and with the generation)
+		{
+			readOnly: true,
+			expected: []string{"read_only", "gmn_generate"},
+		},
+		// should apply all of them together
+		{
+			tools:    []string{"read_only", "writable"},
+			excluded: []string{"read_only"},
+			readOnly: true,
+			expected: []string{},
+		},
+	}
+
+	writer := newStdoutWriter()
+	for _, test := range tests {
+		var p params
+		p.MCPTools.SelfTools = test.tools
+		p.MCPTools.SelfExcludeTools = test.excluded
+		p.MCPTools.SelfReadOnly = test.readOnly
+
+		names := []string{}
+		for _, t := range filterSelfTools(writer, toolsAndHandlers, p) {
+			names = append(names, t.tool.Name)
+		}
+		if !slices.Equal(names, test.expected) {
+			t.Errorf("expected %v, got %v", test.expected, names)
+		}
+	}
+}
+
+// test the read-only preset with the tools of the self MCP server
+func TestSelfReadOnlyPreset(t *testing.T) {
+	var p params
+	p.MCPTools.SelfReadOnly = true
+
+	_, tools, _, err := buildSelfServer(newStdoutWriter(), config{}, p)
+	if err != nil {
+		t.Fatalf("failed to build self server: %s", err)
+	}
+	names := []string{}
+	for _, tool := range tools {
+		names = append(names, tool.Name)
+	}
+
+	for _, name := range []string{
+		"gmn_generate",
+		"gmn_list_models",
+		"gmn_get_cwd",
+		"gmn_list_files",
+	} {
+		if !slices.Contains(names, name) {
+			t.Errorf("expected '%s' in the read-only preset, got %v", name, names)
+		}
+	}
+	for _, name := range []string{
+		"gmn_list_envvar_names",
+		"gmn_get_envvar",
+		"gmn_read_text_file",
+		"gmn_read_file_range",
+		"gmn_search_files",
+		"gmn_create_text_file",
+		"gmn_run_cmdline",
+	} {
+		if slices.Contains(names, name) {
+			t.Errorf("expected no '%s' in the read-only preset, got %v", name, names)
+		}
+	}
+}
+
+// test the confirmation hook of `gmn_apply_patch`
+func TestApplyPatchConfirmHook(t *testing.T) {
+	_, _, confirmHooks, err := buildSelfServer(newStdoutWriter(), config{}, params{})
+	if err != nil {
+		t.Fatalf("failed to build self server: %s", err)
+	}
+	hook, exists := confirmHooks["gmn_apply_patch"]
+	if !exists {
+		t.Fatalf("expected a confirmation hook for 'gmn_apply_patch'")
+	}
+
+	fpath := filepath.Join(t.TempDir(), "hello.txt")
+	if err := os.WriteFile(fpath, []byte("hello\nworld\n"), 0o644); err != nil {
+		t.Fatalf("failed to write file: %s", err)
+	}
+	patch := "<<<<<<< SEARCH\nworld\n=======\nthere\n>>>>>>> REPLACE"
+
+	// dry runs need no confirmation
+	if _, needsConfirmation := hook(map[string]any{"filepath": fpath, "patch": patch, "dry_run": true}); needsConfirmation {
+		t.Errorf("expected no confirmation for dry runs")
+	}
+
+	// the computed changes are previewed
+	preview, needsConfirmation := hook(map[string]any{"filepath": fpath, "patch": patch})
+	if !needsConfirmation || !strings.Contains(preview, "+there") || !strings.Contains(preview, "-world") {
+		t.Errorf("expected a preview of the changes with confirmation, got '%s' (%t)", preview, needsConfirmation)
+	}
+
+	// failures are previewed too
+	if preview, needsConfirmation := hook(map[string]any{"filepath": fpath, "patch": "<<<<<<< SEARCH\nnothing\n=======\n\n>>>>>>> REPLACE"}); !needsConfirmation || !strings.Contains(preview, "failed to preview") {
+		t.Errorf("expected a failure in the preview with confirmation, got '%s' (%t)", preview, needsConfirmation)
+	}
+
+	// the file is not modified
+	if bytes, _ := os.ReadFile(fpath); string(bytes) != "hello\nworld\n" {
+		t.Errorf("expected the file not to be modified, got '%s'", bytes)
+	}
+}
+
+// test `checkMediaOutput` with valid and invalid values
+func TestCheckMediaOutput(t *testing.T) {
+	type test struct {
+		mediaOutput *string
+		expectError bool
+	}
+
+	tests := []test{
+		{mediaOutput: nil},
+		{mediaOutput: new(mediaOutputPath)},
+		{mediaOutput: new(mediaOutputContent)},
+		{mediaOutput: new("inline"), expectError: true},
+		{mediaOutput: new(""), expectError: true},
+	}
+
+	for _, test := range tests {
+		if err := checkMediaOutput(test.mediaOutput); (err != nil) != test.expectError {
+			t.Errorf("expected error: %t for %v, got %v", test.expectError, test.mediaOutput, err)
+		}
+	}
+}
+
+// test `generatedMediaContents` with media of various sizes and types
+func TestGeneratedMediaContents(t *testing.T) {
+	server := mcp.NewServer(&mcp.Implementation{Name: "test"}, nil)
+	fpath := filepath.Join(t.TempDir(), "generated.png")
+
+	type test struct {
+		mediaOutput string
+		data        []byte
+		mimeType    string
+		fpath       string
+
+		expectedType string // (type of the only content, or empty for no content)
+		expectedText string // (substring of the text content)
+	}
+
+	small, large := []byte("small"), []byte(strings.Repeat("large", 10))
+
+	tests := []test{
+		// should return nothing with path output
+		{mediaOutput: mediaOutputPath, data: small, mimeType: "image/png", fpath: fpath},
+		// should return small media inline
+		{mediaOutput: mediaOutputContent, data: small, mimeType: "image/png", fpath: fpath, expectedType: "*mcp.ImageContent"},
+		{mediaOutput: mediaOutputContent, data: small, mimeType: "audio/wav", expectedType: "*mcp.AudioContent"},
+		{mediaOutput: mediaOutputContent, data: small, mimeType: "video/mp4", fpath: fpath, expectedType: "*mcp.EmbeddedResource"},
+		{mediaOutput: mediaOutputContent, data: small, mimeType: "video/mp4"},
+		// should return large and saved media as resource links
+		{mediaOutput: mediaOutputContent, data: large, mimeType: "image/png", fpath: fpath, expectedType: "*mcp.ResourceLink"},
+		// should omit large and unsaved media
+		{mediaOutput: mediaOutputContent, data: large, mimeType: "image/png", expectedType: "*mcp.TextContent", expectedText: "omitted media exceeding the size limit of 10 bytes: image/png, 50 bytes"},
+	}
+
+	for _, test := range tests {
+		contents := generatedMediaContents(server, test.mediaOutput, 10, test.data, test.mimeType, test.fpath)
+
+		if test.expectedType == "" {
+			if len(contents) > 0 {
+				t.Errorf("expected no content, got %+v", contents)
+			}
+			continue
+		}
+		if len(contents) != 1 {
+			t.Errorf("expected one content of %s, got %+v", test.expectedType, contents)
+			continue
+		}
+		if typ := fmt.Sprintf("%T", contents[0]); typ != test.expectedType {
+			t.Errorf("expected content of %s, got %s", test.expectedType, typ)
+		}
+		if text, ok := contents[0].(*mcp.TextContent); ok && !strings.Contains(text.Text, test.expectedText) {
+			t.Errorf("expected '%s' in the text, got '%s'", test.expectedText, text.Text)
+		}
+	}
+}
@@ -0,0 +1,609 @@
+// skills.go
+//
+// Things for loading, creating, and validating skills.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/adrg/frontmatter"
+	"github.com/fatih/color"
+	skills "github.com/meinside/mcp-skills-go/skills"
+)
+
+const (
+	skillsDirname        = "skills"
+	projectSkillsDirname = ".gmn"
+
+	skillFilename           = "SKILL.md"
+	skillScriptsDirname     = "scripts"
+	skillReferencesDirname  = "references"
+	skillNameMaxLength      = 64
+	skillDescriptionMaxSize = 1024
+
+	// template of `SKILL.md` for new skills
+	newSkillTemplate = `---
+name: %[1]s
+description: "TODO: Describe what this skill does, and when it should be used."
+version: 0.0.1
+---
+
+# %[1]s
+
+TODO: Write instructions for this skill.
+
+Put additional documents in ` + "`" + skillReferencesDirname + "/`" + ` and executable scripts in ` + "`" + skillScriptsDirname + "/`" + `,
+and refer to them with their relative paths from this directory.
+`
+)
+
+// pre-compiled regexps
+var (
+	_skillNameRegexp           = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+	_skillMarkdownLinkRegexp   = regexp.MustCompile(`\]\(([^)\s]+)\)`)
+	_skillInlineCodePathRegexp = regexp.MustCompile("`((?:" + skillScriptsDirname + "|" + skillReferencesDirname + "|assets)/[^`\\s]+)`")
+)
+
+// a skill loaded from a skills directory
+type loadedSkill struct {
+	meta      skills.SkillMeta
+	directory string // skills directory which this skill was loaded from
+}
+
+// skills merged from multiple directories, served as a single `fs.FS`
+//
+// (the root directory can only be read with `ReadDir`)
+type mergedSkills struct {
+	skills []loadedSkill
+	owners map[string]fs.FS // skill directory name => fs of the skills directory
+}
+
+// resolve skills directories, in the order of precedence:
+//
+// 1. directories given with `--skills-dir` (or `skills_dirs` in the config file),
+// 2. project-local `.gmn/skills` in the current directory,
+// 3. `$XDG_CONFIG_HOME/gmn/skills`
+//
+// (auto-discovered ones are included only when they exist)
+func resolveSkillsDirectories(
+	conf config,
+	p params,
+) (dirs []string, err error) {
+	given := p.Skills.SkillsDirectories
+	if len(given) == 0 {
+		given = conf.SkillsDirectories
+	}
+	for _, dir := range given {
+		dir = expandPath(dir)
+		if _, err := os.Stat(dir); err != nil {
+			return nil, fmt.Errorf("skills directory not found: %w", err)
+		}
+		dirs = append(dirs, dir)
+	}
+
+	if !p.Skills.NoAutoDiscovery {
+		for _, dir := range []string{
+			filepath.Join(projectSkillsDirname, skillsDirname),
+			filepath.Join(filepath.Dir(resolveConfigFilepath(nil)), skillsDirname),
+		} {
+			if info, err := os.Stat(dir); err == nil && info.IsDir() {
+				dirs = append(dirs, dir)
+			}
+		}
+	}
+
+	// remove duplicated ones
+	deduped := []string{}
+	seen := map[string]bool{}
+	for _, dir := range dirs {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			abs = dir
+		}
+		if seen[abs] {
+			continue
+		}
+		seen[abs] = true
+		deduped = append(deduped, abs)
+	}
+
+	return deduped, nil
+}
+
+// load skills from given directories
+//
+// when skills share the same name (or directory name),
+// the one from the directory with higher precedence is used and others are skipped with warnings
+func loadSkills(
+	writer outputWriter,
+	p params,
+	dirs []string,
+) (merged *mergedSkills, err error) {
+	merged = &mergedSkills{
+		owners: map[string]fs.FS{},
+	}
+
+	names := map[string]loadedSkill{}
+	for _, dir := range dirs {
+		fsys := os.DirFS(dir)
+
+		var metas []skills.SkillMeta
+		if metas, err = skills.ListSkills(fsys); err != nil {
+			return nil, fmt.Errorf("failed to list skills in '%s': %w", dir, err)
+		}
+
+		for _, meta := range metas {
+			name := meta.Name
+			if len(name) == 0 {
+				name = meta.Dir
+			}
+
+			if existing, exists := names[name]; exists {
+				writer.warn(
+					"Skipping skill '%s' in '%s', as it is shadowed by the one in '%s'.",
+					name,
+					dir,
+					existing.directory,
+				)
+				continue
+			}
+			if _, exists := merged.owners[meta.Dir]; exists {
+				writer.warn(
+					"Skipping skill '%s' in '%s', as its directory name '%s' is already taken.",
+					name,
+					dir,
+					meta.Dir,
+				)
+				continue
+			}
+
+			skill := loadedSkill{
+				meta:      meta,
+				directory: dir,
+			}
+			names[name] = skill
+			merged.owners[meta.Dir] = fsys
+			merged.skills = append(merged.skills, skill)
+
+			writer.verbose(
+				verboseMedium,
+				p.Verbose,
+				"loaded skill '%s' from '%s'",
+				name,
+				dir,
+			)
+		}
+	}
+
+	slices.SortFunc(merged.skills, func(a, b loadedSkill) int {
+		return strings.Compare(a.meta.Dir, b.meta.Dir)
+	})
+
+	return merged, nil
+}
+
+// return the skill directory name of given path
+func skillDirOf(name string) string {
+	skillDir, _, _ := strings.Cut(name, "/")
+	return skillDir
+}
+
+// Open opens a file in one of the skills (implements `fs.FS`)
+func (m *mergedSkills) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) || name == "." {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	fsys, exists := m.owners[skillDirOf(name)]
+	if !exists {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+
+	return fsys.Open(name)
+}
+
+// ReadDir reads a directory in the merged skills (implements `fs.ReadDirFS`)
+func (m *mergedSkills) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+
+	// root: directories of all loaded skills
+	if name == "." {
+		entries := []fs.DirEntry{}
+		for _, skill := range m.skills {
+			info, err := fs.Stat(m.owners[skill.meta.Dir], skill.meta.Dir)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, fs.FileInfoToDirEntry(info))
+		}
+		return entries, nil
+	}
+
+	fsys, exists := m.owners[skillDirOf(name)]
+	if !exists {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+
+	return fs.ReadDir(fsys, name)
+}
+
+// list skills with their names, descriptions, and files
+func listSkills(
+	writer outputWriter,
+	conf config,
+	p params,
+) (exit int, e error) {
+	writer.verbose(
+		verboseMedium,
+		p.Verbose,
+		"listing skills...",
+	)
+
+	dirs, err := resolveSkillsDirectories(conf, p)
+	if err != nil {
+		return 1, err
+	}
+	if len(dirs) == 0 {
+		return 1, errors.New("no skills directories found")
+	}
+
+	merged, err := loadSkills(writer, p, dirs)
+	if err != nil {
+		return 1, err
+	}
+	if len(merged.skills) == 0 {
+		return 1, fmt.Errorf("no skills in: %s", strings.Join(dirs, ", "))
+	}
+
+	// (for JSON output)
+	type skillInfo struct {
+		skills.SkillMeta
+		Location string   `json:"location"`
+		Files    []string `json:"files"`
+	}
+	infos := []skillInfo{}
+
+	for _, skill := range merged.skills {
+		files, err := skills.ListResources(merged, skill.meta.Dir)
+		if err != nil {
+			return 1, fmt.Errorf("failed to list files of skill '%s': %w", skill.meta.Name, err)
+		}
+		location := filepath.Join(skill.directory, skill.meta.Dir)
+
+		if p.outputAsJSON() {
+			infos = append(infos, skillInfo{
+				SkillMeta: skill.meta,
+				Location:  location,
+				Files:     files,
+			})
+			continue
+		}
+
+		// skill name
+		writer.printColored(
+			color.FgHiGreen,
+			"%s",
+			skill.meta.Name,
+		)
+		if len(skill.meta.Version) > 0 {
+			writer.printColored(
+				color.FgHiWhite,
+				" (%s)",
+				skill.meta.Version,
+			)
+		}
+
+		// description, location, and files
+		writer.printColored(
+			color.FgWhite,
+			`
+  > description: %s
+  > location: %s
+`,
+			skill.meta.Description,
+			location,
+		)
+		if len(files) > 0 {
+			writer.printColored(
+				color.FgWhite,
+				"  > files: %s\n",
+				strings.Join(files, ", "),
+			)
+		}
+	}
+
+	if p.outputAsJSON() {
+		return 0, printJSONResult(writer, struct {
+			Skills []skillInfo `json:"skills"`
+		}{
+			Skills: infos,
+		})
+	}
+
+	// success
+	return 0, nil
+}
+
+// create a skeleton of a new skill with given name
+//
+// (created in the first skills directory given, or in `.gmn/skills` of the current directory)
+func newSkill(
+	writer outputWriter,
+	conf config,
+	p params,
+) (exit int, e error) {
+	name := *p.Skills.NewSkill
+	if !_skillNameRegexp.MatchString(name) || len(name) > skillNameMaxLength {
+		return 1, fmt.Errorf(
+			"invalid skill name '%s': should be lowercase letters, digits, and hyphens (up to %d characters)",
+			name,
+			skillNameMaxLength,
+		)
+	}
+
+	dir := filepath.Join(projectSkillsDirname, skillsDirname)
+	if len(p.Skills.SkillsDirectories) > 0 {
+		dir = expandPath(p.Skills.SkillsDirectories[0])
+	} else if len(conf.SkillsDirectories) > 0 {
+		dir = expandPath(conf.SkillsDirectories[0])
+	}
+	skillDir := filepath.Join(dir, name)
+
+	if _, err := os.Stat(skillDir); err == nil {
+		return 1, fmt.Errorf("skill directory already exists: '%s'", skillDir)
+	}
+
+	writer.verbose(
+		verboseMedium,
+		p.Verbose,
+		"creating skill '%s' in '%s'...",
+		name,
+		dir,
+	)
+
+	for _, subdir := range []string{
+		skillReferencesDirname,
+		skillScriptsDirname,
+	} {
+		if err := os.MkdirAll(filepath.Join(skillDir, subdir), 0o755); err != nil {
+			return 1, fmt.Errorf("failed to create skill directory: %w", err)
+		}
+	}
+	if err := os.WriteFile(
+		filepath.Join(skillDir, skillFilename),
+		fmt.Appendf(nil, newSkillTemplate, name),
+		0o644,
+	); err != nil {
+		return 1, fmt.Errorf("failed to write %s: %w", skillFilename, err)
+	}
+
+	if p.outputAsJSON() {
+		return 0, printJSONResult(writer, struct {
+			Created string `json:"created"`
+		}{
+			Created: skillDir,
+		})
+	}
+
+	writer.printColored(
+		color.FgHiGreen,
+		"Created skill '%s' in: %s\n",
+		name,
+		skillDir,
+	)
+
+	// success
+	return 0, nil
+}
+
+// a problem found while validating a skill
+type skillProblem struct {
+	isError bool // error if true, warning otherwise
+	message string
+}
+
+// validate a skill in given directory, and return found problems
+func validateSkill(skillDir string) (problems []skillProblem) {
+	errorf := func(format string, a ...any) {
+		problems = append(problems, skillProblem{isError: true, message: fmt.Sprintf(format, a...)})
+	}
+	warnf := func(format string, a ...any) {
+		problems = append(problems, skillProblem{message: fmt.Sprintf(format, a...)})
+	}
+
+	data, err := os.ReadFile(filepath.Join(skillDir, skillFilename))
+	if err != nil {
+		errorf("failed to read %s: %s", skillFilename, err)
+		return problems
+	}
+
+	// metadata
+	var meta skills.SkillMeta
+	body, err := frontmatter.MustParse(bytes.NewReader(data), &meta)
+	if err != nil {
+		errorf("failed to parse front matter: %s", err)
+		return problems
+	}
+	if len(meta.Name) == 0 {
+		errorf("'name' is missing")
+	} else {
+		if !_skillNameRegexp.MatchString(meta.Name) || len(meta.Name) > skillNameMaxLength {
+			warnf("'name' should be lowercase letters, digits, and hyphens (up to %d characters): '%s'", skillNameMaxLength, meta.Name)
+		}
+		if dirname := filepath.Base(skillDir); meta.Name != dirname {
+			warnf("'name' ('%s') differs from its directory name ('%s')", meta.Name, dirname)
+		}
+	}
+	if len(strings.TrimSpace(meta.Description)) == 0 {
+		errorf("'description' is missing")
+	} else if len(meta.Description) > skillDescriptionMaxSize {
+		warnf("'description' is longer than %d bytes", skillDescriptionMaxSize)
+	}
+	if len(strings.TrimSpace(string(body))) == 0 {
+		warnf("body of %s is empty", skillFilename)
+	}
+
+	// referenced files
+	referenced := []string{}
+	for _, match := range _skillMarkdownLinkRegexp.FindAllStringSubmatch(string(body), -1) {
+		link := match[1]
+		if strings.Contains(link, "://") ||
+			strings.HasPrefix(link, "#") ||
+			strings.HasPrefix(link, "mailto:") {
+			continue
+		}
+		link, _, _ = strings.Cut(link, "#")
+		referenced = append(referenced, link)
+	}
+	for _, match := range _skillInlineCodePathRegexp.FindAllStringSubmatch(string(body), -1) {
+		referenced = append(referenced, match[1])
+	}
+	slices.Sort(referenced)
+	for _, ref := range slices.Compact(referenced) {
+		if filepath.IsAbs(ref) || !filepath.IsLocal(filepath.FromSlash(ref)) {
+			errorf("referenced file is outside of the skill directory: '%s'", ref)
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(skillDir, filepath.FromSlash(ref))); err != nil {
+			errorf("referenced file does not exist: '%s'", ref)
+		}
+	}
+
+	// scripts
+	scriptsDir := filepath.Join(skillDir, skillScriptsDirname)
+	if entries, err := os.ReadDir(scriptsDir); err == nil {
+		for _, entry := range entries {
+			if entry.IsDir() {
+				continue
+			}
+			info, err := entry.Info()
+			if err != nil {
+				errorf("failed to stat script '%s': %s", entry.Name(), err)
+				continue
+			}
+			if info.Mode().Perm()&0o111 == 0 {
+				warnf("script is not executable: '%s'", filepath.Join(skillScriptsDirname, entry.Name()))
+			}
+		}
+	}
+
+	return problems
+}
+
+// validate all skills in given directory, and report their problems
+//
+// (exits with 1 if any error is found)
+func validateSkills(
+	writer outputWriter,
+	p params,
+) (exit int, e error) {
+	dir := expandPath(*p.Skills.ValidateSkills)
+
+	writer.verbose(
+		verboseMedium,
+		p.Verbose,
+		"validating skills in '%s'...",
+		dir,
+	)
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 1, fmt.Errorf("failed to read skills directory: %w", err)
+	}
+
+	// (for JSON output)
+	type problemInfo struct {
+		Severity string `json:"severity"`
+		Message  string `json:"message"`
+	}
+	type skillResult struct {
+		Skill    string        `json:"skill"`
+		Problems []problemInfo `json:"problems"`
+	}
+	results := []skillResult{}
+
+	numSkills, numErrors, numWarnings := 0, 0, 0
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		numSkills++
+
+		problems := validateSkill(filepath.Join(dir, entry.Name()))
+
+		result := skillResult{
+			Skill:    entry.Name(),
+			Problems: []problemInfo{},
+		}
+		for _, problem := range problems {
+			severity := "warning"
+			if problem.isError {
+				severity = "error"
+				numErrors++
+			} else {
+				numWarnings++
+			}
+			result.Problems = append(result.Problems, problemInfo{
+				Severity: severity,
+				Message:  problem.message,
+			})
+		}
+		results = append(results, result)
+
+		if p.outputAsJSON() {
+			continue
+		}
+		if len(problems) == 0 {
+			writer.printColored(color.FgHiGreen, "%s: ok\n", entry.Name())
+			continue
+		}
+		writer.printColored(color.FgHiYellow, "%s:\n", entry.Name())
+		for _, problem := range result.Problems {
+			c := color.FgYellow
+			if problem.Severity == "error" {
+				c = color.FgHiRed
+			}
+			writer.printColored(c, "  > %s: %s\n", problem.Severity, problem.Message)
+		}
+	}
+
+	if p.outputAsJSON() {
+		if err := printJSONResult(writer, struct {
+			Skills   []skillResult `json:"skills"`
+			Errors   int           `json:"errors"`
+			Warnings int           `json:"warnings"`
+		}{
+			Skills:   results,
+			Errors:   numErrors,
+			Warnings: numWarnings,
+		}); err != nil {
+			return 1, err
+		}
+	}
+
+	if numSkills == 0 {
+		return 1, fmt.Errorf("no skills in: %s", dir)
+	}
+	if numErrors > 0 {
+		return 1, fmt.Errorf(
+			"found %d error(s) and %d warning(s) in %d skill(s)",
+			numErrors,
+			numWarnings,
+			numSkills,
+		)
+	}
+
+	// success
+	return 0, nil
+}
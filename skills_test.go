@@ -0,0 +1,149 @@
+// skills_test.go
+//
+// Things for testing `skills.go`.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	skills "github.com/meinside/mcp-skills-go/skills"
+)
+
+// test `loadSkills` with skills in multiple directories
+func TestLoadSkills(t *testing.T) {
+	writeSkill := func(dir, skillDir, name, description string, files ...string) {
+		path := filepath.Join(dir, skillDir)
+		if err := os.MkdirAll(path, 0o755); err != nil {
+			t.Fatalf("failed to create skill directory: %s", err)
+		}
+		if err := os.WriteFile(
+			filepath.Join(path, "SKILL.md"),
+			[]byte("---\nname: "+name+"\ndescription: "+description+"\n---\nbody of "+name+"\n"),
+			0o644,
+		); err != nil {
+			t.Fatalf("failed to write skill: %s", err)
+		}
+		for _, file := range files {
+			if err := os.WriteFile(filepath.Join(path, file), []byte(file), 0o644); err != nil {
+				t.Fatalf("failed to write skill file: %s", err)
+			}
+		}
+	}
+
+	team, private := t.TempDir(), t.TempDir()
+	writeSkill(team, "review", "review", "team review", "guide.md")
+	writeSkill(team, "deploy", "deploy", "team deploy")
+	writeSkill(private, "my-review", "review", "private review") // shadowed by name
+	writeSkill(private, "deploy", "deploy2", "private deploy")   // shadowed by directory name
+	writeSkill(private, "notes", "notes", "private notes")
+
+	merged, err := loadSkills(newStdoutWriter(), params{}, []string{team, private})
+	if err != nil {
+		t.Fatalf("failed to load skills: %s", err)
+	}
+
+	// should keep the ones with higher precedence
+	metas, err := skills.ListSkills(merged)
+	if err != nil {
+		t.Fatalf("failed to list merged skills: %s", err)
+	}
+	descriptions := []string{}
+	for _, meta := range metas {
+		descriptions = append(descriptions, meta.Description)
+	}
+	if expected := []string{"team deploy", "private notes", "team review"}; !slices.Equal(descriptions, expected) {
+		t.Errorf("expected %v, got %v", expected, descriptions)
+	}
+
+	// should read skills and their files through the merged fs
+	if skill, err := skills.GetSkill(merged, "notes"); err != nil {
+		t.Errorf("failed to get skill: %s", err)
+	} else if skill.Body != "body of notes\n" {
+		t.Errorf("unexpected body of skill: '%s'", skill.Body)
+	}
+	if files, err := skills.ListResources(merged, "review"); err != nil {
+		t.Errorf("failed to list skill files: %s", err)
+	} else if !slices.Equal(files, []string{"guide.md"}) {
+		t.Errorf("expected [guide.md], got %v", files)
+	}
+	if _, err := skills.GetSkill(merged, "my-review"); err == nil {
+		t.Errorf("should fail to get a shadowed skill")
+	}
+}
+
+// test `validateSkill` with valid and broken skills
+func TestValidateSkill(t *testing.T) {
+	type test struct {
+		dirname        string
+		skill          string
+		files          map[string]os.FileMode
+		expectedErrors int
+		expectedWarns  int
+	}
+
+	tests := []test{
+		// valid one
+		{
+			dirname: "valid",
+			skill:   "---\nname: valid\ndescription: a valid skill\n---\nRead [guide](references/guide.md#usage), then run `scripts/run.sh`.\n",
+			files:   map[string]os.FileMode{"references/guide.md": 0o644, "scripts/run.sh": 0o755},
+		},
+		// missing metadata
+		{
+			dirname:        "no-meta",
+			skill:          "---\nversion: 0.0.1\n---\nbody\n",
+			expectedErrors: 2,
+		},
+		// no front matter at all
+		{
+			dirname:        "no-front-matter",
+			skill:          "just a body\n",
+			expectedErrors: 1,
+		},
+		// missing or escaping references, non-executable script, and mismatched name
+		{
+			dirname:        "broken",
+			skill:          "---\nname: Broken_Skill\ndescription: a broken skill\n---\nSee [this](references/none.md), [that](../other/SKILL.md), and [web](https://example.com).\n",
+			files:          map[string]os.FileMode{"scripts/run.sh": 0o644},
+			expectedErrors: 2,
+			expectedWarns:  3,
+		},
+	}
+
+	root := t.TempDir()
+	for _, test := range tests {
+		dir := filepath.Join(root, test.dirname)
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatalf("failed to create skill directory: %s", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, skillFilename), []byte(test.skill), 0o644); err != nil {
+			t.Fatalf("failed to write skill: %s", err)
+		}
+		for file, mode := range test.files {
+			path := filepath.Join(dir, file)
+			if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+				t.Fatalf("failed to create directory: %s", err)
+			}
+			if err := os.WriteFile(path, []byte(file), mode); err != nil {
+				t.Fatalf("failed to write skill file: %s", err)
+			}
+		}
+
+		errs, warns := 0, 0
+		problems := validateSkill(dir)
+		for _, problem := range problems {
+			if problem.isError {
+				errs++
+			} else {
+				warns++
+			}
+		}
+		if errs != test.expectedErrors || warns != test.expectedWarns {
+			t.Errorf("expected %d error(s) and %d warning(s) for '%s', got: %+v", test.expectedErrors, test.expectedWarns, test.dirname, problems)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+// videos.go
+//
+// Things for generating videos.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"google.golang.org/genai"
+)
+
+const (
+	// interval for polling the operation of video generation
+	videoOperationPollIntervalSeconds = 5
+)
+
+// generate videos with given genai client, calling `onPoll` whenever the operation is polled
+//
+// (same as `gt.Client.GenerateVideos`, but reports the status of the operation while waiting for it)
+func generateVideosWithProgress(
+	ctx context.Context,
+	client *genai.Client,
+	model string,
+	prompt *string,
+	image *genai.Image,
+	video *genai.Video,
+	options *genai.GenerateVideosConfig,
+	onPoll func(operation *genai.GenerateVideosOperation, elapsed time.Duration),
+) (*genai.GenerateVideosResponse, error) {
+	if prompt == nil && image == nil && video == nil {
+		return nil, fmt.Errorf("at least one of prompt, image, or video must be provided")
+	}
+
+	source := genai.GenerateVideosSource{
+		Image: image,
+		Video: video,
+	}
+	if prompt != nil {
+		source.Prompt = *prompt
+	}
+
+	started := time.Now()
+	operation, err := client.Models.GenerateVideosFromSource(ctx, model, &source, options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate videos: %w", err)
+	}
+
+	for {
+		if operation.Done {
+			if len(operation.Error) > 0 {
+				return nil, fmt.Errorf("failed to generate videos: %v", operation.Error)
+			}
+			if operation.Response == nil {
+				return nil, fmt.Errorf("failed to generate videos: no response in the operation")
+			}
+			return operation.Response, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("cancelled while waiting for video generation: %w", ctx.Err())
+		case <-time.After(videoOperationPollIntervalSeconds * time.Second):
+		}
+
+		if operation, err = client.Operations.GetVideosOperation(ctx, operation, nil); err != nil {
+			return nil, fmt.Errorf("failed to get the status of video generation: %w", err)
+		}
+		if onPoll != nil {
+			onPoll(operation, time.Since(started))
+		}
+	}
+}
+
+// return the progress percentage in the metadata of given operation, if any
+func videoOperationProgress(operation *genai.GenerateVideosOperation) (percent float64, exists bool) {
+	if operation == nil {
+		return 0, false
+	}
+
+	switch v := operation.Metadata["progressPercent"].(type) {
+	case float64:
+		return v, true
+	case string:
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return f, true
+		}
+	}
+	return 0, false
+}
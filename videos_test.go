@@ -0,0 +1,37 @@
+// videos_test.go
+//
+// Things for testing `videos.go`.
+
+package main
+
+import (
+	"testing"
+
+	"google.golang.org/genai"
+)
+
+// test `videoOperationProgress` with various metadata
+func TestVideoOperationProgress(t *testing.T) {
+	type test struct {
+		operation *genai.GenerateVideosOperation
+
+		expectedPercent float64
+		expectedExists  bool
+	}
+
+	tests := []test{
+		{operation: nil},
+		{operation: &genai.GenerateVideosOperation{}},
+		{operation: &genai.GenerateVideosOperation{Metadata: map[string]any{"createTime": "2026-10-18T00:00:00Z"}}},
+		{operation: &genai.GenerateVideosOperation{Metadata: map[string]any{"progressPercent": float64(42)}}, expectedPercent: 42, expectedExists: true},
+		{operation: &genai.GenerateVideosOperation{Metadata: map[string]any{"progressPercent": "57.5"}}, expectedPercent: 57.5, expectedExists: true},
+		{operation: &genai.GenerateVideosOperation{Metadata: map[string]any{"progressPercent": "unknown"}}},
+	}
+
+	for _, test := range tests {
+		percent, exists := videoOperationProgress(test.operation)
+		if percent != test.expectedPercent || exists != test.expectedExists {
+			t.Errorf("expected (%v, %t), got (%v, %t)", test.expectedPercent, test.expectedExists, percent, exists)
+		}
+	}
+}